@@ -0,0 +1,135 @@
+package vidfusion
+
+import (
+    "errors"
+    "fmt"
+    "regexp"
+    "slices"
+    "strconv"
+)
+
+// AutoCropOptions 自动去除黑边选项
+type AutoCropOptions struct {
+    Limit     float64 `json:"limit,omitempty" yaml:"limit,omitempty"`         // 黑色的亮度阈值（0~1），亮度不超过阈值的行和列视为黑边，默认 0.1
+    Samples   int     `json:"samples,omitempty" yaml:"samples,omitempty"`     // 在整个片段中均匀抽取检测的帧数，默认 20
+    Tolerance int64   `json:"tolerance,omitempty" yaml:"tolerance,omitempty"` // 宽度不超过 Tolerance 像素的黑边忽略不裁，默认 0
+}
+
+// Validate 校验阈值、抽样帧数和容差
+func (o AutoCropOptions) Validate() error {
+    var errs []error
+    if o.Limit < 0 || o.Limit >= 1 {
+        errs = append(errs, fmt.Errorf("limit should be between 0 and 1, but got %g", o.Limit))
+    }
+    if o.Samples < 0 {
+        errs = append(errs, fmt.Errorf("samples should not be negative"))
+    }
+    if o.Tolerance < 0 {
+        errs = append(errs, fmt.Errorf("tolerance should not be negative"))
+    }
+    return errors.Join(errs...)
+}
+
+// filter 返回按抽样帧率检测黑边的滤镜，duration 为片段时长
+func (o AutoCropOptions) filter(duration float64) string {
+    limit, samples := o.Limit, o.Samples
+    if limit == 0 {
+        limit = 0.1
+    }
+    if samples == 0 {
+        samples = 20
+    }
+    // reset=1 使每一帧单独检测，round=2 保证宽高为偶数
+    filter := fmt.Sprintf("cropdetect=limit=%g:round=2:reset=1", limit)
+    if duration > 0 {
+        filter = fmt.Sprintf("fps=%f,%s", float64(samples)/duration, filter)
+    }
+    return filter
+}
+
+// cropdetectPattern cropdetect 输出到日志中的检测结果
+var cropdetectPattern = regexp.MustCompile(`crop=(-?\d+):(-?\d+):(-?\d+):(-?\d+)`)
+
+// contentArea 汇总每一帧检测到的画面区域，四条边分别取中位数，避免片头片尾的黑场和暗场把画面裁得过小
+// 没有有效的检测结果，或每侧的黑边都不超过 tolerance 时返回 false
+func contentArea(log []byte, width, height, tolerance int64) (CropOptions, bool) {
+    var lefts, tops, rights, bottoms []int64
+    for _, match := range cropdetectPattern.FindAllSubmatch(log, -1) {
+        var values [4]int64
+        for i := range values {
+            values[i], _ = strconv.ParseInt(string(match[i+1]), 10, 64)
+        }
+        w, h, x, y := values[0], values[1], values[2], values[3]
+        // 全黑的帧检测结果为负数或超出画面
+        if w <= 0 || h <= 0 || x < 0 || y < 0 || x+w > width || y+h > height {
+            continue
+        }
+        lefts, tops, rights, bottoms = append(lefts, x), append(tops, y), append(rights, x+w), append(bottoms, y+h)
+    }
+    if len(lefts) == 0 {
+        return CropOptions{}, false
+    }
+    left, top, right, bottom := median(lefts, false), median(tops, false), median(rights, true), median(bottoms, true)
+    if left <= tolerance && top <= tolerance && width-right <= tolerance && height-bottom <= tolerance {
+        return CropOptions{}, false
+    }
+    // 中位数可能为奇数，宽高向下取整为偶数以兼容 yuv420p
+    return CropOptions{X: left, Y: top, Width: (right - left) &^ 1, Height: (bottom - top) &^ 1}, true
+}
+
+// median 返回中位数，偶数个时 upper 为 true 取较大的一个，否则取较小的一个，使画面区域偏向保留更多内容
+func median(values []int64, upper bool) int64 {
+    values = slices.Clone(values)
+    slices.Sort(values)
+    if upper {
+        return values[len(values)/2]
+    }
+    return values[(len(values)-1)/2]
+}
+
+// DetectCrop 抽样检测视频的黑边，返回去除黑边后的画面区域；没有需要去除的黑边时返回 false
+func (sdk *VideoSDKV2) DetectCrop(videoFile string, options AutoCropOptions) (CropOptions, bool, error) {
+    if err := options.Validate(); err != nil {
+        return CropOptions{}, false, err
+    }
+    // 延迟模式下先执行滤镜图，检测和裁剪的是同一个文件
+    videoFile = sdk.flushIfCurrent(videoFile)
+    if sdk.err != nil {
+        return CropOptions{}, false, sdk.err
+    }
+    info, err := sdk.Probe(videoFile)
+    if err != nil {
+        return CropOptions{}, false, err
+    }
+    video := info.VideoStream()
+    if video == nil {
+        return CropOptions{}, false, fmt.Errorf("%s has no video stream", videoFile)
+    }
+    // cropdetect 检测的是自动旋转之后的画面
+    width, height := video.DisplaySize()
+    log, err := sdk.withStep("DetectCrop").runCommandStderr("ffmpeg", "-i", videoFile, "-vf", options.filter(info.Format.Duration), "-an", "-f", "null", "-")
+    if err != nil {
+        return CropOptions{}, false, err
+    }
+    area, ok := contentArea(log, width, height, options.Tolerance)
+    sdk.log().Info("crop detected", "file", videoFile, "crop", ok, "width", area.Width, "height", area.Height, "x", area.X, "y", area.Y)
+    return area, ok, nil
+}
+
+// AutoCrop 使用 cropdetect 检测并去除当前视频的上下或左右黑边，没有黑边时不执行任何命令
+func (sdk *VideoSDKV2) AutoCrop(options AutoCropOptions) *VideoSDKV2 {
+    if sdk.err != nil {
+        return sdk
+    }
+    area, ok, err := sdk.DetectCrop(sdk.CurrentFile, options)
+    if err != nil {
+        sdk.fail("AutoCrop", err)
+        return sdk
+    }
+    if !ok {
+        return sdk
+    }
+    return sdk.filterVideo("AutoCrop", area.filter(), func(int64, int64) (int64, int64) {
+        return area.Width, area.Height
+    })
+}
@@ -0,0 +1,89 @@
+package vidfusion
+
+import (
+    "strings"
+    "testing"
+)
+
+// cropdetectLog 上下各有 140 像素黑边的 1920x1080 视频的 cropdetect 日志，包含一帧全黑和一帧暗场
+const cropdetectLog = `[Parsed_cropdetect_1 @ 0x1] x1:0 x2:1919 y1:140 y2:939 w:1920 h:800 x:0 y:140 pts:0 t:0.000000 limit:0.100000 crop=1920:800:0:140
+[Parsed_cropdetect_1 @ 0x1] x1:1919 x2:0 y1:1079 y2:0 w:-1904 h:-1064 x:1912 y:1072 pts:1 t:0.600000 limit:0.100000 crop=-1904:-1064:1912:1072
+[Parsed_cropdetect_1 @ 0x1] x1:600 x2:1319 y1:300 y2:779 w:720 h:480 x:600 y:300 pts:2 t:1.200000 limit:0.100000 crop=720:480:600:300
+[Parsed_cropdetect_1 @ 0x1] x1:0 x2:1919 y1:142 y2:937 w:1920 h:796 x:0 y:142 pts:3 t:1.800000 limit:0.100000 crop=1920:796:0:142
+[Parsed_cropdetect_1 @ 0x1] x1:0 x2:1919 y1:140 y2:939 w:1920 h:800 x:0 y:140 pts:4 t:2.400000 limit:0.100000 crop=1920:800:0:140
+`
+
+// Test_contentArea 测试汇总检测结果时忽略全黑帧和暗场，以及容差内的黑边
+func Test_contentArea(t *testing.T) {
+    area, ok := contentArea([]byte(cropdetectLog), 1920, 1080, 0)
+    if !ok || area != (CropOptions{Width: 1920, Height: 800, X: 0, Y: 140}) {
+        t.Errorf("content area should be 1920x800+0+140, but got %+v %v", area, ok)
+    }
+    if area, ok := contentArea([]byte(cropdetectLog), 1920, 1080, 140); ok {
+        t.Errorf("borders within the tolerance should be kept, but got %+v", area)
+    }
+    if area, ok := contentArea([]byte("frame=  100 fps=0.0 q=-0.0 size=N/A"), 1920, 1080, 0); ok {
+        t.Errorf("no detection should not crop, but got %+v", area)
+    }
+}
+
+// TestAutoCrop 测试抽样检测黑边后裁剪，作为片段操作时在缩放到目标尺寸之前执行
+func TestAutoCrop(t *testing.T) {
+    upright := strings.Replace(probeJSON, `"rotation": -90`, `"rotation": 0`, 1)
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", upright).On("ffprobe", "format=duration", "12.012").
+        Respond(FakeResponse{Name: "ffmpeg", Match: "cropdetect", Stderr: cropdetectLog})
+    sdk := NewVideoSDKV2("").WithRunner(runner)
+    sdk.ProcessVideos(ProcessVideosOptions{
+        VideoDuration: 12,
+        Width:         720,
+        Height:        1280,
+        Reframe:       ReframeFill,
+        VideosOptions: []VideosOptions{{VideoFile: "1.mp4", Ops: []ClipOperation{{Op: OpAutoCrop, Params: map[string]any{"samples": 10}}}}},
+    })
+    if sdk.Err() != nil {
+        t.Fatalf("ProcessVideos error: %v", sdk.Err())
+    }
+    lines := strings.Join(runner.CommandLines(), "\n")
+    last := -1
+    for _, want := range []string{
+        "ffmpeg -i 1.mp4 -vf fps=0.832501,cropdetect=limit=0.1:round=2:reset=1 -an -f null -",
+        "-i 1.mp4 -vf crop=1920:800:0:140 ",
+        "-vf scale=720:1280:force_original_aspect_ratio=increase,crop=720:1280:(iw-ow)/2:(ih-oh)/2,setsar=1 ",
+    } {
+        index := strings.Index(lines, want)
+        if index <= last {
+            t.Fatalf("commands should contain %q after the previous step:\n%s", want, lines)
+        }
+        last = index
+    }
+
+    runner = NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk = NewVideoSDKV2("in.mp4").WithRunner(runner).AutoCrop(AutoCropOptions{})
+    if lines := runner.CommandLines(); sdk.Err() != nil || sdk.CurrentFile != "in.mp4" || len(lines) != 2 {
+        t.Errorf("video without borders should not be cropped, but got %v %v", lines, sdk.Err())
+    }
+
+    sdk = NewVideoSDKV2("in.mp4").WithRunner(NewFakeRunner()).AutoCrop(AutoCropOptions{Limit: 2, Tolerance: -1})
+    if err := sdk.Err(); err == nil || !strings.Contains(err.Error(), "limit should be between 0 and 1, but got 2\ntolerance should not be negative") {
+        t.Errorf("invalid options should fail, but got %v", err)
+    }
+}
+
+// TestLazy_AutoCrop 测试延迟模式下先执行滤镜图，在执行后的文件上检测黑边
+func TestLazy_AutoCrop(t *testing.T) {
+    upright := strings.Replace(probeJSON, `"rotation": -90`, `"rotation": 0`, 1)
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", upright).Respond(FakeResponse{Name: "ffmpeg", Match: "cropdetect", Stderr: cropdetectLog})
+    sdk := NewVideoSDKV2("src.mp4").WithRunner(runner).Lazy()
+    sdk.Reframe(ReframeOptions{Width: 1920, Height: 1080, Mode: ReframeFit}).AutoCrop(AutoCropOptions{}).Flush()
+    if sdk.Err() != nil {
+        t.Fatalf("AutoCrop error: %v", sdk.Err())
+    }
+    lines := runner.CommandLines()
+    if len(lines) != 6 {
+        t.Fatalf("Reframe should be flushed before detecting, but got:\n%s", strings.Join(lines, "\n"))
+    }
+    reframed := lines[1][strings.LastIndex(lines[1], " ")+1:]
+    if !strings.Contains(lines[3], "ffmpeg -i "+reframed+" -vf fps=") || !strings.Contains(lines[5], "-i "+reframed+" -filter_complex [0:v]crop=1920:800:0:140") {
+        t.Errorf("cropdetect and crop should use the reframed file %s, but got:\n%s", reframed, strings.Join(lines, "\n"))
+    }
+}
@@ -0,0 +1,282 @@
+package vidfusion
+
+import (
+    "errors"
+    "fmt"
+)
+
+// 内置片段处理器名称，FlipVideo、SpeedUpVideo、ScaleUpVideo 同样以处理器的形式注册
+const (
+    OpFlip      = "flip"      // 翻转，参数 direction: horizontal（默认）/ vertical
+    OpSpeed     = "speed"     // 变速，参数 factor: 速度倍数
+    OpScale     = "scale"     // 放大，参数 factor: 放大倍数
+    OpCrop      = "crop"      // 裁剪画面区域，参数 width、height，可选 x、y（默认 0）或 gravity（center、top、bottom-left 等）
+    OpReframe   = "reframe"   // 调整到目标尺寸，参数 width、height，可选 mode（stretch、fit、fill、blur，默认 stretch）、gravity、color、blur
+    OpAutoCrop  = "autocrop"  // 自动去除黑边，可选参数 limit（黑色阈值 0~1，默认 0.1）、samples（抽样帧数，默认 20）、tolerance（忽略的黑边宽度，默认 0）
+    OpRotate    = "rotate"    // 旋转，参数 angle: 顺时针角度，可选 color（角落填充的颜色，默认 black）、expand（是否扩大画布，默认 false）
+    OpTranspose = "transpose" // 转置，参数 direction: clock / cclock / clock_flip / cclock_flip
+    OpColor     = "color"     // 调色，可选参数 brightness（-1~1，默认 0）、contrast（-1000~1000，默认 1）、saturation（0~3，默认 1）、gamma（0.1~10，默认 1）
+)
+
+// ClipOperation 片段处理操作，Params 的含义由 Op 决定
+type ClipOperation struct {
+    Op     string         `json:"op" yaml:"op"`                             // 操作名称，例如 speed
+    Params map[string]any `json:"params,omitempty" yaml:"params,omitempty"` // 操作参数，例如 {"factor": 2}
+}
+
+// init 注册内置片段处理器
+func init() {
+    positive := func(name string) func(params Params) error {
+        return func(params Params) error {
+            if params.Float(name) <= 0 {
+                return fmt.Errorf("%s must be positive", name)
+            }
+            return nil
+        }
+    }
+    factor := []Param{{Name: "factor", Type: ParamNumber}}
+    // 变速时音频默认同步变速，audio 为 drop 时去掉音频
+    speed := []Param{factor[0], {Name: "audio", Type: ParamString, Default: SpeedAudioTempo, Values: []string{SpeedAudioTempo, SpeedAudioDrop}}}
+    applySpeed := func(sdk *VideoSDKV2, params Params) {
+        sdk.SpeedUpVideoWithOptions(SpeedOptions{Speed: params.Float("factor"), Audio: params.String("audio")})
+    }
+
+    // 旧用法 Process 的三种处理方法
+    mustRegisterOperation(FlipVideo, Operation{
+        Apply: func(sdk *VideoSDKV2, params Params) { sdk.FlipVideo() },
+    })
+    mustRegisterOperation(SpeedUpVideo, Operation{
+        Params: speed,
+        Apply:  applySpeed,
+        Check:  positive("factor"),
+    })
+    mustRegisterOperation(ScaleUpVideo, Operation{
+        Params: factor,
+        Apply:  func(sdk *VideoSDKV2, params Params) { sdk.ScaleUpVideo(params.Float("factor")) },
+        Check:  positive("factor"),
+    })
+
+    mustRegisterOperation(OpFlip, Operation{
+        Params: []Param{{Name: "direction", Type: ParamString, Default: "horizontal", Values: []string{"horizontal", "vertical"}}},
+        Apply: func(sdk *VideoSDKV2, params Params) {
+            if params.String("direction") == "vertical" {
+                sdk.VFlip()
+                return
+            }
+            sdk.FlipVideo()
+        },
+    })
+    mustRegisterOperation(OpSpeed, Operation{
+        Params: speed,
+        Apply:  applySpeed,
+        Check:  positive("factor"),
+    })
+    mustRegisterOperation(OpScale, Operation{
+        Params: factor,
+        Apply:  func(sdk *VideoSDKV2, params Params) { sdk.ScaleUpVideo(params.Float("factor")) },
+        Check:  positive("factor"),
+    })
+    crop := func(params Params) CropOptions {
+        return CropOptions{Width: params.Int("width"), Height: params.Int("height"), X: params.Int("x"), Y: params.Int("y"), Gravity: params.String("gravity")}
+    }
+    mustRegisterOperation(OpCrop, Operation{
+        Params: []Param{
+            {Name: "width", Type: ParamInteger},
+            {Name: "height", Type: ParamInteger},
+            {Name: "x", Type: ParamInteger, Default: 0},
+            {Name: "y", Type: ParamInteger, Default: 0},
+            {Name: "gravity", Type: ParamString, Default: ""},
+        },
+        Apply: func(sdk *VideoSDKV2, params Params) { sdk.CropVideoWithOptions(crop(params)) },
+        Check: func(params Params) error { return crop(params).Validate() },
+    })
+    reframe := func(params Params) ReframeOptions {
+        return ReframeOptions{Width: params.Int("width"), Height: params.Int("height"), Mode: params.String("mode"), Gravity: params.String("gravity"), Color: params.String("color"), Blur: int(params.Int("blur"))}
+    }
+    mustRegisterOperation(OpReframe, Operation{
+        Params: []Param{
+            {Name: "width", Type: ParamInteger},
+            {Name: "height", Type: ParamInteger},
+            {Name: "mode", Type: ParamString, Default: ReframeStretch, Values: []string{ReframeStretch, ReframeFit, ReframeFill, ReframeBlur}},
+            {Name: "gravity", Type: ParamString, Default: ""},
+            {Name: "color", Type: ParamString, Default: ""},
+            {Name: "blur", Type: ParamInteger, Default: 0},
+        },
+        Apply: func(sdk *VideoSDKV2, params Params) { sdk.Reframe(reframe(params)) },
+        Check: func(params Params) error { return reframe(params).Validate() },
+    })
+    autoCrop := func(params Params) AutoCropOptions {
+        return AutoCropOptions{Limit: params.Float("limit"), Samples: int(params.Int("samples")), Tolerance: params.Int("tolerance")}
+    }
+    mustRegisterOperation(OpAutoCrop, Operation{
+        Params: []Param{
+            {Name: "limit", Type: ParamNumber, Default: 0},
+            {Name: "samples", Type: ParamInteger, Default: 0},
+            {Name: "tolerance", Type: ParamInteger, Default: 0},
+        },
+        Apply: func(sdk *VideoSDKV2, params Params) { sdk.AutoCrop(autoCrop(params)) },
+        Check: func(params Params) error { return autoCrop(params).Validate() },
+    })
+    rotate := func(params Params) RotateOptions {
+        return RotateOptions{Angle: params.Float("angle"), Color: params.String("color"), Expand: params.Bool("expand")}
+    }
+    mustRegisterOperation(OpRotate, Operation{
+        Params: []Param{
+            {Name: "angle", Type: ParamNumber},
+            {Name: "color", Type: ParamString, Default: ""},
+            {Name: "expand", Type: ParamBool, Default: false},
+        },
+        Apply: func(sdk *VideoSDKV2, params Params) { sdk.RotateWithOptions(rotate(params)) },
+        Check: func(params Params) error { return rotate(params).Validate() },
+    })
+    mustRegisterOperation(OpTranspose, Operation{
+        Params: []Param{{Name: "direction", Type: ParamString, Values: transposeDirections}},
+        Apply:  func(sdk *VideoSDKV2, params Params) { sdk.Transpose(params.String("direction")) },
+    })
+    mustRegisterOperation(OpColor, Operation{
+        Params: []Param{
+            {Name: "brightness", Type: ParamNumber, Default: 0},
+            {Name: "contrast", Type: ParamNumber, Default: 1},
+            {Name: "saturation", Type: ParamNumber, Default: 1},
+            {Name: "gamma", Type: ParamNumber, Default: 1},
+        },
+        Filter: "eq=brightness={brightness}:contrast={contrast}:saturation={saturation}:gamma={gamma}",
+        Check: func(params Params) error {
+            var errs []error
+            for _, r := range []struct {
+                name     string
+                min, max float64
+            }{{"brightness", -1, 1}, {"contrast", -1000, 1000}, {"saturation", 0, 3}, {"gamma", 0.1, 10}} {
+                if value := params.Float(r.name); value < r.min || value > r.max {
+                    errs = append(errs, fmt.Errorf("%s should be between %g and %g, but got %g", r.name, r.min, r.max, value))
+                }
+            }
+            return errors.Join(errs...)
+        },
+    })
+}
+
+// swapSize 旋转 90 度后宽高互换
+func swapSize(width, height int64) (int64, int64) {
+    return height, width
+}
+
+// compile 查找处理器并校验参数，返回应用操作的函数
+func (o ClipOperation) compile() (func(sdk *VideoSDKV2), error) {
+    operation, ok := lookupOperation(o.Op)
+    if !ok {
+        return nil, fmt.Errorf("unknown operation %q", o.Op)
+    }
+    apply, err := operation.compile(o.Op, o.Params)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", o.Op, err)
+    }
+    return apply, nil
+}
+
+// filterVideo 对当前视频应用 -vf 滤镜，音频直接复制；延迟模式下追加到滤镜图，resize 根据滤镜推算输出尺寸，为空表示尺寸不变
+func (sdk *VideoSDKV2) filterVideo(step, filter string, resize func(width, height int64) (int64, int64)) *VideoSDKV2 {
+    if sdk.lazy {
+        return sdk.appendNode(step, func(g *filterGraph) error {
+            g.videoFilter(filter)
+            if resize != nil {
+                g.width, g.height = resize(g.width, g.height)
+            }
+            return nil
+        })
+    }
+    return sdk.runStep(step, func(outputFile string) []string {
+        args := append([]string{"-i", sdk.CurrentFile, "-vf", filter}, sdk.videoArgs()...)
+        return append(args, "-c:a", "copy", outputFile)
+    })
+}
+
+// process 将旧用法的 Process 和 Params 转换为操作，Params 对应处理器的第一个参数
+func (o VideosOptions) process() (ClipOperation, bool) {
+    if o.Process == "" {
+        return ClipOperation{}, false
+    }
+    operation := ClipOperation{Op: o.Process}
+    if definition, ok := lookupOperation(o.Process); ok && len(definition.Params) > 0 && o.Params != 0 {
+        operation.Params = map[string]any{definition.Params[0].Name: o.Params}
+    }
+    return operation, true
+}
+
+// operations 返回片段需要依次应用的操作，旧用法的 Process 排在 Ops 之前
+func (o VideosOptions) operations() []ClipOperation {
+    if operation, ok := o.process(); ok {
+        return append([]ClipOperation{operation}, o.Ops...)
+    }
+    return o.Ops
+}
+
+// Validate 校验片段的入出点、处理方法、操作参数和转场，未注册的处理器视为错误
+func (o VideosOptions) Validate() error {
+    var errs []error
+    if o.In < 0 || (o.Out != 0 && o.Out <= o.In) {
+        errs = append(errs, fmt.Errorf("out must be greater than in"))
+    }
+    if operation, ok := o.process(); ok {
+        if _, found := lookupOperation(operation.Op); !found {
+            errs = append(errs, fmt.Errorf("unknown process %q", o.Process))
+        } else if _, err := operation.compile(); err != nil {
+            errs = append(errs, fmt.Errorf("process %w", err))
+        }
+    }
+    for i, operation := range o.Ops {
+        if _, err := operation.compile(); err != nil {
+            errs = append(errs, fmt.Errorf("ops[%d]: %w", i, err))
+        }
+    }
+    if err := o.Transition.Validate(); err != nil {
+        errs = append(errs, err)
+    }
+    return errors.Join(errs...)
+}
+
+// commands 非延迟模式下处理片段执行的 ffmpeg 命令数，用于估算进度
+func (o VideosOptions) commands() int {
+    commands := 0
+    if o.In > 0 || o.Out > 0 {
+        commands++
+    }
+    for _, operation := range o.operations() {
+        if definition, ok := lookupOperation(operation.Op); ok {
+            commands += definition.Commands
+        }
+    }
+    return commands
+}
+
+// processClip 将片段设置为当前文件，normalizeRotation 为 true 时先按旋转元数据旋转画面，然后按入出点裁剪并依次应用操作
+func (sdk *VideoSDKV2) processClip(clip VideosOptions, normalizeRotation bool) *VideoSDKV2 {
+    sdk.CurrentFile = clip.VideoFile
+    if normalizeRotation {
+        sdk.NormalizeRotation()
+    }
+    if clip.In > 0 || clip.Out > 0 {
+        out := clip.Out
+        if out == 0 {
+            duration, err := sdk.GetVideoDuration(clip.VideoFile)
+            if err != nil {
+                sdk.fail("ProcessVideos", err)
+                return sdk
+            }
+            out = duration
+        }
+        sdk.CropVideoTimeline(clip.In, out)
+    }
+    for _, operation := range clip.operations() {
+        apply, err := operation.compile()
+        if err != nil {
+            sdk.fail("ProcessVideos", fmt.Errorf("%s: %w", clip.VideoFile, err))
+            return sdk
+        }
+        if sdk.err != nil {
+            return sdk
+        }
+        apply(sdk)
+    }
+    return sdk
+}
@@ -0,0 +1,116 @@
+package vidfusion
+
+import (
+    "strings"
+    "testing"
+)
+
+// TestProcessVideos_Ops 测试片段按入出点裁剪后依次应用多个操作
+func TestProcessVideos_Ops(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON).On("ffprobe", "format=duration", "8")
+    sdk := NewVideoSDKV2("").WithRunner(runner)
+    sdk.ProcessVideos(ProcessVideosOptions{
+        VideoDuration: 5,
+        Width:         720,
+        Height:        1280,
+        VideosOptions: []VideosOptions{
+            {VideoFile: "1.mp4", In: 2, Out: 6, Ops: []ClipOperation{
+                {Op: OpFlip, Params: map[string]any{"direction": "vertical"}},
+                {Op: OpSpeed, Params: map[string]any{"factor": 2}},
+            }},
+            {VideoFile: "2.mp4", In: 1, Ops: []ClipOperation{
+                {Op: OpCrop, Params: map[string]any{"width": 640, "height": 360, "x": 10, "y": 20}},
+                {Op: OpColor, Params: map[string]any{"saturation": 1.5}},
+                {Op: OpRotate, Params: map[string]any{"angle": -270}},
+            }},
+        },
+    })
+    if sdk.Err() != nil {
+        t.Fatalf("ProcessVideos error: %v", sdk.Err())
+    }
+    lines := strings.Join(runner.CommandLines(), "\n")
+    last := -1
+    for _, want := range []string{
+        "-i 1.mp4 -ss 2.00 -to 6.00 ",
+        "-vf vflip -c:v libx264 -c:a copy ",
+        "-filter:v setpts=0.500000*PTS ",
+        "ffprobe -i 2.mp4 -show_entries format=duration",
+        "-i 2.mp4 -ss 1.00 -to 8.00 ",
+        "-vf crop=640:360:10:20 ",
+        "-vf eq=brightness=0:contrast=1:saturation=1.5:gamma=1 ",
+        "-vf transpose=clock ",
+        "-f concat",
+    } {
+        index := strings.Index(lines, want)
+        if index <= last {
+            t.Fatalf("commands should contain %q after the previous step:\n%s", want, lines)
+        }
+        last = index
+    }
+    sdk.Cleanup()
+}
+
+// TestLazy_ProcessVideos_Ops 测试延迟模式下片段的裁剪和所有操作合并为一条命令
+func TestLazy_ProcessVideos_Ops(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("").WithRunner(runner).Lazy()
+    sdk.ProcessVideos(ProcessVideosOptions{
+        VideoDuration: 4,
+        Width:         720,
+        Height:        1280,
+        VideosOptions: []VideosOptions{
+            {VideoFile: "1.mp4", In: 1, Out: 5, Ops: []ClipOperation{
+                {Op: OpFlip},
+                {Op: OpCrop, Params: map[string]any{"width": 1080, "height": 1080}},
+                {Op: OpRotate, Params: map[string]any{"angle": 90}},
+            }},
+        },
+    })
+    if sdk.Err() != nil {
+        t.Fatalf("ProcessVideos error: %v", sdk.Err())
+    }
+    lines := runner.CommandLines()
+    want := "-i 1.mp4 -filter_complex [0:v]trim=start=1.00:end=5.00,setpts=PTS-STARTPTS[v1];[0:a]atrim=start=1.00:end=5.00,asetpts=PTS-STARTPTS[a2];[v1]hflip[v3];[v3]crop=1080:1080:0:0[v4];[v4]transpose=clock[v5];[v5]scale=720:1280[v6]"
+    if count := countCommands(runner, "ffmpeg"); count != 3 || !strings.Contains(strings.Join(lines, "\n"), want) {
+        t.Errorf("clip trim and operations should be fused, but got %v", lines)
+    }
+    sdk.Cleanup()
+}
+
+// TestVideosOptions_Validate 测试片段入出点和操作参数的校验
+func TestVideosOptions_Validate(t *testing.T) {
+    for _, c := range []struct {
+        options VideosOptions
+        want    string
+    }{
+        {VideosOptions{In: 3, Out: 2}, "out must be greater than in"},
+        {VideosOptions{Process: SpeedUpVideo}, "process SpeedUpVideo: factor is required"},
+        {VideosOptions{Process: "Reverse"}, `unknown process "Reverse"`},
+        {VideosOptions{Ops: []ClipOperation{{Op: OpSpeed, Params: map[string]any{"factor": -1}}}}, "speed: factor must be positive"},
+        {VideosOptions{Ops: []ClipOperation{{Op: "blur"}}}, `ops[0]: unknown operation "blur"`},
+        {VideosOptions{Ops: []ClipOperation{{Op: OpSpeed, Params: map[string]any{"factor": "fast"}}}}, "factor should be a number"},
+        {VideosOptions{Ops: []ClipOperation{{Op: OpScale, Params: map[string]any{"factr": 2}}}}, "unknown params factr"},
+        {VideosOptions{Ops: []ClipOperation{{Op: OpCrop, Params: map[string]any{"width": 100.5, "height": 100}}}}, "width should be an integer"},
+        {VideosOptions{Ops: []ClipOperation{{Op: OpCrop, Params: map[string]any{"width": 100, "height": 100, "gravity": "middle"}}}}, `crop: unknown gravity "middle"`},
+        {VideosOptions{Ops: []ClipOperation{{Op: OpReframe, Params: map[string]any{"width": 720, "height": 1280, "mode": "zoom"}}}}, "mode should be stretch, fit, fill or blur"},
+        {VideosOptions{Ops: []ClipOperation{{Op: OpRotate, Params: map[string]any{"angle": "left"}}}}, "angle should be a number"},
+        {VideosOptions{Ops: []ClipOperation{{Op: OpRotate, Params: map[string]any{"angle": 15, "color": "black:ow=10"}}}}, `rotate: invalid color "black:ow=10"`},
+        {VideosOptions{Ops: []ClipOperation{{Op: OpTranspose, Params: map[string]any{"direction": "diagonal"}}}}, "direction should be clock, cclock, clock_flip or cclock_flip"},
+        {VideosOptions{Ops: []ClipOperation{{Op: OpColor, Params: map[string]any{"brightness": 2}}}}, "brightness should be between -1 and 1"},
+        {VideosOptions{Ops: []ClipOperation{{Op: OpFlip, Params: map[string]any{"direction": "diagonal"}}}}, "direction should be horizontal or vertical"},
+    } {
+        if err := c.options.Validate(); err == nil || !strings.Contains(err.Error(), c.want) {
+            t.Errorf("%+v should fail with %q, but got %v", c.options, c.want, err)
+        }
+    }
+    valid := VideosOptions{In: 1, Out: 2, Process: FlipVideo, Ops: []ClipOperation{{Op: OpSpeed, Params: map[string]any{"factor": 1.5}}}}
+    if err := valid.Validate(); err != nil {
+        t.Errorf("Validate error: %v", err)
+    }
+
+    sdk := NewVideoSDKV2("").WithRunner(NewFakeRunner())
+    sdk.ProcessVideos(ProcessVideosOptions{VideoDuration: 1, VideosOptions: []VideosOptions{{VideoFile: "1.mp4"}, {VideoFile: "2.mp4", Ops: []ClipOperation{{Op: "blur"}}}}})
+    if err := sdk.Err(); err == nil || !strings.Contains(err.Error(), `videos[1] 2.mp4: ops[0]: unknown operation "blur"`) {
+        t.Errorf("ProcessVideos should validate all clips up front, but got %v", err)
+    }
+}
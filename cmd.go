@@ -1,50 +1,157 @@
 package vidfusion
 
 import (
+    "bytes"
+    "context"
+    "errors"
     "fmt"
     "io"
+    "log/slog"
     "os"
     "os/exec"
     "runtime"
+    "strconv"
+    "strings"
+    "time"
 )
 
+// executor 保存 VideoSDK 和 VideoSDKV2 共用的命令执行配置
+type executor struct {
+    ctx     context.Context // 命令执行的上下文，取消后会终止整个 ffmpeg 进程树
+    timeout time.Duration   // 单条命令的超时时间，0 表示不限制
+    runner  Runner          // 命令执行器，为空时使用 ExecRunner
+    logger  *slog.Logger    // 结构化日志，为空时丢弃所有日志
+    step    string          // 当前步骤名称，记录在日志中
+    encoder *EncoderProfile // 视频编码配置，为空时使用全局 Encoder
+    threads int             // 每个 ffmpeg 进程的编码线程数，0 表示由 ffmpeg 决定
+    // duration 根据输入时长估算当前命令的输出时长，传递给 Runner 用于预演
+    duration func(input float64) float64
+}
+
+// context 返回单条命令使用的上下文，设置了超时时间时附加超时
+func (e *executor) context() (context.Context, context.CancelFunc) {
+    ctx := e.ctx
+    if ctx == nil {
+        ctx = context.Background()
+    }
+    if e.timeout > 0 {
+        return context.WithTimeout(ctx, e.timeout)
+    }
+    return context.WithCancel(ctx)
+}
+
+// getRunner 返回命令执行器
+func (e *executor) getRunner() Runner {
+    if e.runner == nil {
+        return ExecRunner{}
+    }
+    return e.runner
+}
+
+// encoderProfile 返回视频编码配置
+func (e *executor) encoderProfile() EncoderProfile {
+    if e.encoder == nil {
+        return legacyEncoderProfile()
+    }
+    return *e.encoder
+}
+
+// videoArgs 返回视频编码参数
+func (e *executor) videoArgs() []string {
+    args := e.encoderProfile().Args()
+    if e.threads > 0 {
+        args = append(args, "-threads", strconv.Itoa(e.threads))
+    }
+    return args
+}
+
+// log 返回日志记录器
+func (e *executor) log() *slog.Logger {
+    if e.logger == nil {
+        return discardLogger
+    }
+    return e.logger
+}
+
+// withStep 返回记录指定步骤名称的执行配置副本
+func (e *executor) withStep(step string) *executor {
+    clone := *e
+    clone.step = step
+    return &clone
+}
+
+// withCallerStep 未指定步骤名称时，使用调用命令的 SDK 方法名作为步骤名称
+func (e *executor) withCallerStep() *executor {
+    if e.step != "" {
+        return e
+    }
+    // 0: withCallerStep 1: runCommand 等执行函数 2: SDK 方法
+    step := "unknown"
+    if pc, _, _, ok := runtime.Caller(2); ok {
+        name := runtime.FuncForPC(pc).Name()
+        step = name[strings.LastIndex(name, ".")+1:]
+    }
+    return e.withStep(step)
+}
+
+// run 执行命令并分别收集 stdout 和 stderr，ctx 取消或超时时返回 context 错误
+// output 为记录到日志中的命令输出，只在 debug 级别或命令失败时记录
+func (e *executor) run(name string, args []string, stdout, stderr io.Writer, output *bytes.Buffer) error {
+    ctx, cancel := e.context()
+    defer cancel()
+    logger := e.log().With("step", e.step, "command", name)
+    logger.Debug("command started", "args", args)
+    start := time.Now()
+    err := e.getRunner().Run(ctx, &Command{Name: name, Args: args, Stdout: stdout, Stderr: stderr, Step: e.step, Duration: e.duration})
+    if err != nil {
+        err = contextError(ctx, err)
+        logger.Error("command failed", "args", args, "duration", time.Since(start), "exit_code", exitCode(err), "error", err, "stderr", output.String())
+        return err
+    }
+    attrs := []any{"duration", time.Since(start), "exit_code", 0}
+    if logger.Enabled(ctx, slog.LevelDebug) {
+        attrs = append(attrs, "stderr", output.String())
+    }
+    logger.Info("command finished", attrs...)
+    return nil
+}
+
 // runCommand 通用命令执行函数
-func runCommand(name string, args ...string) error {
-    // 获取调用者的函数名
-    pc, _, _, ok := runtime.Caller(1)
-    caller := "unknown"
-    if ok {
-        caller = runtime.FuncForPC(pc).Name()
-    }
-    fmt.Println("Caller:", caller)
-    
+func (e *executor) runCommand(name string, args ...string) error {
+    return e.withCallerStep().runCommandProgress(nil, name, args...)
+}
+
+// runCommandProgress 执行 ffmpeg 命令，onProgress 不为空时通过 -progress 输出解析实时进度
+func (e *executor) runCommandProgress(onProgress func(ffmpegProgress), name string, args ...string) error {
     // 添加 -y 参数，以便在文件已存在时自动覆盖
     args = append([]string{"-y"}, args...)
-    // 如果使用 H264Nvenc 编码器，则添加 -hwaccel cuda 参数进行解码硬件加速
-    if Encoder == H264Nvenc {
-        args = append([]string{"-hwaccel", "cuda"}, args...)
+    // 编码配置指定了硬件加速时添加 -hwaccel 参数进行解码硬件加速
+    if hwaccel := e.encoderProfile().HWAccel; hwaccel != "" {
+        args = append([]string{"-hwaccel", hwaccel}, args...)
     }
-    cmd := exec.Command(name, args...)
-    fmt.Printf("Running command: %v\n", cmd.String())
-    cmdOutput, err := cmd.CombinedOutput()
-    if err != nil {
-        return fmt.Errorf("command error: %v\noutput: %s", err, string(cmdOutput))
+    var cmdOutput bytes.Buffer
+    var stdout, stderr io.Writer = &cmdOutput, &cmdOutput
+    if onProgress != nil {
+        // 进度信息输出到 stdout，关闭 stderr 中的统计行
+        args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+        parser := newProgressParser(onProgress)
+        stdout, stderr = parser.stdout(), parser.stderr(&cmdOutput)
+    }
+    if err := e.run(name, args, stdout, stderr, &cmdOutput); err != nil {
+        return &CommandError{Name: name, Args: args, Stderr: cmdOutput.String(), Err: err}
     }
-    // fmt.Printf("Command output: %s\n", string(cmdOutput))
     return nil
 }
 
 // runCommandAndExtractFloat 从命令结果中提取 float 值
-func runCommandAndExtractFloat(name string, args ...string) (float64, error) {
-    cmd := exec.Command(name, args...)
-    fmt.Printf("Running command: %v\n", cmd.String())
-    output, err := cmd.Output()
-    if err != nil {
-        return 0, fmt.Errorf("command error: %v", err)
+func (e *executor) runCommandAndExtractFloat(name string, args ...string) (float64, error) {
+    var output, stderr bytes.Buffer
+    if err := e.withCallerStep().run(name, args, &output, &stderr, &stderr); err != nil {
+        return 0, &CommandError{Name: name, Args: args, Stderr: stderr.String(), Err: err}
     }
-    
+
     var result float64
-    _, err = fmt.Sscanf(string(output), "%f", &result)
+    _, err := fmt.Sscanf(output.String(), "%f", &result)
     if err != nil {
         return 0, err
     }
@@ -52,19 +159,104 @@ func runCommandAndExtractFloat(name string, args ...string) (float64, error) {
 }
 
 // runCommandAndExtractDimensions 从命令中提取宽度和高度
-func runCommandAndExtractDimensions(name string, args ...string) (int64, int64, error) {
-    cmd := exec.Command(name, args...)
-    fmt.Printf("Running command: %v\n", cmd.String())
-    output, err := cmd.Output()
-    if err != nil {
-        return 0, 0, fmt.Errorf("command error: %v", err)
+func (e *executor) runCommandAndExtractDimensions(name string, args ...string) (int64, int64, error) {
+    var output, stderr bytes.Buffer
+    if err := e.withCallerStep().run(name, args, &output, &stderr, &stderr); err != nil {
+        return 0, 0, &CommandError{Name: name, Args: args, Stderr: stderr.String(), Err: err}
     }
-    
+
     var width, height int
-    fmt.Sscanf(string(output), "%dx%d", &width, &height)
+    if _, err := fmt.Sscanf(output.String(), "%dx%d", &width, &height); err != nil {
+        return 0, 0, fmt.Errorf("failed to parse dimensions from %q: %v", strings.TrimSpace(output.String()), err)
+    }
     return int64(width), int64(height), nil
 }
 
+// runCommandOutput 执行命令并返回 stdout
+func (e *executor) runCommandOutput(name string, args ...string) ([]byte, error) {
+    var output, stderr bytes.Buffer
+    if err := e.withCallerStep().run(name, args, &output, &stderr, &stderr); err != nil {
+        return nil, &CommandError{Name: name, Args: args, Stderr: stderr.String(), Err: err}
+    }
+    return output.Bytes(), nil
+}
+
+// runCommandStderr 执行命令并返回 stderr，用于读取 cropdetect 等分析滤镜输出到日志中的结果
+func (e *executor) runCommandStderr(name string, args ...string) ([]byte, error) {
+    var stderr bytes.Buffer
+    if err := e.withCallerStep().run(name, args, io.Discard, &stderr, &stderr); err != nil {
+        return nil, &CommandError{Name: name, Args: args, Stderr: stderr.String(), Err: err}
+    }
+    return stderr.Bytes(), nil
+}
+
+// videoDimensions 探测视频显示时的宽高，旋转 90 / 270 度的视频宽高互换
+func (e *executor) videoDimensions(file string) (int64, int64, error) {
+    info, err := e.probe(file)
+    if err != nil {
+        return 0, 0, err
+    }
+    video := info.VideoStream()
+    if video == nil {
+        return 0, 0, fmt.Errorf("%s has no video stream", file)
+    }
+    width, height := video.DisplaySize()
+    return width, height, nil
+}
+
+// probe 使用 ffprobe 探测媒体信息
+func (e *executor) probe(file string) (*MediaInfo, error) {
+    output, err := e.withStep("Probe").runCommandOutput("ffprobe", probeArgs(file)...)
+    if err != nil {
+        return nil, err
+    }
+    return parseMediaInfo(output)
+}
+
+// runCommand 使用默认配置执行命令
+func runCommand(name string, args ...string) error {
+    return (&executor{}).runCommand(name, args...)
+}
+
+// runCommandAndExtractFloat 使用默认配置执行命令并提取 float 值
+func runCommandAndExtractFloat(name string, args ...string) (float64, error) {
+    return (&executor{}).runCommandAndExtractFloat(name, args...)
+}
+
+// runCommandAndExtractDimensions 使用默认配置执行命令并提取宽度和高度
+func runCommandAndExtractDimensions(name string, args ...string) (int64, int64, error) {
+    return (&executor{}).runCommandAndExtractDimensions(name, args...)
+}
+
+// commandContext 创建绑定 ctx 的命令，ctx 结束时终止命令所在的整个进程组
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+    cmd := exec.CommandContext(ctx, name, args...)
+    setProcessGroup(cmd)
+    cmd.Cancel = func() error {
+        return killProcessTree(cmd)
+    }
+    // 进程被终止后等待输出管道关闭的最长时间，避免子进程持有管道导致阻塞
+    cmd.WaitDelay = 5 * time.Second
+    return cmd
+}
+
+// exitCode 返回命令的退出码，命令未能启动或被终止时返回 -1
+func exitCode(err error) int {
+    var exitErr *exec.ExitError
+    if errors.As(err, &exitErr) {
+        return exitErr.ExitCode()
+    }
+    return -1
+}
+
+// contextError ctx 已经取消或超时时返回 context 错误，否则返回原始错误
+func contextError(ctx context.Context, err error) error {
+    if ctxErr := ctx.Err(); ctxErr != nil {
+        return ctxErr
+    }
+    return err
+}
+
 // copyFile 将源文件复制到目标文件
 func copyFile(src, dst string) error {
     sourceFile, err := os.Open(src)
@@ -72,24 +264,24 @@ func copyFile(src, dst string) error {
         return err
     }
     defer sourceFile.Close()
-    
+
     destFile, err := os.Create(dst)
     if err != nil {
         return err
     }
     defer destFile.Close()
-    
+
     // 使用 io.Copy 将源文件内容复制到目标文件
     _, err = io.Copy(destFile, sourceFile)
     if err != nil {
         return err
     }
-    
+
     // 确保复制操作完成后，刷新写入缓存
     err = destFile.Sync()
     if err != nil {
         return err
     }
-    
+
     return nil
 }
@@ -0,0 +1,520 @@
+// vidfusion 命令行工具，将 VideoSDKV2 的常用操作和配方渲染暴露为子命令
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "os"
+    "os/signal"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/HeartGarlic/vidfusion"
+    "github.com/HeartGarlic/vidfusion/server"
+    "github.com/HeartGarlic/vidfusion/watch"
+)
+
+// 退出码
+const (
+    exitOK          = 0   // 成功
+    exitFailure     = 1   // 执行失败
+    exitUsage       = 2   // 参数错误
+    exitInterrupted = 130 // 被 Ctrl+C 中断
+)
+
+// errUsage 参数错误，错误信息已经输出
+var errUsage = errors.New("usage error")
+
+// command 子命令
+type command struct {
+    usage string                                  // 用法说明
+    run   func(ctx context.Context, c *cli) error // 执行函数
+}
+
+// commands 所有子命令
+var commands = map[string]command{
+    "render":      {"render [flags] <recipe.yaml|recipe.json>  按配方渲染", runRender},
+    "probe":       {"probe [--json] <file>  探测媒体信息", runProbe},
+    "concat":      {"concat -o <output> --width <w> --height <h> [flags] <video>...  合并视频", runConcat},
+    "overlay":     {"overlay -o <output> --image <image> [flags] <video>  添加图片覆盖", runOverlay},
+    "subtitle":    {"subtitle -o <output> --srt <file> [flags] <video>  添加字幕", runSubtitle},
+    "random-pick": {"random-pick <dir> <count>  随机选择目录中的 mp4 文件", runRandomPick},
+    "serve":       {"serve [flags]  启动本地 HTTP 渲染服务", runServe},
+    "watch":       {"watch [flags] <dir>  监控目录，渲染放入的配方文件和素材文件夹", runWatch},
+}
+
+// cli 一次命令行调用的上下文
+type cli struct {
+    name   string
+    args   []string
+    stdout io.Writer
+    stderr io.Writer
+    flags  *flag.FlagSet
+    // 解析参数后的位置参数
+    positional []string
+    // 通用参数
+    encoder  string
+    timeout  time.Duration
+    verbose  bool
+    lazy     bool
+    dryRun   bool
+    parallel int
+    threads  int
+}
+
+func main() {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+    stop()
+    os.Exit(code)
+}
+
+// run 解析子命令并执行，返回退出码
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+    if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+        printUsage(stderr)
+        if len(args) == 0 {
+            return exitUsage
+        }
+        return exitOK
+    }
+    cmd, ok := commands[args[0]]
+    if !ok {
+        fmt.Fprintf(stderr, "vidfusion: unknown command %q\n\n", args[0])
+        printUsage(stderr)
+        return exitUsage
+    }
+    c := &cli{name: args[0], args: args[1:], stdout: stdout, stderr: stderr}
+    c.flags = flag.NewFlagSet("vidfusion "+c.name, flag.ContinueOnError)
+    c.flags.SetOutput(stderr)
+    c.flags.Usage = func() {
+        fmt.Fprintf(stderr, "usage: vidfusion %s\n\nflags:\n", cmd.usage)
+        c.flags.PrintDefaults()
+    }
+    err := cmd.run(ctx, c)
+    switch {
+    case err == nil:
+        return exitOK
+    case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+        return exitUsage
+    case errors.Is(err, context.Canceled):
+        fmt.Fprintf(stderr, "vidfusion %s: interrupted\n", c.name)
+        return exitInterrupted
+    default:
+        fmt.Fprintf(stderr, "vidfusion %s: %v\n", c.name, err)
+        return exitFailure
+    }
+}
+
+// printUsage 输出所有子命令的用法
+func printUsage(w io.Writer) {
+    fmt.Fprintln(w, "usage: vidfusion <command> [flags] [args]")
+    fmt.Fprintln(w, "\ncommands:")
+    var names []string
+    for name := range commands {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        fmt.Fprintf(w, "  %s\n", commands[name].usage)
+    }
+    fmt.Fprintln(w, "\n使用 vidfusion <command> -h 查看子命令的参数")
+}
+
+// sdkFlags 注册创建 SDK 时使用的通用参数
+func (c *cli) sdkFlags() {
+    c.flags.StringVar(&c.encoder, "encoder", "", "内置编码配置 x264 / x265 / vp9 / svtav1 / aom-av1 / nvenc")
+    c.flags.DurationVar(&c.timeout, "timeout", 0, "单条 ffmpeg 命令的超时时间，例如 30m，0 表示不限制")
+    c.flags.BoolVar(&c.verbose, "verbose", false, "输出每条命令的 debug 日志")
+    c.flags.BoolVar(&c.lazy, "lazy", false, "使用延迟模式，将链式步骤合并为一条 ffmpeg 命令")
+    c.flags.BoolVar(&c.dryRun, "dry-run", false, "不执行 ffmpeg，输出可执行的 shell 脚本")
+    c.flags.IntVar(&c.parallel, "parallel", 1, "同时处理片段的最大 ffmpeg 进程数")
+    c.flags.IntVar(&c.threads, "threads", 0, "每个 ffmpeg 进程的编码线程数，0 表示由 ffmpeg 决定")
+}
+
+// parse 解析参数，positional 为需要的位置参数个数，-1 表示至少一个
+// 参数可以出现在位置参数之后，例如 probe clip.mp4 --json；-- 之后的参数都作为位置参数
+func (c *cli) parse(positional int) error {
+    args := c.args
+    c.positional = nil
+    for {
+        if err := c.flags.Parse(args); err != nil {
+            return err
+        }
+        rest := c.flags.Args()
+        if len(rest) == 0 {
+            break
+        }
+        if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+            c.positional = append(c.positional, rest...)
+            break
+        }
+        c.positional = append(c.positional, rest[0])
+        args = rest[1:]
+    }
+    n := len(c.positional)
+    if (positional >= 0 && n != positional) || (positional < 0 && n == 0) {
+        c.flags.Usage()
+        return errUsage
+    }
+    return nil
+}
+
+// arg 返回第 i 个位置参数，不存在时返回空字符串
+func (c *cli) arg(i int) string {
+    if i < 0 || i >= len(c.positional) {
+        return ""
+    }
+    return c.positional[i]
+}
+
+// required 检查必填的字符串参数，nameValues 为参数名和值交替组成的列表
+func (c *cli) required(nameValues ...string) error {
+    for i := 0; i+1 < len(nameValues); i += 2 {
+        if nameValues[i+1] == "" {
+            fmt.Fprintf(c.stderr, "vidfusion %s: --%s is required\n", c.name, nameValues[i])
+            c.flags.Usage()
+            return errUsage
+        }
+    }
+    return nil
+}
+
+// newSDK 根据通用参数创建 VideoSDKV2
+func (c *cli) newSDK(ctx context.Context, input string) (*vidfusion.VideoSDKV2, error) {
+    sdk := vidfusion.NewVideoSDKV2(input).WithContext(ctx).WithTimeout(c.timeout).WithParallel(c.parallel).WithThreads(c.threads)
+    // 默认只输出警告和错误，保持 stderr 干净便于脚本调用
+    sdk.WithLogger(c.logger(slog.LevelWarn))
+    if c.encoder != "" {
+        profile, ok := vidfusion.LookupEncoderProfile(c.encoder)
+        if !ok {
+            fmt.Fprintf(c.stderr, "vidfusion %s: unknown encoder %q\n", c.name, c.encoder)
+            return nil, errUsage
+        }
+        sdk.WithEncoder(profile)
+    }
+    if c.lazy {
+        sdk.Lazy()
+    }
+    if c.dryRun {
+        sdk.DryRun()
+    }
+    return sdk, nil
+}
+
+// logger 创建输出到 stderr 的日志记录器，--verbose 时输出 debug 日志
+func (c *cli) logger(level slog.Level) *slog.Logger {
+    if c.verbose {
+        level = slog.LevelDebug
+    }
+    return slog.New(slog.NewTextHandler(c.stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// finalize 生成输出文件，预演模式下输出 shell 脚本
+func (c *cli) finalize(sdk *vidfusion.VideoSDKV2, output string) error {
+    if _, err := sdk.Finalize(output); err != nil {
+        return err
+    }
+    if c.dryRun {
+        _, err := io.WriteString(c.stdout, sdk.Plan().Shell())
+        return err
+    }
+    fmt.Fprintln(c.stdout, output)
+    return nil
+}
+
+// runRender 按配方渲染
+func runRender(ctx context.Context, c *cli) error {
+    c.sdkFlags()
+    planJSON := c.flags.Bool("plan-json", false, "与 --dry-run 一起使用，以 JSON 输出执行计划")
+    progress := c.flags.Bool("progress", false, "在 stderr 输出渲染进度")
+    output := c.flags.String("o", "", "覆盖配方中的输出文件")
+    if err := c.parse(1); err != nil {
+        return err
+    }
+    recipe, err := vidfusion.LoadRecipe(c.arg(0))
+    if err != nil {
+        return err
+    }
+    if *output != "" {
+        // 命令行指定的输出文件相对于当前目录而不是配方目录
+        if recipe.Output.File, err = filepath.Abs(*output); err != nil {
+            return err
+        }
+    }
+    sdk, err := c.newSDK(ctx, "")
+    if err != nil {
+        return err
+    }
+    if *progress {
+        sdk.OnProgress(func(p vidfusion.Progress) {
+            fmt.Fprintf(c.stderr, "\r[%d/%d] %-24s %5.1f%%  ETA %v   ", p.StepIndex, p.TotalSteps, p.Step, p.OverallPercent, p.ETA.Round(time.Second))
+        })
+    }
+    file, err := recipe.Execute(sdk)
+    if *progress {
+        fmt.Fprintln(c.stderr)
+    }
+    if err != nil {
+        return err
+    }
+    if !c.dryRun {
+        fmt.Fprintln(c.stdout, file)
+        return nil
+    }
+    if *planJSON {
+        data, err := sdk.Plan().JSON()
+        if err != nil {
+            return err
+        }
+        _, err = fmt.Fprintln(c.stdout, string(data))
+        return err
+    }
+    _, err = io.WriteString(c.stdout, sdk.Plan().Shell())
+    return err
+}
+
+// runProbe 探测媒体信息
+func runProbe(ctx context.Context, c *cli) error {
+    asJSON := c.flags.Bool("json", false, "以 JSON 输出完整的媒体信息")
+    if err := c.parse(1); err != nil {
+        return err
+    }
+    info, err := vidfusion.NewVideoSDKV2("").WithContext(ctx).Probe(c.arg(0))
+    if err != nil {
+        return err
+    }
+    if *asJSON {
+        data, err := json.MarshalIndent(info, "", "  ")
+        if err != nil {
+            return err
+        }
+        _, err = fmt.Fprintln(c.stdout, string(data))
+        return err
+    }
+    fmt.Fprintf(c.stdout, "file:     %s\n", info.Format.Filename)
+    fmt.Fprintf(c.stdout, "format:   %s\n", info.Format.FormatName)
+    fmt.Fprintf(c.stdout, "duration: %.3fs\n", info.Format.Duration)
+    fmt.Fprintf(c.stdout, "bitrate:  %d\n", info.Format.BitRate)
+    for _, stream := range info.Streams {
+        switch {
+        case stream.IsVideo():
+            fmt.Fprintf(c.stdout, "stream %d: video %s %dx%d %.3ffps %s rotation %d\n", stream.Index, stream.CodecName, stream.Width, stream.Height, stream.FrameRate, stream.PixelFormat, stream.Rotation)
+        case stream.IsAudio():
+            fmt.Fprintf(c.stdout, "stream %d: audio %s %dHz %d channels %s\n", stream.Index, stream.CodecName, stream.SampleRate, stream.Channels, stream.Language)
+        default:
+            fmt.Fprintf(c.stdout, "stream %d: %s %s\n", stream.Index, stream.CodecType, stream.CodecName)
+        }
+    }
+    return nil
+}
+
+// runConcat 合并视频
+func runConcat(ctx context.Context, c *cli) error {
+    c.sdkFlags()
+    output := c.flags.String("o", "", "输出文件")
+    width := c.flags.Int64("width", 0, "目标宽度")
+    height := c.flags.Int64("height", 0, "目标高度")
+    streamCopy := c.flags.Bool("copy", false, "与目标尺寸一致且流参数相同的视频直接流复制，其他视频按基准视频的参数重新编码")
+    if err := c.parse(-1); err != nil {
+        return err
+    }
+    if err := c.required("o", *output); err != nil {
+        return err
+    }
+    if *width <= 0 || *height <= 0 {
+        fmt.Fprintf(c.stderr, "vidfusion %s: --width and --height must be positive\n", c.name)
+        return errUsage
+    }
+    sdk, err := c.newSDK(ctx, "")
+    if err != nil {
+        return err
+    }
+    sdk.ConcatenateVideosWithOptions(c.positional, vidfusion.ConcatOptions{Width: *width, Height: *height, StreamCopy: *streamCopy})
+    return c.finalize(sdk, *output)
+}
+
+// runOverlay 添加图片覆盖
+func runOverlay(ctx context.Context, c *cli) error {
+    c.sdkFlags()
+    output := c.flags.String("o", "", "输出文件")
+    options := vidfusion.OverlayOptions{}
+    c.flags.StringVar(&options.ImageFile, "image", "", "图片文件")
+    c.flags.Int64Var(&options.XPosition, "x", 0, "图片起始的 X 坐标")
+    c.flags.Int64Var(&options.YPosition, "y", 0, "图片起始的 Y 坐标")
+    c.flags.Int64Var(&options.ImageWidth, "width", 0, "图片宽度，0 表示使用视频宽度")
+    c.flags.Int64Var(&options.ImageHeight, "height", 0, "图片高度，0 表示使用视频高度")
+    if err := c.parse(1); err != nil {
+        return err
+    }
+    if err := c.required("o", *output, "image", options.ImageFile); err != nil {
+        return err
+    }
+    sdk, err := c.newSDK(ctx, c.arg(0))
+    if err != nil {
+        return err
+    }
+    if options.ImageWidth == 0 || options.ImageHeight == 0 {
+        width, height, err := sdk.GetVideoDimensions(sdk.CurrentFile)
+        if err != nil {
+            return err
+        }
+        if options.ImageWidth == 0 {
+            options.ImageWidth = width
+        }
+        if options.ImageHeight == 0 {
+            options.ImageHeight = height
+        }
+    }
+    sdk.AddImageOverlay(options)
+    return c.finalize(sdk, *output)
+}
+
+// runSubtitle 添加字幕
+func runSubtitle(ctx context.Context, c *cli) error {
+    c.sdkFlags()
+    output := c.flags.String("o", "", "输出文件")
+    srt := c.flags.String("srt", "", "字幕文件")
+    options := vidfusion.SubtitleOptions{}
+    c.flags.Int64Var(&options.FontSize, "font-size", 16, "字号")
+    c.flags.StringVar(&options.Font, "font", "Arial", "字体")
+    c.flags.StringVar(&options.FontColor, "font-color", "00FFFFFF", "字体颜色，ASS 格式的 AABBGGRR")
+    c.flags.Int64Var(&options.XPosition, "x", 0, "左右边距")
+    c.flags.Int64Var(&options.YPosition, "y", 20, "上下边距")
+    c.flags.Int64Var(&options.Alignment, "alignment", 2, "对齐方式 1 左对齐 / 2 居中 / 3 右对齐")
+    if err := c.parse(1); err != nil {
+        return err
+    }
+    if err := c.required("o", *output, "srt", *srt); err != nil {
+        return err
+    }
+    sdk, err := c.newSDK(ctx, c.arg(0))
+    if err != nil {
+        return err
+    }
+    sdk.AddSubtitles(*srt, options)
+    return c.finalize(sdk, *output)
+}
+
+// runRandomPick 随机选择视频文件，每行输出一个路径
+func runRandomPick(ctx context.Context, c *cli) error {
+    if err := c.parse(2); err != nil {
+        return err
+    }
+    var count int
+    if _, err := fmt.Sscanf(c.arg(1), "%d", &count); err != nil || count <= 0 {
+        fmt.Fprintf(c.stderr, "vidfusion %s: count must be a positive integer, got %q\n", c.name, c.arg(1))
+        return errUsage
+    }
+    files, err := vidfusion.NewVideoSDKV2("").GetRandomVideos(c.arg(0), count)
+    if err != nil {
+        return err
+    }
+    if len(files) == 0 {
+        return fmt.Errorf("no mp4 files in %s", c.arg(0))
+    }
+    _, err = fmt.Fprintln(c.stdout, strings.Join(files, "\n"))
+    return err
+}
+
+// stringList 可以重复指定的字符串参数
+type stringList []string
+
+// String 实现 flag.Value
+func (l *stringList) String() string {
+    return strings.Join(*l, ",")
+}
+
+// Set 实现 flag.Value
+func (l *stringList) Set(value string) error {
+    *l = append(*l, value)
+    return nil
+}
+
+// runServe 启动本地 HTTP 渲染服务，Ctrl+C 时中断正在渲染的任务，下次启动时继续执行
+func runServe(ctx context.Context, c *cli) error {
+    addr := c.flags.String("addr", "127.0.0.1:8080", "监听地址")
+    dir := c.flags.String("dir", "vidfusion-jobs", "任务存储目录")
+    concurrency := c.flags.Int("concurrency", 1, "同时渲染的任务数")
+    var roots stringList
+    c.flags.Var(&roots, "asset-root", "允许配方以绝对路径引用素材的目录，可以重复指定")
+    c.flags.DurationVar(&c.timeout, "timeout", 0, "单条 ffmpeg 命令的超时时间，例如 30m，0 表示不限制")
+    c.flags.BoolVar(&c.verbose, "verbose", false, "输出每条命令的 debug 日志")
+    if err := c.parse(0); err != nil {
+        return err
+    }
+    logger := c.logger(slog.LevelInfo)
+    srv, err := server.New(server.Options{
+        Dir:         *dir,
+        Concurrency: *concurrency,
+        AssetRoots:  roots,
+        Logger:      logger,
+        NewSDK: func() *vidfusion.VideoSDKV2 {
+            return vidfusion.NewVideoSDKV2("").WithTimeout(c.timeout).WithLogger(logger)
+        },
+    })
+    if err != nil {
+        return err
+    }
+    httpServer := &http.Server{Addr: *addr, Handler: srv}
+    errc := make(chan error, 1)
+    go func() {
+        errc <- httpServer.ListenAndServe()
+    }()
+    logger.Info("listening", "addr", "http://"+*addr)
+    select {
+    case err := <-errc:
+        _ = srv.Close()
+        return err
+    case <-ctx.Done():
+    }
+    // 服务进程被中断是正常退出
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    _ = httpServer.Shutdown(shutdownCtx)
+    return srv.Close()
+}
+
+// runWatch 监控目录并渲染放入的任务，Ctrl+C 时中断正在渲染的任务，下次启动时重新渲染
+func runWatch(ctx context.Context, c *cli) error {
+    var options watch.Options
+    c.flags.StringVar(&options.DoneDir, "done", "", "成功任务的归档目录，默认为 <dir>/done")
+    c.flags.StringVar(&options.FailedDir, "failed", "", "失败任务的归档目录，默认为 <dir>/failed")
+    c.flags.DurationVar(&options.Interval, "interval", 2*time.Second, "轮询间隔")
+    c.flags.DurationVar(&options.Settle, "settle", 10*time.Second, "文件停止变化多久后开始渲染")
+    c.flags.Int64Var(&options.Folder.Width, "width", 720, "素材文件夹的输出宽度")
+    c.flags.Int64Var(&options.Folder.Height, "height", 1280, "素材文件夹的输出高度")
+    c.flags.Float64Var(&options.Folder.MusicVolume, "music-volume", 0.4, "素材文件夹的背景音乐音量")
+    c.flags.Float64Var(&options.Folder.NarrationVolume, "narration-volume", 1, "素材文件夹的解说音量")
+    c.flags.StringVar(&options.Folder.Encoder, "encoder", "", "素材文件夹使用的内置编码配置 x264 / x265 / vp9 / svtav1 / aom-av1 / nvenc")
+    c.flags.DurationVar(&c.timeout, "timeout", 0, "单条 ffmpeg 命令的超时时间，例如 30m，0 表示不限制")
+    c.flags.BoolVar(&c.verbose, "verbose", false, "输出每条命令的 debug 日志")
+    if err := c.parse(1); err != nil {
+        return err
+    }
+    if _, ok := vidfusion.LookupEncoderProfile(options.Folder.Encoder); options.Folder.Encoder != "" && !ok {
+        fmt.Fprintf(c.stderr, "vidfusion %s: unknown encoder %q\n", c.name, options.Folder.Encoder)
+        return errUsage
+    }
+    logger := c.logger(slog.LevelInfo)
+    options.Dir = c.arg(0)
+    options.Logger = logger
+    options.NewSDK = func() *vidfusion.VideoSDKV2 {
+        return vidfusion.NewVideoSDKV2("").WithTimeout(c.timeout).WithLogger(logger)
+    }
+    watcher, err := watch.New(options)
+    if err != nil {
+        return err
+    }
+    // 守护进程被中断是正常退出
+    watcher.Run(ctx)
+    return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// runCLI 执行命令行并返回退出码和输出
+func runCLI(args ...string) (int, string, string) {
+    var stdout, stderr bytes.Buffer
+    code := run(context.Background(), args, &stdout, &stderr)
+    return code, stdout.String(), stderr.String()
+}
+
+// Test_run_Usage 测试参数错误时返回退出码 2
+func Test_run_Usage(t *testing.T) {
+    for _, args := range [][]string{
+        nil,
+        {"unknown"},
+        {"render"},
+        {"concat", "1.mp4", "2.mp4"},
+        {"overlay", "-o", "out.mp4", "in.mp4"},
+        {"random-pick", ".", "zero"},
+        {"concat", "--encoder", "h263", "-o", "out.mp4", "1.mp4", "2.mp4"},
+        {"probe", "1.mp4", "--json", "2.mp4"},
+    } {
+        code, _, stderr := runCLI(args...)
+        if code != exitUsage {
+            t.Errorf("%v should exit with %d, but got %d", args, exitUsage, code)
+        }
+        if !strings.Contains(stderr, "usage") && !strings.Contains(stderr, "vidfusion") {
+            t.Errorf("%v should print usage, but got %q", args, stderr)
+        }
+    }
+    if code, _, _ := runCLI("help"); code != exitOK {
+        t.Errorf("help should exit with %d, but got %d", exitOK, code)
+    }
+}
+
+// Test_runRandomPick 测试随机选择视频文件
+func Test_runRandomPick(t *testing.T) {
+    dir := t.TempDir()
+    for _, name := range []string{"1.mp4", "2.mp4", "3.mp4", "cover.png"} {
+        if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    code, stdout, stderr := runCLI("random-pick", dir, "2")
+    if code != exitOK {
+        t.Fatalf("random-pick should succeed, but got %d: %s", code, stderr)
+    }
+    files := strings.Fields(stdout)
+    if len(files) != 2 {
+        t.Fatalf("random-pick should print 2 files, but got %q", stdout)
+    }
+    for _, file := range files {
+        if !strings.HasSuffix(file, ".mp4") {
+            t.Errorf("random-pick should only pick mp4 files, but got %s", file)
+        }
+    }
+    if code, _, _ := runCLI("random-pick", t.TempDir(), "1"); code != exitFailure {
+        t.Errorf("random-pick in an empty dir should exit with %d, but got %d", exitFailure, code)
+    }
+}
+
+// Test_runRender_DryRun 测试预演渲染配方并输出 shell 脚本
+func Test_runRender_DryRun(t *testing.T) {
+    dir := t.TempDir()
+    recipe := filepath.Join(dir, "job.yaml")
+    data := "input: in.mp4\ntrim:\n  start: 1\n  end: 3\noutput:\n  file: out/final.mp4\n"
+    if err := os.WriteFile(recipe, []byte(data), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    code, stdout, stderr := runCLI("render", "--dry-run", "--encoder", "x265", recipe)
+    if code != exitOK {
+        t.Fatalf("render --dry-run should succeed, but got %d: %s", code, stderr)
+    }
+    for _, want := range []string{
+        "ffmpeg -y -i " + filepath.Join(dir, "in.mp4") + " -ss 1.00 -to 3.00 -c:v libx265",
+        "cp \"$WORKDIR\"/tmp1.mp4 " + filepath.Join(dir, "out", "final.mp4"),
+    } {
+        if !strings.Contains(stdout, want) {
+            t.Errorf("shell script should contain %q:\n%s", want, stdout)
+        }
+    }
+
+    // 参数可以放在位置参数之后
+    code, after, stderr := runCLI("render", recipe, "--dry-run", "--encoder", "x265")
+    if code != exitOK || after != stdout {
+        t.Errorf("flags after the recipe should be parsed, but got %d: %s%s", code, after, stderr)
+    }
+
+    code, stdout, stderr = runCLI("render", "--dry-run", "--plan-json", recipe)
+    if code != exitOK || !strings.Contains(stdout, `"CropVideoTimeline"`) {
+        t.Errorf("render --plan-json should print the JSON plan, but got %d: %s%s", code, stdout, stderr)
+    }
+
+    if code, _, _ := runCLI("render", filepath.Join(dir, "missing.yaml")); code != exitFailure {
+        t.Errorf("render with a missing recipe should exit with %d, but got %d", exitFailure, code)
+    }
+}
+
+// Test_run_Interrupted 测试被中断时返回退出码 130
+func Test_run_Interrupted(t *testing.T) {
+    dir := t.TempDir()
+    recipe := filepath.Join(dir, "job.json")
+    if err := os.WriteFile(recipe, []byte(`{"input": "in.mp4", "mute": true, "output": {"file": "out.mp4"}}`), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    var stdout, stderr bytes.Buffer
+    if code := run(ctx, []string{"render", recipe}, &stdout, &stderr); code != exitInterrupted {
+        t.Errorf("canceled render should exit with %d, but got %d: %s", exitInterrupted, code, stderr.String())
+    }
+}
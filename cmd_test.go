@@ -1,6 +1,12 @@
 package vidfusion
 
-import "testing"
+import (
+    "context"
+    "errors"
+    "runtime"
+    "testing"
+    "time"
+)
 
 // Test_runCommand 测试 runCommand 函数
 func Test_runCommand(t *testing.T) {
@@ -32,3 +38,25 @@ func Benchmark_runCommandAndExtractFloat(b *testing.B) {
         _, _ = runCommandAndExtractFloat("ffmpeg", "-version")
     }
 }
+
+// Test_commandContext 测试 ctx 超时后终止整个进程树
+func Test_commandContext(t *testing.T) {
+    if runtime.GOOS == "windows" {
+        t.Skip("sh is not available on windows")
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    // 子进程持有输出管道，只终止 sh 本身会一直阻塞到 sleep 结束
+    cmd := commandContext(ctx, "sh", "-c", "sleep 10 & sleep 10; wait")
+    _, err := cmd.CombinedOutput()
+    if err == nil {
+        t.Fatal("command should be killed by the context")
+    }
+    if elapsed := time.Since(start); elapsed > 3*time.Second {
+        t.Errorf("process tree should be killed promptly, but took %v", elapsed)
+    }
+    if !errors.Is(contextError(ctx, err), context.DeadlineExceeded) {
+        t.Errorf("contextError should return the context error, but got %v", contextError(ctx, err))
+    }
+}
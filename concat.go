@@ -0,0 +1,448 @@
+package vidfusion
+
+import (
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "math"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// ConcatOptions 合并视频选项
+type ConcatOptions struct {
+    Width       int64         // 输出宽度
+    Height      int64         // 输出高度
+    Transition  *Transition   // 所有衔接处默认使用的转场，为空表示硬切
+    Transitions []*Transition // 按衔接处覆盖默认转场，第 i 项为第 i 个和第 i+1 个视频之间的转场，为空的项使用默认转场
+    Ranges      []ConcatRange // 按视频指定使用的时间范围，为空或缺少的项使用整个视频
+    StreamCopy  bool          // 所有衔接处都是硬切时，与目标尺寸一致且流参数相同的视频不重新编码，直接以 -c copy 合并，其他视频按基准视频的流参数重新编码
+    FrameRate   float64       // 统一的恒定帧率，0 表示 30
+    PixelFormat string        // 统一的像素格式，为空时使用编码配置的像素格式，编码配置也未设置时使用 yuv420p
+    SampleRate  int64         // 统一的音频采样率，0 表示 44100，音频统一为双声道
+}
+
+// concatFormat 合并前统一的视频和音频参数
+type concatFormat struct {
+    frameRate   string
+    pixelFormat string
+    sampleRate  int64
+}
+
+// concatFormat 返回合并前统一的参数，未设置的项使用默认值
+func (e *executor) concatFormat(options ConcatOptions) concatFormat {
+    format := concatFormat{frameRate: "30", pixelFormat: options.PixelFormat, sampleRate: options.SampleRate}
+    if options.FrameRate > 0 {
+        format.frameRate = frameRateExpr(options.FrameRate)
+    }
+    if format.pixelFormat == "" {
+        format.pixelFormat = e.encoderProfile().PixelFormat
+    }
+    if format.pixelFormat == "" {
+        format.pixelFormat = "yuv420p"
+    }
+    if format.sampleRate == 0 {
+        format.sampleRate = 44100
+    }
+    return format
+}
+
+// normalizeFilter 返回等比缩放并填充到 width x height，统一像素宽高比、帧率和像素格式的滤镜
+func normalizeFilter(width, height int64, sampleAspect, frameRate, pixelFormat string) string {
+    return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=%s,fps=%s,format=%s",
+        width, height, width, height, sampleAspect, frameRate, pixelFormat)
+}
+
+// scaledArgs 返回将视频统一为 width x height 和 format 的参数后输出到 outputFile 的 ffmpeg 参数，没有音轨的视频补充静音音轨
+func (e *executor) scaledArgs(video string, r ConcatRange, withAudio bool, width, height int64, format concatFormat, outputFile string) []string {
+    args := []string{"-i", video}
+    if !withAudio {
+        args = append(args, "-f", "lavfi", "-i", fmt.Sprintf("anullsrc=r=%d:cl=stereo", format.sampleRate))
+    }
+    args = append(args, r.args()...)
+    args = append(args, "-vf", normalizeFilter(width, height, "1", format.frameRate, format.pixelFormat), "-map", "0:v:0")
+    args = append(args, e.videoArgs()...)
+    if withAudio {
+        args = append(args, "-map", "0:a:0")
+    } else {
+        args = append(args, "-map", "1:a:0", "-shortest")
+    }
+    return append(args, "-c:a", "aac", "-ar", strconv.FormatInt(format.sampleRate, 10), "-ac", "2", outputFile)
+}
+
+// ConcatRange 合并时使用视频的时间范围
+// 流复制合并时从 In 之前最近的关键帧开始，实际使用的范围可能略大
+type ConcatRange struct {
+    In  float64 `json:"in,omitempty" yaml:"in,omitempty"`   // 开始时间（秒）
+    Out float64 `json:"out,omitempty" yaml:"out,omitempty"` // 结束时间（秒），0 表示到视频结尾
+}
+
+// Validate 校验时间范围
+func (r ConcatRange) Validate() error {
+    if r.In < 0 || r.Out < 0 {
+        return fmt.Errorf("in and out should not be negative")
+    }
+    if r.Out > 0 && r.Out <= r.In {
+        return fmt.Errorf("out (%.2f) should be greater than in (%.2f)", r.Out, r.In)
+    }
+    return nil
+}
+
+// args 返回裁剪时间范围的 ffmpeg 参数，使用整个视频时为空
+func (r ConcatRange) args() []string {
+    var args []string
+    if r.In > 0 {
+        args = append(args, "-ss", fmt.Sprintf("%.3f", r.In))
+    }
+    if r.Out > 0 {
+        args = append(args, "-to", fmt.Sprintf("%.3f", r.Out))
+    }
+    return args
+}
+
+// length 返回时长为 duration 的视频在时间范围内的时长
+func (r ConcatRange) length(duration float64) float64 {
+    if r.Out > 0 && r.Out < duration {
+        duration = r.Out
+    }
+    return math.Max(duration-r.In, 0)
+}
+
+// rangeAt 返回第 i 个视频的时间范围
+func rangeAt(ranges []ConcatRange, i int) ConcatRange {
+    if i < len(ranges) {
+        return ranges[i]
+    }
+    return ConcatRange{}
+}
+
+// boundaries 返回每个衔接处实际使用的转场
+func (o ConcatOptions) boundaries(videos int) ([]*Transition, error) {
+    if len(o.Transitions) > videos-1 && videos > 0 {
+        return nil, fmt.Errorf("%d transitions for %d videos", len(o.Transitions), videos)
+    }
+    if len(o.Ranges) > videos {
+        return nil, fmt.Errorf("%d ranges for %d videos", len(o.Ranges), videos)
+    }
+    var errs []error
+    if o.FrameRate < 0 || o.SampleRate < 0 {
+        errs = append(errs, fmt.Errorf("frame rate and sample rate should not be negative"))
+    }
+    if err := o.Transition.Validate(); err != nil {
+        errs = append(errs, err)
+    }
+    for i, r := range o.Ranges {
+        if err := r.Validate(); err != nil {
+            errs = append(errs, fmt.Errorf("ranges[%d]: %w", i, err))
+        }
+    }
+    transitions := make([]*Transition, max(videos-1, 0))
+    for i := range transitions {
+        transitions[i] = o.Transition
+        if i < len(o.Transitions) && o.Transitions[i] != nil {
+            if err := o.Transitions[i].Validate(); err != nil {
+                errs = append(errs, fmt.Errorf("transitions[%d]: %w", i, err))
+            }
+            transitions[i] = o.Transitions[i]
+        }
+    }
+    return transitions, errors.Join(errs...)
+}
+
+// ConcatenateVideosWithOptions 按选项合并多个视频
+// 所有衔接处都是硬切时与 ConcatenateVideos 相同；设置了转场时所有视频在一条命令中缩放并通过 xfade / acrossfade 合并，
+// 总时长为所有视频时长之和减去转场重叠的时长
+func (sdk *VideoSDKV2) ConcatenateVideosWithOptions(videoList []string, options ConcatOptions) *VideoSDKV2 {
+    if sdk.err != nil {
+        return sdk
+    }
+    transitions, err := options.boundaries(len(videoList))
+    if err != nil {
+        sdk.fail("ConcatenateVideos", err)
+        return sdk
+    }
+    videoList = sdk.flushInputs(videoList)
+    if sdk.err != nil {
+        return sdk
+    }
+    hasTransition := false
+    for _, transition := range transitions {
+        hasTransition = hasTransition || transition.overlap() > 0
+    }
+    switch {
+    case hasTransition:
+        return sdk.concatTransitions(videoList, options, transitions)
+    case options.StreamCopy:
+        return sdk.concatCopy(videoList, options)
+    }
+    return sdk.concatScaled(videoList, options)
+}
+
+// streamSignature 流复制合并时必须一致的流参数，profile、level 和 codec tag 不同的视频拼接后解码参数会不一致
+type streamSignature struct {
+    codec        string
+    profile      string
+    level        int64
+    codecTag     string
+    width        int64
+    height       int64
+    pixelFormat  string
+    sampleAspect string
+    frameRate    string
+    rotation     int64
+    audioCodec   string
+    audioProfile string
+    sampleRate   int64
+    channels     int64
+}
+
+// signatureOf 返回媒体信息的流参数，没有视频流时返回 false
+func signatureOf(info *MediaInfo) (streamSignature, bool) {
+    video := info.VideoStream()
+    if video == nil {
+        return streamSignature{}, false
+    }
+    signature := streamSignature{
+        codec:        video.CodecName,
+        profile:      video.Profile,
+        level:        video.Level,
+        codecTag:     video.CodecTag,
+        width:        video.Width,
+        height:       video.Height,
+        pixelFormat:  video.PixelFormat,
+        sampleAspect: video.SampleAspect,
+        frameRate:    frameRateExpr(video.FrameRate),
+        rotation:     video.Rotation,
+    }
+    // 未标记像素宽高比的视频按方形像素处理
+    if signature.sampleAspect == "" || signature.sampleAspect == "0:1" {
+        signature.sampleAspect = "1:1"
+    }
+    if audio := info.AudioStream(); audio != nil {
+        signature.audioCodec = audio.CodecName
+        signature.audioProfile = audio.Profile
+        signature.sampleRate = audio.SampleRate
+        signature.channels = audio.Channels
+    }
+    return signature, true
+}
+
+// frameRateExpr 返回 fps 滤镜使用的帧率，NTSC 帧率使用分数形式以保持与原视频相同的时间基
+func frameRateExpr(rate float64) string {
+    if ntsc := math.Round(rate * 1.001); rate != math.Round(rate) && math.Abs(rate*1.001-ntsc) < 0.001 {
+        return fmt.Sprintf("%.0f000/1001", ntsc)
+    }
+    if rate == math.Round(rate) {
+        return fmt.Sprintf("%.0f", rate)
+    }
+    return fmt.Sprintf("%.3f", rate)
+}
+
+// audioEncoders 音频编码格式对应的编码器，用于将不一致的视频的音频转换为与其他视频相同的格式
+var audioEncoders = map[string]string{
+    "aac":       "aac",
+    "mp3":       "libmp3lame",
+    "opus":      "libopus",
+    "ac3":       "ac3",
+    "flac":      "flac",
+    "pcm_s16le": "pcm_s16le",
+}
+
+// encoderProfileNames ffprobe 输出的 profile 对应的 -profile:v 参数，不在表中的 profile 无法用编码器重新生成
+var encoderProfileNames = map[string]map[string]string{
+    "h264": {"Constrained Baseline": "baseline", "Main": "main", "High": "high", "High 10": "high10", "High 4:2:2": "high422", "High 4:4:4 Predictive": "high444"},
+    "hevc": {"Main": "main", "Main 10": "main10"},
+}
+
+// concatCopy 以第一个与目标尺寸一致的视频为基准，流参数相同的视频直接以 -c copy 合并，其他视频先按基准的流参数重新编码
+// 重新编码时使用与基准相同的 profile、level 和编码标签；没有可作为基准的视频，或编码配置无法输出与基准相同的格式时，退回到全部重新编码合并
+func (sdk *VideoSDKV2) concatCopy(videoList []string, options ConcatOptions) *VideoSDKV2 {
+    width, height, ranges := options.Width, options.Height, options.Ranges
+    signatures := make([]streamSignature, len(videoList))
+    durations := make([]float64, len(videoList))
+    reference := -1
+    for i, video := range videoList {
+        info, err := sdk.Probe(video)
+        if err != nil {
+            sdk.fail("ConcatenateVideos", err)
+            return sdk
+        }
+        signature, ok := signatureOf(info)
+        if !ok {
+            sdk.fail("ConcatenateVideos", fmt.Errorf("%s has no video stream", video))
+            return sdk
+        }
+        signatures[i], durations[i] = signature, rangeAt(ranges, i).length(info.Format.Duration)
+        if reference < 0 && signature.width == width && signature.height == height && signature.rotation == 0 {
+            reference = i
+        }
+    }
+    var mismatched []int
+    for i, signature := range signatures {
+        if reference < 0 || signature != signatures[reference] {
+            mismatched = append(mismatched, i)
+        }
+    }
+    if reason := sdk.copyUnsupported(reference, signatures, len(mismatched)); reason != "" {
+        sdk.log().Info("stream copy unavailable, re-encoding all videos", "reason", reason)
+        return sdk.concatScaled(videoList, options)
+    }
+    want := signatures[reference]
+    sdk.log().Debug("stream copy concat", "reference", videoList[reference], "normalize", len(mismatched))
+    defer sdk.trackStep("ConcatenateVideos", len(mismatched)+1)()
+
+    tempFile, err := ioutil.TempFile("", "videos_*.txt")
+    if err != nil {
+        sdk.fail("ConcatenateVideos", fmt.Errorf("failed to create temp file: %v", err))
+        return sdk
+    }
+    defer os.Remove(tempFile.Name())
+    defer tempFile.Close()
+    sdk.planTemp(tempFile.Name())
+    tempDir, err := ioutil.TempDir("", "normalized_videos")
+    if err != nil {
+        sdk.fail("ConcatenateVideos", fmt.Errorf("failed to create temp dir: %v", err))
+        return sdk
+    }
+    defer os.RemoveAll(tempDir)
+
+    var list strings.Builder
+    var totalDuration float64
+    for i, video := range videoList {
+        totalDuration += durations[i]
+        r := rangeAt(ranges, i)
+        if signatures[i] == want {
+            // 流复制时由 concat demuxer 裁剪，从入点之前最近的关键帧开始；列表中的相对路径以列表文件所在目录为基准
+            if abs, err := filepath.Abs(video); err == nil {
+                video = abs
+            }
+            fmt.Fprintf(&list, "file '%s'\n", video)
+            if r.In > 0 {
+                fmt.Fprintf(&list, "inpoint %.3f\n", r.In)
+            }
+            if r.Out > 0 {
+                fmt.Fprintf(&list, "outpoint %.3f\n", r.Out)
+            }
+            continue
+        }
+        normalized := filepath.Join(tempDir, fmt.Sprintf("%d_%s", i, filepath.Base(video)))
+        sdk.planTemp(normalized)
+        duration := durations[i]
+        if err := sdk.runFFmpeg("ConcatenateVideos", func(float64) float64 { return duration }, sdk.normalizeArgs(video, r, signatures[i], want, normalized)...); err != nil {
+            sdk.fail("ConcatenateVideos", err)
+            return sdk
+        }
+        fmt.Fprintf(&list, "file '%s'\n", normalized)
+    }
+    if _, err := tempFile.WriteString(list.String()); err != nil {
+        sdk.fail("ConcatenateVideos", fmt.Errorf("failed to write to temp file: %v", err))
+        return sdk
+    }
+
+    duration := func(float64) float64 {
+        return totalDuration
+    }
+    return sdk.runStepDuration("ConcatenateVideos", duration, func(outputFile string) []string {
+        return []string{"-f", "concat", "-safe", "0", "-i", tempFile.Name(), "-c", "copy", outputFile}
+    })
+}
+
+// copyUnsupported 返回无法流复制合并的原因，可以流复制时返回空字符串
+func (sdk *VideoSDKV2) copyUnsupported(reference int, signatures []streamSignature, mismatched int) string {
+    if reference < 0 {
+        return "no video matches the target size"
+    }
+    if mismatched == 0 {
+        return ""
+    }
+    want := signatures[reference]
+    if _, reason := sdk.matchingEncoder(want); reason != "" {
+        return reason
+    }
+    if want.audioCodec != "" && audioEncoders[want.audioCodec] == "" {
+        return fmt.Sprintf("unsupported audio codec %s", want.audioCodec)
+    }
+    // aac 编码器只能输出 LC profile
+    if want.audioCodec == "aac" && want.audioProfile != "" && want.audioProfile != "LC" {
+        return fmt.Sprintf("unsupported audio profile %s", want.audioProfile)
+    }
+    return ""
+}
+
+// matchingEncoder 返回输出与基准视频相同编码格式、profile、level 和编码标签的编码配置，无法输出时返回原因
+func (sdk *VideoSDKV2) matchingEncoder(want streamSignature) (EncoderProfile, string) {
+    profile := sdk.encoderProfile()
+    if codec := profile.codecName(); codec != want.codec {
+        return profile, fmt.Sprintf("encoder %s cannot produce %s", profile.Codec, want.codec)
+    }
+    if profile.PixelFormat != "" && profile.PixelFormat != want.pixelFormat {
+        return profile, fmt.Sprintf("encoder pixel format %s differs from %s", profile.PixelFormat, want.pixelFormat)
+    }
+    profile.PixelFormat = want.pixelFormat
+    if want.profile != "" {
+        name := encoderProfileNames[want.codec][want.profile]
+        if name == "" {
+            return profile, fmt.Sprintf("encoder %s cannot produce %s profile %s", profile.Codec, want.codec, want.profile)
+        }
+        profile.Profile = name
+    }
+    // ffprobe 输出的 H.264 level 是 level 乘以 10，HEVC 是乘以 30，未知时为负数
+    profile.Level = ""
+    if want.level > 0 {
+        switch want.codec {
+        case "h264":
+            profile.Level = fmt.Sprintf("%d.%d", want.level/10, want.level%10)
+        case "hevc":
+            profile.Level = fmt.Sprintf("%.1f", float64(want.level)/30)
+        }
+    }
+    // 编码配置中已有的编码标签以基准视频为准
+    var extra []string
+    for i := 0; i < len(profile.ExtraArgs); i++ {
+        if profile.ExtraArgs[i] == "-tag:v" && i+1 < len(profile.ExtraArgs) {
+            i++
+            continue
+        }
+        extra = append(extra, profile.ExtraArgs[i])
+    }
+    if want.codecTag != "" && !strings.HasPrefix(want.codecTag, "[") {
+        extra = append(extra, "-tag:v", want.codecTag)
+    }
+    profile.ExtraArgs = extra
+    return profile, ""
+}
+
+// normalizeArgs 返回将视频转换为与基准视频相同流参数的 ffmpeg 参数
+// 基准视频有音轨而该视频没有时补充静音音轨
+func (sdk *VideoSDKV2) normalizeArgs(video string, r ConcatRange, have, want streamSignature, outputFile string) []string {
+    args := []string{"-i", video}
+    silence := want.audioCodec != "" && have.audioCodec == ""
+    if silence {
+        layout := "stereo"
+        if want.channels == 1 {
+            layout = "mono"
+        }
+        args = append(args, "-f", "lavfi", "-i", fmt.Sprintf("anullsrc=r=%d:cl=%s", want.sampleRate, layout))
+    }
+    args = append(args, r.args()...)
+    filter := normalizeFilter(want.width, want.height, strings.Replace(want.sampleAspect, ":", "/", 1), want.frameRate, want.pixelFormat)
+    args = append(args, "-vf", filter, "-map", "0:v:0")
+    encoder, _ := sdk.matchingEncoder(want)
+    executor := sdk.executor
+    executor.encoder = &encoder
+    args = append(args, executor.videoArgs()...)
+    switch {
+    case want.audioCodec == "":
+        args = append(args, "-an")
+    case silence:
+        args = append(args, "-map", "1:a:0", "-shortest")
+    default:
+        args = append(args, "-map", "0:a:0")
+    }
+    if want.audioCodec != "" {
+        args = append(args, "-c:a", audioEncoders[want.audioCodec], "-ar", fmt.Sprint(want.sampleRate), "-ac", fmt.Sprint(want.channels))
+    }
+    return append(args, outputFile)
+}
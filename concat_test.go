@@ -0,0 +1,189 @@
+package vidfusion
+
+import (
+    "context"
+    "os"
+    "strings"
+    "testing"
+)
+
+// listRunner 在 FakeRunner 的基础上记录 concat 列表的内容
+type listRunner struct {
+    *FakeRunner
+    list string
+}
+
+// Run 执行 concat 命令前读取列表文件
+func (r *listRunner) Run(ctx context.Context, cmd *Command) error {
+    for i, arg := range cmd.Args {
+        if arg == "concat" && i+4 < len(cmd.Args) {
+            data, _ := os.ReadFile(cmd.Args[i+4])
+            r.list = string(data)
+        }
+    }
+    return r.FakeRunner.Run(ctx, cmd)
+}
+
+// Test_frameRateExpr 测试帧率表达式
+func Test_frameRateExpr(t *testing.T) {
+    for rate, want := range map[float64]string{30: "30", 30000.0 / 1001: "30000/1001", 24000.0 / 1001: "24000/1001", 25: "25", 12.5: "12.500"} {
+        if got := frameRateExpr(rate); got != want {
+            t.Errorf("frameRateExpr(%v) should be %s, but got %s", rate, want, got)
+        }
+    }
+}
+
+// TestConcatenateVideosWithOptions_StreamCopy 测试流参数相同的视频直接流复制，只按基准的 profile、level 和编码标签重新编码不一致的视频
+func TestConcatenateVideosWithOptions_StreamCopy(t *testing.T) {
+    upright := strings.Replace(probeJSON, `"rotation": -90`, `"rotation": 0`, 1)
+    tagged := strings.Replace(upright, `"profile": "High",`, `"profile": "High", "level": 40, "codec_tag_string": "avc1",`, 1)
+    small := strings.Replace(strings.Replace(tagged, `"width": 1920, "height": 1080`, `"width": 1280, "height": 720`, 1), `"codec_type": "audio"`, `"codec_type": "data"`, 1)
+    runner := &listRunner{FakeRunner: NewFakeRunner().On("ffprobe", "c.mp4", small).On("ffprobe", "d.mp4", strings.Replace(tagged, `"level": 40`, `"level": 31`, 1)).On("ffprobe", "-show_streams", tagged)}
+    sdk := NewVideoSDKV2("").WithRunner(runner).WithEncoder(X264Profile)
+    sdk.ConcatenateVideosWithOptions([]string{"/videos/a.mp4", "/videos/b.mp4", "/videos/c.mp4", "/videos/d.mp4"}, ConcatOptions{
+        Width:      1920,
+        Height:     1080,
+        StreamCopy: true,
+        Ranges:     []ConcatRange{{In: 2, Out: 8}, {}, {Out: 5}},
+    })
+    if sdk.Err() != nil {
+        t.Fatalf("ConcatenateVideosWithOptions error: %v", sdk.Err())
+    }
+    var ffmpeg []string
+    for _, line := range runner.CommandLines() {
+        if strings.HasPrefix(line, "ffmpeg ") {
+            ffmpeg = append(ffmpeg, line)
+        }
+    }
+    if len(ffmpeg) != 3 {
+        t.Fatalf("only the mismatching videos should be normalized, but got:\n%s", strings.Join(ffmpeg, "\n"))
+    }
+    encoder := "-c:v libx264 -preset medium -crf 23 -pix_fmt yuv420p -profile:v high -level 4.0 -tag:v avc1 "
+    for _, want := range []string{
+        "-i /videos/c.mp4 -f lavfi -i anullsrc=r=48000:cl=stereo -to 5.000 ",
+        "-vf scale=1920:1080:force_original_aspect_ratio=decrease,pad=1920:1080:(ow-iw)/2:(oh-ih)/2,setsar=1/1,fps=30000/1001,format=yuv420p -map 0:v:0 " + encoder,
+        "-map 1:a:0 -shortest -c:a aac -ar 48000 -ac 2 ",
+    } {
+        if !strings.Contains(ffmpeg[0], want) {
+            t.Errorf("normalize command should contain %q:\n%s", want, ffmpeg[0])
+        }
+    }
+    if !strings.Contains(ffmpeg[1], "-i /videos/d.mp4 ") || !strings.Contains(ffmpeg[1], encoder) {
+        t.Errorf("video with a different level should be re-encoded with %q, but got %s", encoder, ffmpeg[1])
+    }
+    if !strings.Contains(ffmpeg[2], "-f concat -safe 0 -i ") || !strings.Contains(ffmpeg[2], " -c copy ") {
+        t.Errorf("videos should be concatenated with -c copy, but got %s", ffmpeg[2])
+    }
+    lines := strings.Split(strings.TrimSpace(runner.list), "\n")
+    if len(lines) != 6 || lines[0] != "file '/videos/a.mp4'" || lines[1] != "inpoint 2.000" || lines[2] != "outpoint 8.000" || lines[3] != "file '/videos/b.mp4'" ||
+        !strings.HasSuffix(lines[4], "2_c.mp4'") || !strings.HasSuffix(lines[5], "3_d.mp4'") {
+        t.Errorf("unexpected concat list:\n%s", runner.list)
+    }
+}
+
+// Test_matchingEncoder 测试重新编码时使用基准视频的 profile、level 和编码标签
+func Test_matchingEncoder(t *testing.T) {
+    hevc := streamSignature{codec: "hevc", profile: "Main 10", level: 123, codecTag: "hev1", pixelFormat: "yuv420p10le"}
+    sdk := NewVideoSDKV2("").WithEncoder(EncoderProfile{Codec: Libx265, Preset: "fast", ExtraArgs: []string{"-tag:v", "hvc1", "-x265-params", "log-level=error"}})
+    encoder, reason := sdk.matchingEncoder(hevc)
+    want := "-c:v libx265 -preset fast -pix_fmt yuv420p10le -profile:v main10 -x265-params level-idc=4.1 -x265-params log-level=error -tag:v hev1"
+    if got := strings.Join(encoder.Args(), " "); reason != "" || got != want {
+        t.Errorf("matching encoder args should be %q, but got %q %s", want, got, reason)
+    }
+    for signature, want := range map[streamSignature]string{
+        {codec: "vp9", pixelFormat: "yuv420p"}:                         "encoder libx265 cannot produce vp9",
+        {codec: "hevc", profile: "Rext", pixelFormat: "yuv444p"}:       "encoder libx265 cannot produce hevc profile Rext",
+        {codec: "hevc", profile: "Main", pixelFormat: "yuv420p"}:       "",
+        {codec: "hevc", codecTag: "[0][0][0][0]", pixelFormat: "nv12"}: "",
+    } {
+        encoder, reason := sdk.matchingEncoder(signature)
+        if reason != want || (reason == "" && strings.Contains(strings.Join(encoder.Args(), " "), "-tag:v")) {
+            t.Errorf("%+v: reason should be %q, but got %q %v", signature, want, reason, encoder.Args())
+        }
+    }
+}
+
+// TestConcatenateVideosWithOptions_StreamCopyFallback 测试无法流复制时退回到全部重新编码
+func TestConcatenateVideosWithOptions_StreamCopyFallback(t *testing.T) {
+    upright := strings.Replace(probeJSON, `"rotation": -90`, `"rotation": 0`, 1)
+    for name, c := range map[string]struct {
+        encoder       EncoderProfile
+        width, height int64
+        other         string
+    }{
+        "no reference":        {X264Profile, 720, 1280, upright},
+        "encoder differs":     {X265Profile, 1920, 1080, probeJSON},
+        "unsupported profile": {X264Profile, 1920, 1080, strings.Replace(upright, `"profile": "High"`, `"profile": "Extended"`, 1)},
+        "unsupported audio":   {X264Profile, 1920, 1080, strings.Replace(upright, `"profile": "LC"`, `"profile": "HE-AAC"`, 1)},
+    } {
+        // 基准视频 a.mp4 使用 other 的流参数，b.mp4 旋转后与基准不一致需要重新编码
+        runner := NewFakeRunner().On("ffprobe", "b.mp4", probeJSON).On("ffprobe", "-show_streams", c.other)
+        sdk := NewVideoSDKV2("").WithRunner(runner).WithEncoder(c.encoder)
+        sdk.ConcatenateVideosWithOptions([]string{"a.mp4", "b.mp4"}, ConcatOptions{Width: c.width, Height: c.height, StreamCopy: true})
+        if sdk.Err() != nil {
+            t.Fatalf("%s: ConcatenateVideosWithOptions error: %v", name, sdk.Err())
+        }
+        lines := strings.Join(runner.CommandLines(), "\n")
+        if strings.Count(lines, "setsar=1,fps=30,format=yuv420p") != 2 {
+            t.Errorf("%s: all videos should be re-encoded, but got:\n%s", name, lines)
+        }
+    }
+
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", upright)
+    sdk := NewVideoSDKV2("").WithRunner(runner)
+    sdk.ConcatenateVideosWithOptions([]string{"a.mp4", "b.mp4"}, ConcatOptions{Width: 1920, Height: 1080, StreamCopy: true})
+    if lines := runner.CommandLines(); sdk.Err() != nil || len(lines) != 3 || !strings.Contains(lines[2], " -c copy ") {
+        t.Errorf("identical videos should be copied in a single command, but got %v: %v", sdk.Err(), lines)
+    }
+
+    sdk = NewVideoSDKV2("").WithRunner(NewFakeRunner())
+    sdk.ConcatenateVideosWithOptions([]string{"a.mp4", "b.mp4"}, ConcatOptions{Width: 1920, Height: 1080, Ranges: []ConcatRange{{In: 5, Out: 3}}})
+    if err := sdk.Err(); err == nil || !strings.Contains(err.Error(), "ranges[0]: out (3.00) should be greater than in (5.00)") {
+        t.Errorf("invalid range should fail, but got %v", err)
+    }
+}
+
+// TestConcatenateVideosWithOptions_Normalize 测试合并前统一尺寸、帧率、像素格式和音频，没有音轨的视频补充静音
+func TestConcatenateVideosWithOptions_Normalize(t *testing.T) {
+    silent := strings.Replace(probeJSON, `"codec_type": "audio"`, `"codec_type": "data"`, 1)
+    options := ConcatOptions{Width: 720, Height: 1280, FrameRate: 25, PixelFormat: "yuv422p", SampleRate: 48000}
+    runner := NewFakeRunner().On("ffprobe", "silent.mp4", silent).On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("").WithRunner(runner)
+    sdk.ConcatenateVideosWithOptions([]string{"a.mp4", "silent.mp4"}, options)
+    if sdk.Err() != nil {
+        t.Fatalf("ConcatenateVideosWithOptions error: %v", sdk.Err())
+    }
+    lines := strings.Join(runner.CommandLines(), "\n")
+    filter := "-vf scale=720:1280:force_original_aspect_ratio=decrease,pad=720:1280:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=25,format=yuv422p -map 0:v:0 -c:v libx264 "
+    for _, want := range []string{
+        "-i a.mp4 " + filter + "-map 0:a:0 -c:a aac -ar 48000 -ac 2 ",
+        "-i silent.mp4 -f lavfi -i anullsrc=r=48000:cl=stereo " + filter + "-map 1:a:0 -shortest -c:a aac -ar 48000 -ac 2 ",
+        "-f concat -safe 0 -i ",
+    } {
+        if !strings.Contains(lines, want) {
+            t.Errorf("commands should contain %q:\n%s", want, lines)
+        }
+    }
+    if strings.Contains(lines, "-f concat -safe 0 -i ") && !strings.Contains(lines, " -c copy ") {
+        t.Errorf("normalized videos should be concatenated without re-encoding:\n%s", lines)
+    }
+
+    runner = NewFakeRunner().On("ffprobe", "silent.mp4", silent).On("ffprobe", "-show_streams", probeJSON)
+    sdk = NewVideoSDKV2("").WithRunner(runner)
+    options.Transition = &Transition{Duration: 1}
+    sdk.ConcatenateVideosWithOptions([]string{"a.mp4", "silent.mp4"}, options)
+    if sdk.Err() != nil {
+        t.Fatalf("ConcatenateVideosWithOptions error: %v", sdk.Err())
+    }
+    lines = strings.Join(runner.CommandLines(), "\n")
+    for _, want := range []string{
+        "[0:a]aresample=48000,aformat=sample_fmts=fltp:channel_layouts=stereo[a0]",
+        "anullsrc=r=48000:cl=stereo,atrim=duration=12.012,aformat=sample_fmts=fltp[a1]",
+        "[a0][a1]acrossfade=d=1.000[xa1]",
+        "setsar=1,fps=25,format=yuv422p,settb=AVTB[v1]",
+    } {
+        if !strings.Contains(lines, want) {
+            t.Errorf("transition command should contain %q:\n%s", want, lines)
+        }
+    }
+}
@@ -0,0 +1,159 @@
+package vidfusion
+
+import (
+    "fmt"
+    "strconv"
+)
+
+// 视频编码器名称
+const (
+    Libx265   = "libx265"
+    LibvpxVP9 = "libvpx-vp9"
+    LibSVTAV1 = "libsvtav1"
+    LibaomAV1 = "libaom-av1"
+)
+
+// EncoderProfile 视频编码配置，通过 WithEncoder 为每个 SDK 实例单独设置
+// 各字段按编码器映射为对应的 ffmpeg 参数，编码器不支持的字段会被忽略
+type EncoderProfile struct {
+    Codec       string   `json:"codec" yaml:"codec"`                               // 视频编码器，例如 libx264
+    Preset      string   `json:"preset,omitempty" yaml:"preset,omitempty"`         // 编码速度预设，libvpx-vp9 和 libaom-av1 映射为 -cpu-used
+    CRF         int      `json:"crf,omitempty" yaml:"crf,omitempty"`               // 恒定质量模式的质量参数，Bitrate 为空时生效，0 表示使用编码器默认值
+    Bitrate     string   `json:"bitrate,omitempty" yaml:"bitrate,omitempty"`       // 码率模式的目标码率，例如 4M，设置后忽略 CRF
+    MaxRate     string   `json:"maxrate,omitempty" yaml:"maxrate,omitempty"`       // 码率模式的最大码率
+    BufSize     string   `json:"bufsize,omitempty" yaml:"bufsize,omitempty"`       // 码率模式的缓冲区大小
+    PixelFormat string   `json:"pix_fmt,omitempty" yaml:"pix_fmt,omitempty"`       // 像素格式，例如 yuv420p
+    Profile     string   `json:"profile,omitempty" yaml:"profile,omitempty"`       // 编码 profile，例如 high
+    Level       string   `json:"level,omitempty" yaml:"level,omitempty"`           // 编码 level，例如 4.1
+    GOP         int      `json:"gop,omitempty" yaml:"gop,omitempty"`               // 关键帧间隔（帧数），0 表示使用编码器默认值
+    HWAccel     string   `json:"hwaccel,omitempty" yaml:"hwaccel,omitempty"`       // 解码硬件加速，例如 cuda
+    ExtraArgs   []string `json:"extra_args,omitempty" yaml:"extra_args,omitempty"` // 追加在最后的其他编码参数
+}
+
+// 内置编码配置
+var (
+    // X264Profile libx264 H.264 编码，兼容性最好
+    X264Profile = EncoderProfile{Codec: Libx264, Preset: "medium", CRF: 23, PixelFormat: "yuv420p"}
+    // X265Profile libx265 HEVC 编码，添加 hvc1 标签以便 Apple 设备播放
+    X265Profile = EncoderProfile{Codec: Libx265, Preset: "medium", CRF: 28, PixelFormat: "yuv420p", ExtraArgs: []string{"-tag:v", "hvc1"}}
+    // VP9Profile libvpx-vp9 恒定质量编码
+    VP9Profile = EncoderProfile{Codec: LibvpxVP9, Preset: "2", CRF: 31, PixelFormat: "yuv420p", ExtraArgs: []string{"-row-mt", "1"}}
+    // SVTAV1Profile libsvtav1 AV1 编码
+    SVTAV1Profile = EncoderProfile{Codec: LibSVTAV1, Preset: "8", CRF: 35, PixelFormat: "yuv420p"}
+    // AOMAV1Profile libaom-av1 AV1 编码，速度较慢
+    AOMAV1Profile = EncoderProfile{Codec: LibaomAV1, Preset: "6", CRF: 30, PixelFormat: "yuv420p", ExtraArgs: []string{"-row-mt", "1"}}
+    // NVENCProfile h264_nvenc 硬件编码，同时使用 cuda 硬件解码
+    NVENCProfile = EncoderProfile{Codec: H264Nvenc, Preset: "p4", CRF: 23, PixelFormat: "yuv420p", HWAccel: "cuda"}
+)
+
+// encoderProfiles 内置编码配置的名称
+var encoderProfiles = map[string]EncoderProfile{
+    "x264":    X264Profile,
+    "x265":    X265Profile,
+    "vp9":     VP9Profile,
+    "svtav1":  SVTAV1Profile,
+    "aom-av1": AOMAV1Profile,
+    "nvenc":   NVENCProfile,
+}
+
+// LookupEncoderProfile 根据名称查找内置编码配置，名称为 x264 / x265 / vp9 / svtav1 / aom-av1 / nvenc
+func LookupEncoderProfile(name string) (EncoderProfile, bool) {
+    profile, ok := encoderProfiles[name]
+    if ok {
+        profile.ExtraArgs = append([]string(nil), profile.ExtraArgs...)
+    }
+    return profile, ok
+}
+
+// Validate 检查编码配置是否有效
+func (p EncoderProfile) Validate() error {
+    if p.Codec == "" {
+        return fmt.Errorf("encoder profile has no codec")
+    }
+    if p.CRF < 0 {
+        return fmt.Errorf("encoder profile %s has negative crf %d", p.Codec, p.CRF)
+    }
+    if p.GOP < 0 {
+        return fmt.Errorf("encoder profile %s has negative gop %d", p.Codec, p.GOP)
+    }
+    if p.Bitrate == "" && (p.MaxRate != "" || p.BufSize != "") {
+        return fmt.Errorf("encoder profile %s sets maxrate or bufsize without bitrate", p.Codec)
+    }
+    return nil
+}
+
+// Args 返回视频编码参数，以 -c:v 开头
+func (p EncoderProfile) Args() []string {
+    args := []string{"-c:v", p.Codec}
+    if p.Preset != "" {
+        switch p.Codec {
+        case LibvpxVP9, LibaomAV1:
+            args = append(args, "-cpu-used", p.Preset)
+        default:
+            args = append(args, "-preset", p.Preset)
+        }
+    }
+    switch {
+    case p.Bitrate != "":
+        args = append(args, "-b:v", p.Bitrate)
+        if p.MaxRate != "" {
+            args = append(args, "-maxrate", p.MaxRate)
+        }
+        if p.BufSize != "" {
+            args = append(args, "-bufsize", p.BufSize)
+        }
+    case p.CRF > 0:
+        crf := strconv.Itoa(p.CRF)
+        switch p.Codec {
+        case H264Nvenc:
+            args = append(args, "-rc", "vbr", "-cq", crf, "-b:v", "0")
+        case LibvpxVP9, LibaomAV1:
+            // 恒定质量模式需要将码率设为 0
+            args = append(args, "-crf", crf, "-b:v", "0")
+        default:
+            args = append(args, "-crf", crf)
+        }
+    }
+    if p.PixelFormat != "" {
+        args = append(args, "-pix_fmt", p.PixelFormat)
+    }
+    if p.Profile != "" {
+        args = append(args, "-profile:v", p.Profile)
+    }
+    if p.Level != "" {
+        switch p.Codec {
+        case Libx265:
+            args = append(args, "-x265-params", "level-idc="+p.Level)
+        case Libx264, H264Nvenc:
+            args = append(args, "-level", p.Level)
+        }
+    }
+    if p.GOP > 0 {
+        args = append(args, "-g", strconv.Itoa(p.GOP))
+    }
+    return append(args, p.ExtraArgs...)
+}
+
+// codecName 返回编码器输出的编码格式，与 ffprobe 的 codec_name 一致，未知的编码器返回空字符串
+func (p EncoderProfile) codecName() string {
+    switch p.Codec {
+    case Libx264, H264Nvenc:
+        return "h264"
+    case Libx265:
+        return "hevc"
+    case LibvpxVP9:
+        return "vp9"
+    case LibSVTAV1, LibaomAV1:
+        return "av1"
+    }
+    return ""
+}
+
+// legacyEncoderProfile 未设置 EncoderProfile 时使用全局 Encoder 生成的编码配置
+func legacyEncoderProfile() EncoderProfile {
+    profile := EncoderProfile{Codec: Encoder}
+    if Encoder == H264Nvenc {
+        profile.HWAccel = "cuda"
+    }
+    return profile
+}
@@ -0,0 +1,64 @@
+package vidfusion
+
+import (
+    "strings"
+    "testing"
+)
+
+// TestEncoderProfile_Args 测试各编码器的参数映射
+func TestEncoderProfile_Args(t *testing.T) {
+    tests := []struct {
+        name    string
+        profile EncoderProfile
+        want    string
+    }{
+        {"x264", X264Profile, "-c:v libx264 -preset medium -crf 23 -pix_fmt yuv420p"},
+        {"x265", EncoderProfile{Codec: Libx265, CRF: 26, Profile: "main10", Level: "5.1", GOP: 60}, "-c:v libx265 -crf 26 -profile:v main10 -x265-params level-idc=5.1 -g 60"},
+        {"vp9", VP9Profile, "-c:v libvpx-vp9 -cpu-used 2 -crf 31 -b:v 0 -pix_fmt yuv420p -row-mt 1"},
+        {"svtav1", SVTAV1Profile, "-c:v libsvtav1 -preset 8 -crf 35 -pix_fmt yuv420p"},
+        {"aom-av1", AOMAV1Profile, "-c:v libaom-av1 -cpu-used 6 -crf 30 -b:v 0 -pix_fmt yuv420p -row-mt 1"},
+        {"nvenc", NVENCProfile, "-c:v h264_nvenc -preset p4 -rc vbr -cq 23 -b:v 0 -pix_fmt yuv420p"},
+        {"bitrate", EncoderProfile{Codec: Libx264, CRF: 18, Bitrate: "4M", MaxRate: "6M", BufSize: "8M", Level: "4.1"}, "-c:v libx264 -b:v 4M -maxrate 6M -bufsize 8M -level 4.1"},
+    }
+    for _, tt := range tests {
+        if err := tt.profile.Validate(); err != nil {
+            t.Errorf("%s should be valid, but got %v", tt.name, err)
+        }
+        if got := strings.Join(tt.profile.Args(), " "); got != tt.want {
+            t.Errorf("%s args should be %q, but got %q", tt.name, tt.want, got)
+        }
+    }
+    for _, profile := range []EncoderProfile{{}, {Codec: Libx264, CRF: -1}, {Codec: Libx264, MaxRate: "6M"}} {
+        if profile.Validate() == nil {
+            t.Errorf("%+v should be invalid", profile)
+        }
+    }
+    if profile, ok := LookupEncoderProfile("vp9"); !ok || profile.Codec != LibvpxVP9 {
+        t.Errorf("LookupEncoderProfile(vp9) should return VP9Profile, but got %+v %v", profile, ok)
+    }
+}
+
+// TestWithEncoder 测试每个实例使用各自的编码配置
+func TestWithEncoder(t *testing.T) {
+    runner := NewFakeRunner()
+    NewVideoSDKV2("in.mp4").WithRunner(runner).WithEncoder(NVENCProfile).FlipVideo().Cleanup()
+    NewVideoSDKV2("in.mp4").WithRunner(runner).FlipVideo().Cleanup()
+    v1 := NewVideoSDK().WithRunner(runner)
+    _ = v1.WithEncoder(VP9Profile).AddImageOverlay(OverlayOptions{ImageWidth: 10, ImageHeight: 10, VideoFile: "in.mp4", ImageFile: "logo.png", OutputFile: "out.webm"})
+    _ = v1.FlipVideo("in.mp4", "out.mp4")
+    lines := runner.CommandLines()
+    want := []string{
+        "ffmpeg -hwaccel cuda -y -i in.mp4 -vf hflip -c:v h264_nvenc -preset p4 -rc vbr -cq 23 -b:v 0 -pix_fmt yuv420p -c:a copy ",
+        "ffmpeg -y -i in.mp4 -vf hflip -c:v libx264 -c:a copy ",
+        "overlay=0:0 -c:v libvpx-vp9 -cpu-used 2 -crf 31 -b:v 0 -pix_fmt yuv420p -row-mt 1 -c:a copy out.webm",
+        "ffmpeg -y -i in.mp4 -vf hflip -c:v libx264 -c:a copy out.mp4",
+    }
+    if len(lines) != len(want) {
+        t.Fatalf("should run %d commands, but got %v", len(want), lines)
+    }
+    for i, line := range lines {
+        if !strings.Contains(line, want[i]) {
+            t.Errorf("command %d should contain %q, but got %q", i, want[i], line)
+        }
+    }
+}
@@ -0,0 +1,56 @@
+package vidfusion
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// CommandError 外部命令（ffmpeg / ffprobe）执行失败时返回的错误
+type CommandError struct {
+    Name   string   // 命令名称
+    Args   []string // 完整参数列表
+    Stderr string   // 命令输出（stderr）
+    Err    error    // 原始错误
+}
+
+// Error 实现 error 接口
+func (e *CommandError) Error() string {
+    return fmt.Sprintf("command error: %v\ncommand: %s %s\noutput: %s", e.Err, e.Name, strings.Join(e.Args, " "), e.Stderr)
+}
+
+// Unwrap 返回原始错误
+func (e *CommandError) Unwrap() error {
+    return e.Err
+}
+
+// StepError VideoSDKV2 处理步骤失败时返回的错误，记录步骤名称以及失败命令的参数和输出
+type StepError struct {
+    Step   string   // 步骤名称，例如 FlipVideo
+    Name   string   // 命令名称，非命令错误时为空
+    Args   []string // 命令参数，非命令错误时为空
+    Stderr string   // 命令输出，非命令错误时为空
+    Err    error    // 原始错误
+}
+
+// newStepError 根据原始错误构建 StepError，命令错误的参数和输出会被一并带上
+func newStepError(step string, err error) *StepError {
+    stepErr := &StepError{Step: step, Err: err}
+    var cmdErr *CommandError
+    if errors.As(err, &cmdErr) {
+        stepErr.Name = cmdErr.Name
+        stepErr.Args = cmdErr.Args
+        stepErr.Stderr = cmdErr.Stderr
+    }
+    return stepErr
+}
+
+// Error 实现 error 接口
+func (e *StepError) Error() string {
+    return fmt.Sprintf("%s failed: %v", e.Step, e.Err)
+}
+
+// Unwrap 返回原始错误
+func (e *StepError) Unwrap() error {
+    return e.Err
+}
@@ -0,0 +1,19 @@
+package vidfusion
+
+import (
+    "errors"
+    "fmt"
+    "testing"
+)
+
+// Test_newStepError 测试 StepError 带上命令错误的参数和输出
+func Test_newStepError(t *testing.T) {
+    cmdErr := &CommandError{Name: "ffmpeg", Args: []string{"-i", "1.mp4"}, Stderr: "1.mp4: No such file", Err: errors.New("exit status 1")}
+    stepErr := newStepError("FlipVideo", fmt.Errorf("wrapped: %w", cmdErr))
+    if stepErr.Name != "ffmpeg" || len(stepErr.Args) != 2 || stepErr.Stderr != cmdErr.Stderr {
+        t.Errorf("StepError should carry command details, but got %+v", stepErr)
+    }
+    if !errors.Is(stepErr, cmdErr.Err) {
+        t.Errorf("StepError should unwrap to the original error")
+    }
+}
@@ -0,0 +1,101 @@
+package vidfusion
+
+import (
+    "context"
+    "io"
+    "strings"
+    "sync"
+)
+
+// FakeResponse FakeRunner 的预设输出
+type FakeResponse struct {
+    Name   string // 匹配的命令名称，为空时匹配所有命令
+    Match  string // 匹配的参数子串，为空时匹配所有参数
+    Stdout string // 写入标准输出的内容
+    Stderr string // 写入标准错误的内容
+    Err    error  // 返回的错误
+}
+
+// FakeRunner 记录每次调用的参数并返回预设输出的 Runner，不会执行任何外部命令
+// 用于在没有 ffmpeg 的环境中测试生成的命令行
+type FakeRunner struct {
+    mu        sync.Mutex
+    responses []FakeResponse
+    calls     []Command
+}
+
+// NewFakeRunner 创建 FakeRunner 实例
+func NewFakeRunner() *FakeRunner {
+    return &FakeRunner{}
+}
+
+// On 预设匹配命令的标准输出，例如 On("ffprobe", "format=duration", "12.5")
+func (f *FakeRunner) On(name, match, stdout string) *FakeRunner {
+    return f.Respond(FakeResponse{Name: name, Match: match, Stdout: stdout})
+}
+
+// Respond 添加一条预设输出，按添加顺序匹配，先添加的优先
+func (f *FakeRunner) Respond(response FakeResponse) *FakeRunner {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.responses = append(f.responses, response)
+    return f
+}
+
+// Run 记录命令并写入匹配的预设输出，没有匹配时返回空输出
+func (f *FakeRunner) Run(ctx context.Context, cmd *Command) error {
+    f.mu.Lock()
+    f.calls = append(f.calls, Command{Name: cmd.Name, Args: append([]string(nil), cmd.Args...)})
+    response, _ := f.match(cmd)
+    f.mu.Unlock()
+
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    // 与 ffmpeg 一致，先输出 stderr 中的输入信息，再输出 stdout
+    if response.Stderr != "" && cmd.Stderr != nil {
+        _, _ = io.WriteString(cmd.Stderr, response.Stderr)
+    }
+    if response.Stdout != "" && cmd.Stdout != nil {
+        _, _ = io.WriteString(cmd.Stdout, response.Stdout)
+    }
+    return response.Err
+}
+
+// match 查找第一条匹配的预设输出
+func (f *FakeRunner) match(cmd *Command) (FakeResponse, bool) {
+    joined := strings.Join(cmd.Args, " ")
+    for _, response := range f.responses {
+        if response.Name != "" && response.Name != cmd.Name {
+            continue
+        }
+        if response.Match != "" && !strings.Contains(joined, response.Match) {
+            continue
+        }
+        return response, true
+    }
+    return FakeResponse{}, false
+}
+
+// Calls 返回所有记录的命令调用，Stdout 和 Stderr 字段为空
+func (f *FakeRunner) Calls() []Command {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return append([]Command(nil), f.calls...)
+}
+
+// CommandLines 返回所有记录的命令行，每条命令行为命令名称和参数用空格连接
+func (f *FakeRunner) CommandLines() []string {
+    var lines []string
+    for _, call := range f.Calls() {
+        lines = append(lines, call.Name+" "+strings.Join(call.Args, " "))
+    }
+    return lines
+}
+
+// Reset 清空记录的命令调用
+func (f *FakeRunner) Reset() {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.calls = nil
+}
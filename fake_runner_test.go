@@ -0,0 +1,32 @@
+package vidfusion
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "testing"
+)
+
+// TestFakeRunner 测试 FakeRunner 记录调用并按顺序匹配预设输出
+func TestFakeRunner(t *testing.T) {
+    fail := errors.New("exit status 1")
+    runner := NewFakeRunner().
+        On("ffprobe", "bad.mp4", "").
+        On("ffprobe", "format=duration", "12.5").
+        Respond(FakeResponse{Name: "ffmpeg", Stderr: "broken input", Err: fail})
+
+    var stdout bytes.Buffer
+    err := runner.Run(context.Background(), &Command{Name: "ffprobe", Args: []string{"-i", "1.mp4", "-show_entries", "format=duration"}, Stdout: &stdout})
+    if err != nil || stdout.String() != "12.5" {
+        t.Errorf("ffprobe should return 12.5, but got %q %v", stdout.String(), err)
+    }
+    var stderr bytes.Buffer
+    err = runner.Run(context.Background(), &Command{Name: "ffmpeg", Args: []string{"-i", "1.mp4"}, Stderr: &stderr})
+    if err != fail || stderr.String() != "broken input" {
+        t.Errorf("ffmpeg should fail with scripted output, but got %q %v", stderr.String(), err)
+    }
+    lines := runner.CommandLines()
+    if len(lines) != 2 || lines[1] != "ffmpeg -i 1.mp4" {
+        t.Errorf("unexpected recorded calls: %v", lines)
+    }
+}
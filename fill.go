@@ -0,0 +1,206 @@
+package vidfusion
+
+import (
+    "fmt"
+    "math/rand"
+    "sort"
+    "time"
+)
+
+// ProcessVideos 填充总时长的策略
+const (
+    FillLoop        = "loop"         // 按顺序循环使用片段，超出的部分从结尾裁掉（默认）
+    FillShuffle     = "shuffle"      // 随机顺序循环使用片段，同一片段不会连续出现，超出的部分从结尾裁掉
+    FillOnce        = "once"         // 每个片段使用一次，所有片段按比例缩短使总时长正好等于目标时长
+    FillTrimLongest = "trim-longest" // 每个片段使用一次，优先缩短最长的片段使总时长正好等于目标时长
+)
+
+// Manifest ProcessVideos 的拼合清单，记录输出中每一段使用的片段和时间范围
+type Manifest struct {
+    Fill     string            `json:"fill"`           // 使用的填充策略
+    Seed     int64             `json:"seed,omitempty"` // shuffle 使用的随机种子，可以通过 ProcessVideosOptions.Seed 复现
+    Duration float64           `json:"duration"`       // 目标总时长（秒）
+    Segments []ManifestSegment `json:"segments"`       // 按输出顺序排列的片段
+}
+
+// ManifestSegment 拼合清单中的一段
+type ManifestSegment struct {
+    Clip       int     `json:"clip"`                 // 片段在 VideosOptions 中的序号
+    File       string  `json:"file"`                 // 片段的源文件
+    Start      float64 `json:"start"`                // 使用部分在处理后片段中的开始时间（秒）
+    End        float64 `json:"end"`                  // 使用部分在处理后片段中的结束时间（秒）
+    Offset     float64 `json:"offset"`               // 在输出中的开始时间（秒）
+    Transition float64 `json:"transition,omitempty"` // 与下一段重叠的转场时长（秒）
+}
+
+// Manifest 返回最近一次 ProcessVideos 的拼合清单，没有执行过或执行失败时返回 nil
+func (sdk *VideoSDKV2) Manifest() *Manifest {
+    return sdk.manifest
+}
+
+// validFill 判断填充策略是否有效，为空表示 FillLoop
+func validFill(fill string) bool {
+    switch fill {
+    case "", FillLoop, FillShuffle, FillOnce, FillTrimLongest:
+        return true
+    }
+    return false
+}
+
+// segment 拼合时使用的一段片段，end 小于片段时长时需要在缩放前裁剪
+type segment struct {
+    clip       int
+    start, end float64
+}
+
+// fillSegments 按填充策略从处理后片段的时长中选择拼合的片段，返回的清单记录实际使用的时间范围
+func fillSegments(options ProcessVideosOptions, lengths []float64) ([]segment, *Manifest, error) {
+    if options.VideoDuration <= 0 {
+        return nil, nil, fmt.Errorf("duration must be positive, but got %.2f", options.VideoDuration)
+    }
+    manifest := &Manifest{Fill: options.Fill, Duration: options.VideoDuration}
+    if manifest.Fill == "" {
+        manifest.Fill = FillLoop
+    }
+    var segments []segment
+    switch manifest.Fill {
+    case FillLoop, FillShuffle:
+        next := func(int) int { return len(segments) % len(lengths) }
+        if manifest.Fill == FillShuffle {
+            manifest.Seed = options.Seed
+            if manifest.Seed == 0 {
+                manifest.Seed = time.Now().UnixNano()
+            }
+            next = shuffler(len(lengths), rand.New(rand.NewSource(manifest.Seed)))
+        }
+        // 转场使前后片段重叠，重叠的部分不计入总时长
+        var total float64
+        last := -1
+        for total < options.VideoDuration {
+            if last >= 0 {
+                total -= options.transition(last).overlap()
+            }
+            last = next(last)
+            segments = append(segments, segment{clip: last, end: lengths[last]})
+            total += lengths[last]
+        }
+    case FillOnce, FillTrimLongest:
+        // 需要的片段总时长包括转场重叠的部分
+        var total float64
+        duration := options.VideoDuration
+        for i, length := range lengths {
+            total += length
+            if i < len(lengths)-1 {
+                duration += options.transition(i).overlap()
+            }
+        }
+        if total < duration {
+            return nil, nil, fmt.Errorf("%s: clips are %.2fs in total, shorter than the duration %.2fs", manifest.Fill, total, duration)
+        }
+        ends := proportionalEnds(lengths, total, duration)
+        if manifest.Fill == FillTrimLongest {
+            ends = trimLongestEnds(lengths, total-duration)
+        }
+        for i, end := range ends {
+            segments = append(segments, segment{clip: i, end: end})
+        }
+    default:
+        return nil, nil, fmt.Errorf("unknown fill strategy %q", options.Fill)
+    }
+
+    // 缩短后的片段需要比前后两个转场都长，否则要到所有片段处理完、合并时才会失败
+    for i, s := range segments {
+        length := s.end - s.start
+        if i > 0 {
+            if overlap := options.transition(segments[i-1].clip).overlap(); overlap > 0 && overlap >= length {
+                return nil, nil, fmt.Errorf("%s: %s (%.2fs) must be longer than the transition before it (%.2fs)", manifest.Fill, options.VideosOptions[s.clip].VideoFile, length, overlap)
+            }
+        }
+        if i < len(segments)-1 {
+            if overlap := options.transition(s.clip).overlap(); overlap > 0 && overlap >= length {
+                return nil, nil, fmt.Errorf("%s: %s (%.2fs) must be longer than the transition after it (%.2fs)", manifest.Fill, options.VideosOptions[s.clip].VideoFile, length, overlap)
+            }
+        }
+    }
+
+    var offset float64
+    for i, s := range segments {
+        if offset >= options.VideoDuration {
+            break
+        }
+        // 循环使用时超出目标时长的部分在拼合后裁掉
+        end := s.end
+        if offset+end-s.start > options.VideoDuration {
+            end = s.start + options.VideoDuration - offset
+        }
+        var overlap float64
+        if i < len(segments)-1 && end == s.end {
+            overlap = options.transition(s.clip).overlap()
+        }
+        manifest.Segments = append(manifest.Segments, ManifestSegment{
+            Clip:       s.clip,
+            File:       options.VideosOptions[s.clip].VideoFile,
+            Start:      s.start,
+            End:        end,
+            Offset:     offset,
+            Transition: overlap,
+        })
+        offset += end - s.start - overlap
+    }
+    return segments, manifest, nil
+}
+
+// shuffler 返回按随机排列循环选择片段的函数，每轮排列的第一个片段与上一个片段不同
+func shuffler(n int, r *rand.Rand) func(previous int) int {
+    var order []int
+    return func(previous int) int {
+        if len(order) == 0 {
+            order = r.Perm(n)
+            if n > 1 && order[0] == previous {
+                swap := 1 + r.Intn(n-1)
+                order[0], order[swap] = order[swap], order[0]
+            }
+        }
+        next := order[0]
+        order = order[1:]
+        return next
+    }
+}
+
+// proportionalEnds 按相同比例缩短所有片段，使总时长等于 duration
+func proportionalEnds(lengths []float64, total, duration float64) []float64 {
+    ends := make([]float64, len(lengths))
+    for i, length := range lengths {
+        ends[i] = length * duration / total
+    }
+    return ends
+}
+
+// trimLongestEnds 从最长的片段开始缩短，直到去掉 excess 秒，被缩短的片段缩短到相同的时长
+func trimLongestEnds(lengths []float64, excess float64) []float64 {
+    ends := append([]float64(nil), lengths...)
+    if excess <= 0 {
+        return ends
+    }
+    sorted := append([]float64(nil), lengths...)
+    sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+    // 找到上限 limit，使所有片段超出 limit 的部分之和等于 excess
+    limit, sum := 0.0, 0.0
+    for k := 1; k <= len(sorted); k++ {
+        sum += sorted[k-1]
+        next := 0.0
+        if k < len(sorted) {
+            next = sorted[k]
+        }
+        if sum-float64(k)*next >= excess {
+            limit = (sum - excess) / float64(k)
+            break
+        }
+    }
+    for i := range ends {
+        if ends[i] > limit {
+            ends[i] = limit
+        }
+    }
+    return ends
+}
@@ -0,0 +1,130 @@
+package vidfusion
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// Test_fillSegments 测试各填充策略选择的片段和拼合清单
+func Test_fillSegments(t *testing.T) {
+    options := ProcessVideosOptions{
+        VideoDuration: 12,
+        VideosOptions: []VideosOptions{{VideoFile: "a.mp4"}, {VideoFile: "b.mp4"}, {VideoFile: "c.mp4"}},
+    }
+    lengths := []float64{4, 6, 10}
+    for fill, want := range map[string]string{
+        "":              "0:0-4@0 1:0-6@4 2:0-2@10",
+        FillLoop:        "0:0-4@0 1:0-6@4 2:0-2@10",
+        FillOnce:        "0:0-2.4@0 1:0-3.6@2.4 2:0-6@6",
+        FillTrimLongest: "0:0-4@0 1:0-4@4 2:0-4@8",
+    } {
+        options.Fill = fill
+        _, manifest, err := fillSegments(options, lengths)
+        if err != nil {
+            t.Fatalf("%s: fillSegments error: %v", fill, err)
+        }
+        var got []string
+        for _, s := range manifest.Segments {
+            got = append(got, fmt.Sprintf("%d:%g-%.2g@%.2g", s.Clip, s.Start, s.End, s.Offset))
+        }
+        if strings.Join(got, " ") != want || manifest.Duration != 12 || manifest.Segments[0].File != "a.mp4" {
+            t.Errorf("%s: segments should be %s, but got %s", fill, want, strings.Join(got, " "))
+        }
+    }
+
+    // 没有设置总时长时直接报错，而不是生成空的拼合清单
+    for _, fill := range []string{FillLoop, FillShuffle, FillOnce, FillTrimLongest} {
+        options.Fill = fill
+        options.VideoDuration = 0
+        if _, _, err := fillSegments(options, lengths); err == nil || !strings.Contains(err.Error(), "duration must be positive, but got 0.00") {
+            t.Errorf("%s: zero duration should fail, but got %v", fill, err)
+        }
+        runner := NewFakeRunner()
+        sdk := NewVideoSDKV2("").WithRunner(runner)
+        sdk.ProcessVideos(ProcessVideosOptions{VideoDuration: -1, Fill: fill, VideosOptions: options.VideosOptions})
+        if err := sdk.Err(); err == nil || !strings.Contains(err.Error(), "duration must be positive, but got -1.00") || len(runner.CommandLines()) != 0 {
+            t.Errorf("%s: ProcessVideos should fail before running any command, but got %v %v", fill, err, runner.CommandLines())
+        }
+    }
+
+    options.Fill = FillTrimLongest
+    options.VideoDuration = 30
+    if _, _, err := fillSegments(options, lengths); err == nil || !strings.Contains(err.Error(), "clips are 20.00s in total, shorter than the duration 30.00s") {
+        t.Errorf("clips shorter than the duration should fail, but got %v", err)
+    }
+
+    options.Fill = FillShuffle
+    options.Seed = 42
+    options.VideoDuration = 60
+    segments, manifest, err := fillSegments(options, []float64{1, 1, 1})
+    if err != nil {
+        t.Fatalf("fillSegments error: %v", err)
+    }
+    if manifest.Seed != 42 || len(segments) != 60 {
+        t.Fatalf("unexpected manifest: %+v", manifest)
+    }
+    for i := 1; i < len(segments); i++ {
+        if segments[i].clip == segments[i-1].clip {
+            t.Fatalf("clip %d should not repeat immediately at %d", segments[i].clip, i)
+        }
+    }
+    for round := 0; round < 20; round++ {
+        seen := make(map[int]bool)
+        for _, s := range segments[round*3 : round*3+3] {
+            seen[s.clip] = true
+        }
+        if len(seen) != 3 {
+            t.Fatalf("every clip should be used once per round, but got %+v", segments[round*3:round*3+3])
+        }
+    }
+    again, _, _ := fillSegments(options, []float64{1, 1, 1})
+    if fmt.Sprint(again) != fmt.Sprint(segments) {
+        t.Errorf("the same seed should produce the same order")
+    }
+}
+
+// TestProcessVideos_Fill 测试按比例缩短片段时在缩放前裁剪，并返回拼合清单
+func TestProcessVideos_Fill(t *testing.T) {
+    for _, lazy := range []bool{false, true} {
+        runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON).On("ffprobe", "format=duration", "4")
+        sdk := NewVideoSDKV2("").WithRunner(runner).WithParallel(2)
+        if lazy {
+            sdk.Lazy()
+        }
+        sdk.ProcessVideos(ProcessVideosOptions{
+            VideoDuration: 6,
+            Width:         720,
+            Height:        1280,
+            Fill:          FillOnce,
+            VideosOptions: []VideosOptions{{VideoFile: "1.mp4"}, {VideoFile: "2.mp4"}, {VideoFile: "3.mp4"}},
+        })
+        if sdk.Err() != nil {
+            t.Fatalf("lazy %v: ProcessVideos error: %v", lazy, sdk.Err())
+        }
+        manifest := sdk.Manifest()
+        if manifest == nil || len(manifest.Segments) != 3 || manifest.Segments[2].Offset != 4 || manifest.Segments[2].End != 2 || manifest.Fill != FillOnce {
+            t.Fatalf("lazy %v: unexpected manifest %+v", lazy, manifest)
+        }
+        lines := runner.CommandLines()
+        var trims int
+        for _, line := range lines {
+            if lazy && strings.Contains(line, "trim=start=0.00:end=2.00") && strings.Contains(line, "scale=720:1280") {
+                trims++
+            }
+            if !lazy && strings.Contains(line, "-ss 0.00 -to 2.00 ") {
+                trims++
+            }
+        }
+        if trims != 3 {
+            t.Errorf("lazy %v: every clip should be trimmed to 2s before scaling, but got %d:\n%s", lazy, trims, strings.Join(lines, "\n"))
+        }
+        sdk.Cleanup()
+    }
+
+    sdk := NewVideoSDKV2("").WithRunner(NewFakeRunner())
+    sdk.ProcessVideos(ProcessVideosOptions{VideoDuration: 6, Fill: "random", VideosOptions: []VideosOptions{{VideoFile: "1.mp4"}}})
+    if err := sdk.Err(); err == nil || !strings.Contains(err.Error(), `unknown fill strategy "random"`) || sdk.Manifest() != nil {
+        t.Errorf("unknown fill strategy should fail, but got %v", err)
+    }
+}
@@ -0,0 +1,282 @@
+package vidfusion
+
+import (
+    "fmt"
+    "slices"
+    "strings"
+)
+
+// filterGraph 延迟模式下待编译的滤镜图
+// 链式方法只向滤镜图追加节点，Flush 或 Finalize 时编译为一条 -filter_complex 命令
+type filterGraph struct {
+    inputs   []graphInput  // 输入，第 0 个为源文件
+    filters  []graphFilter // filter_complex 中的滤镜链
+    steps    []string      // 已追加的步骤名称
+    video    string        // 当前视频流，输入流形如 0:v，滤镜输出形如 v1
+    audio    string        // 当前音频流，为空表示没有音频
+    subtitle string        // 需要保留的字幕流，形如 1:s
+    labels   int           // 已分配的标签数
+    shortest bool          // 是否需要 -shortest 截断无限长的音频源
+    duration float64       // 当前输出时长，0 表示未知
+    width    int64         // 当前输出宽度，0 表示未知
+    height   int64         // 当前输出高度，0 表示未知
+}
+
+// graphFilter filter_complex 中的一条滤镜链
+type graphFilter struct {
+    inputs []string // 输入标签
+    expr   string   // 滤镜表达式
+    output string   // 输出标签
+    extra  []string // split、concat 等多输出滤镜的其余输出标签
+}
+
+// String 返回 [in1][in2]expr[out] 形式的滤镜链
+func (f graphFilter) String() string {
+    var b strings.Builder
+    for _, input := range f.inputs {
+        b.WriteString("[" + input + "]")
+    }
+    b.WriteString(f.expr)
+    for _, output := range append([]string{f.output}, f.extra...) {
+        b.WriteString("[" + output + "]")
+    }
+    return b.String()
+}
+
+// graphInput 滤镜图的一个输入
+type graphInput struct {
+    options []string // -i 之前的输入选项，例如 -f lavfi
+    file    string   // 输入文件
+}
+
+// newFilterGraph 以源文件创建滤镜图，info 为源文件的探测信息
+func newFilterGraph(file string, info *MediaInfo) *filterGraph {
+    g := &filterGraph{
+        inputs:   []graphInput{{file: file}},
+        video:    "0:v",
+        duration: info.Format.Duration,
+    }
+    if video := info.VideoStream(); video != nil {
+        g.width, g.height = video.DisplaySize()
+    }
+    if info.HasAudio() {
+        g.audio = "0:a"
+    }
+    return g
+}
+
+// pending 是否有尚未编译的节点
+func (g *filterGraph) pending() bool {
+    return g != nil && len(g.steps) > 0
+}
+
+// nextLabel 分配一个新的滤镜输出标签
+func (g *filterGraph) nextLabel(prefix string) string {
+    g.labels++
+    return fmt.Sprintf("%s%d", prefix, g.labels)
+}
+
+// addInput 添加一个输入，返回输入序号
+func (g *filterGraph) addInput(file string, options ...string) int {
+    g.inputs = append(g.inputs, graphInput{options: options, file: file})
+    return len(g.inputs) - 1
+}
+
+// addFilter 追加一条滤镜链，返回新分配的输出标签
+func (g *filterGraph) addFilter(prefix, expr string, inputs ...string) string {
+    label := g.nextLabel(prefix)
+    g.filters = append(g.filters, graphFilter{inputs: inputs, expr: expr, output: label})
+    return label
+}
+
+// addMultiFilter 追加一条多输出的滤镜链，按 prefixes 为每个输出分配标签并返回
+func (g *filterGraph) addMultiFilter(expr string, inputs []string, prefixes ...string) []string {
+    labels := make([]string, len(prefixes))
+    for i, prefix := range prefixes {
+        labels[i] = g.nextLabel(prefix)
+    }
+    g.filters = append(g.filters, graphFilter{inputs: inputs, expr: expr, output: labels[0], extra: labels[1:]})
+    return labels
+}
+
+// splitStream 将流复制为 n 路，音频流使用 asplit，n 为 1 时直接返回原流
+func (g *filterGraph) splitStream(prefix, stream string, n int) []string {
+    if n == 1 {
+        return []string{stream}
+    }
+    expr := fmt.Sprintf("split=%d", n)
+    if prefix == "a" {
+        expr = "a" + expr
+    }
+    prefixes := make([]string, n)
+    for i := range prefixes {
+        prefixes[i] = prefix
+    }
+    return g.addMultiFilter(expr, []string{stream}, prefixes...)
+}
+
+// videoFilter 对当前视频流追加滤镜
+func (g *filterGraph) videoFilter(filter string) {
+    g.video = g.addFilter("v", filter, g.video)
+}
+
+// audioFilter 对当前音频流追加滤镜，没有音频时跳过
+func (g *filterGraph) audioFilter(filter string) {
+    if g.audio == "" {
+        return
+    }
+    g.audio = g.addFilter("a", filter, g.audio)
+}
+
+// usedFilters 返回最终输出实际用到的滤镜链，Mute 等步骤丢弃的分支会被移除，避免 ffmpeg 报未连接的输出
+func (g *filterGraph) usedFilters() []string {
+    used := map[string]bool{g.video: true, g.audio: true}
+    keep := make([]bool, len(g.filters))
+    // 滤镜链只会引用之前的输出，倒序遍历即可找出所有被用到的链
+    for i := len(g.filters) - 1; i >= 0; i-- {
+        if !slices.ContainsFunc(append([]string{g.filters[i].output}, g.filters[i].extra...), func(output string) bool { return used[output] }) {
+            continue
+        }
+        keep[i] = true
+        for _, input := range g.filters[i].inputs {
+            used[input] = true
+        }
+    }
+    var filters []string
+    for i, filter := range g.filters {
+        if keep[i] {
+            filters = append(filters, filter.String())
+        }
+    }
+    return filters
+}
+
+// compile 编译为 ffmpeg 参数，经过滤镜处理的视频流使用 encoder 编码，未经过滤镜处理的流直接复制
+func (g *filterGraph) compile(outputFile string, encoder EncoderProfile) []string {
+    var args []string
+    for _, input := range g.inputs {
+        args = append(args, input.options...)
+        args = append(args, "-i", input.file)
+    }
+    if filters := g.usedFilters(); len(filters) > 0 {
+        args = append(args, "-filter_complex", strings.Join(filters, ";"))
+    }
+    if isInputStream(g.video) {
+        args = append(args, "-map", g.video, "-c:v", "copy")
+    } else {
+        args = append(args, "-map", "["+g.video+"]")
+        args = append(args, encoder.Args()...)
+    }
+    switch {
+    case g.audio == "":
+        args = append(args, "-an")
+    case isInputStream(g.audio):
+        args = append(args, "-map", g.audio, "-c:a", "copy")
+    default:
+        args = append(args, "-map", "["+g.audio+"]", "-c:a", "aac", "-b:a", "192k")
+    }
+    if g.subtitle != "" {
+        args = append(args, "-map", g.subtitle, "-c:s", "mov_text")
+    }
+    if g.shortest {
+        args = append(args, "-shortest")
+    }
+    return append(args, outputFile)
+}
+
+// isInputStream 是否为输入文件中的流（而不是滤镜输出）
+func isInputStream(label string) bool {
+    return strings.Contains(label, ":")
+}
+
+// Lazy 开启延迟模式：之后的链式方法只向滤镜图追加节点，Flush 或 Finalize 时编译为一条 ffmpeg 命令执行，
+// 整个链只经历一次解码和编码。ConcatenateVideos 等必须落盘的步骤以及查询尚未生成的当前文件时会自动拆分执行
+func (sdk *VideoSDKV2) Lazy() *VideoSDKV2 {
+    sdk.lazy = true
+    return sdk
+}
+
+// appendNode 延迟模式下向滤镜图追加一个节点，滤镜图为空时先探测当前文件作为源
+func (sdk *VideoSDKV2) appendNode(step string, apply func(g *filterGraph) error) *VideoSDKV2 {
+    if sdk.err != nil {
+        return sdk
+    }
+    if sdk.graph == nil {
+        info, err := sdk.probe(sdk.CurrentFile)
+        if err != nil {
+            sdk.fail(step, err)
+            return sdk
+        }
+        sdk.graph = newFilterGraph(sdk.CurrentFile, info)
+    }
+    if err := apply(sdk.graph); err != nil {
+        sdk.fail(step, err)
+        return sdk
+    }
+    sdk.graph.steps = append(sdk.graph.steps, step)
+    return sdk
+}
+
+// Flush 延迟模式下将尚未执行的节点编译为一条 ffmpeg 命令执行，并将结果设置为当前文件
+func (sdk *VideoSDKV2) Flush() *VideoSDKV2 {
+    graph := sdk.graph
+    sdk.graph = nil
+    if sdk.err != nil || !graph.pending() {
+        return sdk
+    }
+    return sdk.runStepDuration(graph.stepName(), graph.outputDuration, func(outputFile string) []string {
+        return graph.compile(outputFile, sdk.encoderProfile())
+    })
+}
+
+// flushIfCurrent 查询的文件是尚未生成的当前文件时先执行滤镜图，返回执行后需要查询的文件
+func (sdk *VideoSDKV2) flushIfCurrent(file string) string {
+    if sdk.graph.pending() && file == sdk.CurrentFile {
+        sdk.Flush()
+        return sdk.CurrentFile
+    }
+    return file
+}
+
+// flushInputs 结果将替换当前文件时调用：输入中包含尚未生成的当前文件时先执行滤镜图，并将输入替换为生成的文件；
+// 否则尚未执行的滤镜图不再需要，直接丢弃
+func (sdk *VideoSDKV2) flushInputs(files []string) []string {
+    if current := sdk.CurrentFile; sdk.graph.pending() && slices.Contains(files, current) {
+        sdk.Flush()
+        files = slices.Clone(files)
+        for i, file := range files {
+            if file == current {
+                files[i] = sdk.CurrentFile
+            }
+        }
+    }
+    sdk.graph = nil
+    return files
+}
+
+// stepName 编译后命令的步骤名称，由所有节点的步骤名称组成
+func (g *filterGraph) stepName() string {
+    return strings.Join(g.steps, "+")
+}
+
+// outputDuration 输出时长，未知时使用输入时长
+func (g *filterGraph) outputDuration(input float64) float64 {
+    if g.duration > 0 {
+        return g.duration
+    }
+    return input
+}
+
+// trimmedDuration 计算裁剪时间线后的时长，duration 未知时返回 0
+func trimmedDuration(duration, start, end float64) float64 {
+    if duration <= 0 {
+        return 0
+    }
+    if end > duration {
+        end = duration
+    }
+    if end <= start {
+        return 0
+    }
+    return end - start
+}
@@ -0,0 +1,159 @@
+package vidfusion
+
+import (
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// countCommands 统计指定命令的调用次数
+func countCommands(runner *FakeRunner, name string) int {
+    count := 0
+    for _, call := range runner.Calls() {
+        if call.Name == name {
+            count++
+        }
+    }
+    return count
+}
+
+// TestLazy 测试延迟模式将整条链编译为一条 ffmpeg 命令
+func TestLazy(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner).Lazy()
+    sdk.CropVideoTimeline(0, 5).Mute().MuteTrack().AddBackgroundMusic("music.flac", 0.4).AddBackgroundMusic("voice.wav", 2)
+    // 尺寸可以由滤镜图推算，不需要拆分执行；源文件带有旋转元数据，滤镜看到的是旋转后的竖屏画面
+    width, height, err := sdk.GetVideoDimensions(sdk.CurrentFile)
+    if err != nil || width != 1080 || height != 1920 {
+        t.Fatalf("GetVideoDimensions should return 1080x1920, but got %dx%d %v", width, height, err)
+    }
+    sdk.AddImageOverlay(OverlayOptions{ImageWidth: width, ImageHeight: height, ImageFile: "overlay.png"}).
+        AddSubtitles("srt.srt", SubtitleOptions{FontSize: 9, FontColor: "00FFFFFF", YPosition: 150, Alignment: 2, Font: "Arial"})
+    output, err := sdk.Finalize(filepath.Join(t.TempDir(), "out.mp4"))
+    if err != nil {
+        t.Fatalf("Finalize error: %v", err)
+    }
+    lines := runner.CommandLines()
+    if len(lines) != 2 || countCommands(runner, "ffmpeg") != 1 {
+        t.Fatalf("should probe once and run ffmpeg once, but got %v", lines)
+    }
+    want := "ffmpeg -y -i in.mp4 -i music.flac -i voice.wav -i overlay.png -i srt.srt -filter_complex " +
+        "[0:v]trim=start=0.00:end=5.00,setpts=PTS-STARTPTS[v1];" +
+        "anullsrc=r=44100:cl=stereo,atrim=duration=5.000[a3];" +
+        "[1:a]volume=0.4[a4];[a3][a4]amix=inputs=2:duration=first:dropout_transition=2[a5];" +
+        "[2:a]volume=2.0[a6];[a5][a6]amix=inputs=2:duration=first:dropout_transition=2[a7];" +
+        "[3:v]scale=1080:1920[img8];[v1][img8]overlay=0:0[v9];" +
+        "[v9]subtitles='srt.srt':force_style='Alignment=2,Fontsize=9,PrimaryColour=&H00FFFFFF&,FontName=Arial,MarginL=0,MarginR=0,MarginV=150'[v10] " +
+        "-map [v10] -c:v libx264 -map [a7] -c:a aac -b:a 192k -map 4:s -c:s mov_text " + output
+    if lines[1] != want {
+        t.Errorf("unexpected compiled command:\n got: %s\nwant: %s", lines[1], want)
+    }
+}
+
+// TestLazy_Flush 测试查询无法推算的信息时拆分执行，以及未处理的流直接复制
+func TestLazy_Flush(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner).Lazy()
+    sdk.ScaleUpVideo(1.5)
+    // 缩放后的尺寸无法推算，需要先执行滤镜图，再探测生成的文件而不是源文件；源文件带有旋转元数据，探测到的是显示尺寸
+    width, height, err := sdk.GetVideoDimensions(sdk.CurrentFile)
+    lines := runner.CommandLines()
+    if err != nil || width != 1080 || height != 1920 || !strings.HasSuffix(lines[len(lines)-1], " "+sdk.CurrentFile) {
+        t.Errorf("dimensions should be probed from the flushed file, but got %dx%d %v %v", width, height, err, lines)
+    }
+    if countCommands(runner, "ffmpeg") != 1 || sdk.CurrentFile == "in.mp4" {
+        t.Errorf("GetVideoDimensions should flush the pending graph, but got %v", runner.CommandLines())
+    }
+
+    runner.Reset()
+    sdk = NewVideoSDKV2("in.mp4").WithRunner(runner).Lazy()
+    sdk.Mute().Flush()
+    lines = runner.CommandLines()
+    if len(lines) != 2 || !strings.Contains(lines[1], "-i in.mp4 -map 0:v -c:v copy -an ") {
+        t.Errorf("video stream should be copied without re-encoding, but got %v", lines)
+    }
+    sdk.Cleanup()
+}
+
+// TestLazy_ConcatenateVideos 测试合并的视频包含当前文件时先执行滤镜图，否则直接丢弃滤镜图
+func TestLazy_ConcatenateVideos(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner).Lazy()
+    sdk.FlipVideo().ConcatenateVideos([]string{sdk.CurrentFile, "outro.mp4"}, 720, 1280)
+    lines := runner.CommandLines()
+    if sdk.Err() != nil || len(lines) != 7 || !strings.Contains(lines[1], "-i in.mp4 -filter_complex [0:v]hflip[v1] ") {
+        t.Fatalf("pending graph should be flushed before concatenating, but got %v:\n%s", sdk.Err(), strings.Join(lines, "\n"))
+    }
+    flipped := lines[1][strings.LastIndex(lines[1], " ")+1:]
+    if !strings.HasSuffix(lines[2], " "+flipped) || !strings.Contains(lines[4], "ffmpeg -y -i "+flipped+" -vf scale=720:1280") || strings.Contains(strings.Join(lines[2:], "\n"), "in.mp4") {
+        t.Errorf("the flipped file should be concatenated instead of the source, but got:\n%s", strings.Join(lines, "\n"))
+    }
+
+    runner = NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk = NewVideoSDKV2("in.mp4").WithRunner(runner).Lazy()
+    sdk.FlipVideo().ConcatenateVideos([]string{"intro.mp4", "outro.mp4"}, 720, 1280)
+    if lines := strings.Join(runner.CommandLines(), "\n"); sdk.Err() != nil || strings.Contains(lines, "hflip") || strings.Contains(lines, "-i in.mp4") {
+        t.Errorf("pending graph should be dropped when the current file is not concatenated, but got %v:\n%s", sdk.Err(), lines)
+    }
+}
+
+// TestLazy_ProcessVideos 测试延迟模式下每个片段的处理和缩放合并为一条命令
+func TestLazy_ProcessVideos(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON).On("ffprobe", "format=duration", "12.012")
+    sdk := NewVideoSDKV2("").WithRunner(runner).Lazy()
+    sdk.ProcessVideos(ProcessVideosOptions{
+        VideoDuration: 20,
+        Width:         720,
+        Height:        1280,
+        VideosOptions: []VideosOptions{
+            {VideoFile: "1.mp4", Process: FlipVideo},
+            {VideoFile: "2.mp4"},
+        },
+    })
+    if sdk.Err() != nil {
+        t.Fatalf("ProcessVideos error: %v", sdk.Err())
+    }
+    // 2 条片段命令 + 合并前的 2 条缩放命令 + 1 条合并命令，最后的裁剪时长留在滤镜图中
+    if count := countCommands(runner, "ffmpeg"); count != 5 {
+        t.Errorf("should run ffmpeg 5 times, but got %d: %v", count, runner.CommandLines())
+    }
+    if !sdk.graph.pending() || sdk.graph.stepName() != "CropVideoTimeline" {
+        t.Errorf("final trim should stay pending, but got %+v", sdk.graph)
+    }
+    found := false
+    for _, line := range runner.CommandLines() {
+        if strings.Contains(line, "-i 1.mp4 -filter_complex [0:v]hflip[v1];[v1]scale=720:1280[v2]") {
+            found = true
+        }
+    }
+    if !found {
+        t.Errorf("flip and scale should be fused, but got %v", runner.CommandLines())
+    }
+    sdk.Cleanup()
+}
+
+// TestLazy_SpeedUpVideo 测试延迟模式下音频同步变速，时长直接按倍数推算
+func TestLazy_SpeedUpVideo(t *testing.T) {
+    for audio, want := range map[string]string{
+        SpeedAudioTempo: "[0:v]setpts=0.250000*PTS[v1];[0:a]atempo=2,atempo=2[a2] -map [v1] -c:v libx264 -map [a2] ",
+        SpeedAudioDrop:  "[0:v]setpts=0.250000*PTS[v1] -map [v1] -c:v libx264 -an ",
+    } {
+        runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+        sdk := NewVideoSDKV2("in.mp4").WithRunner(runner).Lazy()
+        sdk.SpeedUpVideoWithOptions(SpeedOptions{Speed: 4, Audio: audio})
+        if duration, err := sdk.GetVideoDuration(sdk.CurrentFile); err != nil || duration != 3.003 {
+            t.Errorf("%s: duration should be 3.003s, but got %v %v", audio, duration, err)
+        }
+        sdk.Flush()
+        lines := runner.CommandLines()
+        if sdk.Err() != nil || len(lines) != 2 || !strings.Contains(lines[1], want) || strings.Contains(lines[1], "atrim") {
+            t.Errorf("%s: command should contain %q, but got %v %v", audio, want, lines, sdk.Err())
+        }
+        sdk.Cleanup()
+    }
+
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(NewFakeRunner()).Lazy()
+    if err := sdk.SpeedUpVideoWithOptions(SpeedOptions{Speed: 2, Audio: "mute"}).Err(); err == nil || !strings.Contains(err.Error(), `unknown speed audio mode "mute"`) {
+        t.Errorf("unknown audio mode should fail, but got %v", err)
+    }
+}
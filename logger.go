@@ -0,0 +1,24 @@
+package vidfusion
+
+import (
+    "context"
+    "log/slog"
+)
+
+// discardLogger 未设置日志记录器时使用，丢弃所有日志
+var discardLogger = slog.New(discardHandler{})
+
+// discardHandler 丢弃所有日志记录的 slog.Handler
+type discardHandler struct{}
+
+// Enabled 所有级别都不记录
+func (discardHandler) Enabled(context.Context, slog.Level) bool { return false }
+
+// Handle 丢弃日志记录
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+
+// WithAttrs 返回自身
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+// WithGroup 返回自身
+func (h discardHandler) WithGroup(string) slog.Handler { return h }
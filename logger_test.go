@@ -0,0 +1,71 @@
+package vidfusion
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "log/slog"
+    "strings"
+    "testing"
+)
+
+// decodeRecords 解析 JSON 日志记录
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+    var records []map[string]any
+    for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+        record := map[string]any{}
+        if err := json.Unmarshal([]byte(line), &record); err != nil {
+            t.Fatalf("invalid log line %q: %v", line, err)
+        }
+        records = append(records, record)
+    }
+    return records
+}
+
+// TestWithLogger 测试命令执行的结构化日志，stderr 只在失败时记录
+func TestWithLogger(t *testing.T) {
+    var buf bytes.Buffer
+    logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+    runner := NewFakeRunner().
+        Respond(FakeResponse{Name: "ffmpeg", Match: "bad.mp4", Stderr: "bad.mp4: Invalid data", Err: errors.New("exit status 1")}).
+        Respond(FakeResponse{Name: "ffmpeg", Stderr: "frame=100"})
+    sdk := NewVideoSDK().WithRunner(runner).WithLogger(logger)
+    
+    if err := sdk.FlipVideo("in.mp4", "out.mp4"); err != nil {
+        t.Fatal(err)
+    }
+    if err := sdk.FlipVideo("bad.mp4", "out.mp4"); err == nil {
+        t.Fatal("FlipVideo should fail")
+    }
+    records := decodeRecords(t, &buf)
+    if len(records) != 2 {
+        t.Fatalf("should log 2 records at info level, but got %d: %s", len(records), buf.String())
+    }
+    finished, failed := records[0], records[1]
+    if finished["msg"] != "command finished" || finished["step"] != "FlipVideo" || finished["exit_code"] != float64(0) {
+        t.Errorf("unexpected finished record: %v", finished)
+    }
+    if _, ok := finished["stderr"]; ok {
+        t.Errorf("stderr should only be logged at debug level, but got %v", finished)
+    }
+    if failed["msg"] != "command failed" || failed["level"] != "ERROR" || failed["stderr"] != "bad.mp4: Invalid data" {
+        t.Errorf("unexpected failed record: %v", failed)
+    }
+}
+
+// TestWithLogger_TempFiles 测试 debug 级别记录临时文件的创建和删除
+func TestWithLogger_TempFiles(t *testing.T) {
+    var buf bytes.Buffer
+    logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(NewFakeRunner()).WithLogger(logger)
+    sdk.Mute()
+    sdk.Cleanup()
+    var messages []string
+    for _, record := range decodeRecords(t, &buf) {
+        messages = append(messages, record["msg"].(string))
+    }
+    want := "temp file created,command started,command finished,temp file removed"
+    if strings.Join(messages, ",") != want {
+        t.Errorf("should log %s, but got %v", want, messages)
+    }
+}
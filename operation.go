@@ -0,0 +1,296 @@
+package vidfusion
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "regexp"
+    "slices"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// 操作参数类型
+const (
+    ParamNumber  = "number"  // 数值，读取为 float64
+    ParamInteger = "integer" // 整数，读取为 int64
+    ParamString  = "string"  // 字符串
+    ParamBool    = "bool"    // 布尔值
+)
+
+// Param 操作参数定义
+type Param struct {
+    Name    string   // 参数名称
+    Type    string   // 参数类型 ParamNumber / ParamInteger / ParamString / ParamBool
+    Default any      // 默认值，为 nil 表示必填
+    Values  []string // 字符串参数的可选值，为空表示不限制
+}
+
+// Operation 片段处理器，通过 RegisterOperation 注册后可以在 VideosOptions 的 Process 和 Ops 中按名称使用
+// Apply 和 Filter 二选一：Apply 以 Go 函数处理当前视频，Filter 是视频滤镜片段，以 {参数名} 引用参数，音频保持不变
+type Operation struct {
+    Params   []Param                                                 // 参数定义，未定义的参数视为错误；使用 Process 时 Params 字段对应第一个参数
+    Apply    func(sdk *VideoSDKV2, params Params)                    // 处理当前视频，出错时通过 sdk 的链式方法记录错误
+    Filter   string                                                  // 视频滤镜片段，例如 "eq=saturation={saturation}"
+    Resize   func(width, height int64, params Params) (int64, int64) // Filter 改变画面尺寸时返回输出尺寸，用于延迟模式推算后续滤镜
+    Check    func(params Params) error                               // 类型检查之后的额外校验，例如取值范围
+    Commands int                                                     // 非延迟模式下执行的 ffmpeg 命令数，用于估算进度，默认 1
+}
+
+// Params 校验后的操作参数，包含默认值
+type Params map[string]any
+
+// Float 读取数值参数
+func (p Params) Float(name string) float64 {
+    switch v := p[name].(type) {
+    case float64:
+        return v
+    case int64:
+        return float64(v)
+    }
+    return 0
+}
+
+// Int 读取整数参数
+func (p Params) Int(name string) int64 {
+    switch v := p[name].(type) {
+    case int64:
+        return v
+    case float64:
+        return int64(v)
+    }
+    return 0
+}
+
+// String 读取字符串参数
+func (p Params) String(name string) string {
+    s, _ := p[name].(string)
+    return s
+}
+
+// Bool 读取布尔参数
+func (p Params) Bool(name string) bool {
+    b, _ := p[name].(bool)
+    return b
+}
+
+// paramPattern 滤镜片段中的参数引用
+var paramPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// operations 已注册的片段处理器
+var operations = struct {
+    sync.RWMutex
+    m map[string]Operation
+}{m: make(map[string]Operation)}
+
+// RegisterOperation 注册片段处理器，名称不能重复
+func RegisterOperation(name string, operation Operation) error {
+    if err := operation.validate(name); err != nil {
+        return fmt.Errorf("register operation %q: %w", name, err)
+    }
+    if operation.Commands <= 0 {
+        operation.Commands = 1
+    }
+    operations.Lock()
+    defer operations.Unlock()
+    if _, ok := operations.m[name]; ok {
+        return fmt.Errorf("register operation %q: already registered", name)
+    }
+    operations.m[name] = operation
+    return nil
+}
+
+// mustRegisterOperation 注册内置片段处理器，失败时 panic
+func mustRegisterOperation(name string, operation Operation) {
+    if err := RegisterOperation(name, operation); err != nil {
+        panic(err)
+    }
+}
+
+// Operations 返回所有已注册的片段处理器名称
+func Operations() []string {
+    operations.RLock()
+    defer operations.RUnlock()
+    names := make([]string, 0, len(operations.m))
+    for name := range operations.m {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// lookupOperation 按名称查找片段处理器
+func lookupOperation(name string) (Operation, bool) {
+    operations.RLock()
+    defer operations.RUnlock()
+    operation, ok := operations.m[name]
+    return operation, ok
+}
+
+// validate 校验处理器定义
+func (o Operation) validate(name string) error {
+    if name == "" {
+        return errors.New("name is required")
+    }
+    if (o.Apply == nil) == (o.Filter == "") {
+        return errors.New("exactly one of Apply and Filter is required")
+    }
+    declared := make(map[string]bool)
+    for _, param := range o.Params {
+        if param.Name == "" || declared[param.Name] {
+            return fmt.Errorf("param name %q is empty or duplicated", param.Name)
+        }
+        declared[param.Name] = true
+        switch param.Type {
+        case ParamNumber, ParamInteger, ParamString, ParamBool:
+        default:
+            return fmt.Errorf("param %s has unknown type %q", param.Name, param.Type)
+        }
+        if param.Default != nil {
+            if _, err := param.convert(param.Default); err != nil {
+                return fmt.Errorf("default of %w", err)
+            }
+        }
+    }
+    for _, match := range paramPattern.FindAllStringSubmatch(o.Filter, -1) {
+        if !declared[match[1]] {
+            return fmt.Errorf("filter references undeclared param %s", match[1])
+        }
+    }
+    return nil
+}
+
+// convert 将原始参数值转换为参数类型
+func (p Param) convert(value any) (any, error) {
+    switch p.Type {
+    case ParamNumber, ParamInteger:
+        var f float64
+        switch v := value.(type) {
+        case float64:
+            f = v
+        case float32:
+            f = float64(v)
+        case int:
+            f = float64(v)
+        case int64:
+            f = float64(v)
+        case json.Number:
+            var err error
+            if f, err = v.Float64(); err != nil {
+                return nil, fmt.Errorf("%s should be a number, but got %v", p.Name, value)
+            }
+        default:
+            return nil, fmt.Errorf("%s should be a number, but got %v", p.Name, value)
+        }
+        if p.Type == ParamNumber {
+            return f, nil
+        }
+        if f != math.Trunc(f) {
+            return nil, fmt.Errorf("%s should be an integer, but got %g", p.Name, f)
+        }
+        return int64(f), nil
+    case ParamString:
+        s, ok := value.(string)
+        if !ok {
+            return nil, fmt.Errorf("%s should be a string, but got %v", p.Name, value)
+        }
+        if len(p.Values) > 0 && !slices.Contains(p.Values, s) {
+            return nil, fmt.Errorf("%s should be %s, but got %q", p.Name, joinOr(p.Values), s)
+        }
+        return s, nil
+    default:
+        b, ok := value.(bool)
+        if !ok {
+            return nil, fmt.Errorf("%s should be a bool, but got %v", p.Name, value)
+        }
+        return b, nil
+    }
+}
+
+// joinOr 以 "a, b or c" 的形式连接可选值
+func joinOr(values []string) string {
+    if len(values) == 1 {
+        return values[0]
+    }
+    return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
+
+// params 按参数定义校验原始参数，补充默认值，未定义的参数视为拼写错误
+func (o Operation) params(raw map[string]any) (Params, error) {
+    params := make(Params, len(o.Params))
+    var errs []error
+    declared := make(map[string]bool)
+    for _, param := range o.Params {
+        declared[param.Name] = true
+        value, ok := raw[param.Name]
+        if !ok {
+            if param.Default == nil {
+                errs = append(errs, fmt.Errorf("%s is required", param.Name))
+                continue
+            }
+            value = param.Default
+        }
+        converted, err := param.convert(value)
+        if err != nil {
+            errs = append(errs, err)
+            continue
+        }
+        params[param.Name] = converted
+    }
+    var unknown []string
+    for name := range raw {
+        if !declared[name] {
+            unknown = append(unknown, name)
+        }
+    }
+    sort.Strings(unknown)
+    if len(unknown) > 0 {
+        errs = append(errs, fmt.Errorf("unknown params %s", strings.Join(unknown, ", ")))
+    }
+    if len(errs) == 0 && o.Check != nil {
+        if err := o.Check(params); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    return params, errors.Join(errs...)
+}
+
+// filter 将参数代入滤镜片段
+func (o Operation) filter(params Params) string {
+    return paramPattern.ReplaceAllStringFunc(o.Filter, func(match string) string {
+        switch v := params[match[1:len(match)-1]].(type) {
+        case float64:
+            return strconv.FormatFloat(v, 'g', -1, 64)
+        case int64:
+            return strconv.FormatInt(v, 10)
+        case bool:
+            if v {
+                return "1"
+            }
+            return "0"
+        case string:
+            return v
+        }
+        return ""
+    })
+}
+
+// compile 校验参数并返回应用处理器的函数
+func (o Operation) compile(name string, raw map[string]any) (func(sdk *VideoSDKV2), error) {
+    params, err := o.params(raw)
+    if err != nil {
+        return nil, err
+    }
+    if o.Apply != nil {
+        return func(sdk *VideoSDKV2) { o.Apply(sdk, params) }, nil
+    }
+    filter := o.filter(params)
+    var resize func(width, height int64) (int64, int64)
+    if o.Resize != nil {
+        resize = func(width, height int64) (int64, int64) { return o.Resize(width, height, params) }
+    }
+    return func(sdk *VideoSDKV2) { sdk.filterVideo(name, filter, resize) }, nil
+}
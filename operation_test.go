@@ -0,0 +1,105 @@
+package vidfusion
+
+import (
+    "fmt"
+    "slices"
+    "strings"
+    "testing"
+)
+
+// TestRegisterOperation 测试注册滤镜片段和 Go 函数形式的处理器并在 ProcessVideos 中使用
+func TestRegisterOperation(t *testing.T) {
+    err := RegisterOperation("test-pixelate", Operation{
+        Params: []Param{
+            {Name: "size", Type: ParamInteger},
+            {Name: "mode", Type: ParamString, Default: "fast", Values: []string{"fast", "smooth"}},
+        },
+        Filter: "scale=iw/{size}:ih/{size}:flags={mode},scale=iw*{size}:ih*{size}:flags=neighbor",
+    })
+    if err != nil {
+        t.Fatalf("RegisterOperation error: %v", err)
+    }
+    var applied []float64
+    err = RegisterOperation("test-boost", Operation{
+        Params: []Param{{Name: "gain", Type: ParamNumber}, {Name: "loud", Type: ParamBool, Default: false}},
+        Apply: func(sdk *VideoSDKV2, params Params) {
+            applied = append(applied, params.Float("gain"))
+            sdk.ScaleUpVideo(params.Float("gain"))
+        },
+        Check: func(params Params) error {
+            if params.Float("gain") > 4 {
+                return fmt.Errorf("gain is too large")
+            }
+            return nil
+        },
+    })
+    if err != nil {
+        t.Fatalf("RegisterOperation error: %v", err)
+    }
+    if names := Operations(); !slices.Contains(names, "test-boost") || !slices.Contains(names, FlipVideo) || !slices.Contains(names, OpColor) {
+        t.Errorf("unexpected operations: %v", names)
+    }
+
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON).On("ffprobe", "format=duration", "8")
+    sdk := NewVideoSDKV2("").WithRunner(runner)
+    sdk.ProcessVideos(ProcessVideosOptions{
+        VideoDuration: 5,
+        Width:         720,
+        Height:        1280,
+        VideosOptions: []VideosOptions{
+            {VideoFile: "1.mp4", Process: "test-boost", Params: 1.5, Ops: []ClipOperation{
+                {Op: "test-pixelate", Params: map[string]any{"size": 8}},
+            }},
+        },
+    })
+    if sdk.Err() != nil {
+        t.Fatalf("ProcessVideos error: %v", sdk.Err())
+    }
+    lines := strings.Join(runner.CommandLines(), "\n")
+    for _, want := range []string{
+        "-i 1.mp4 -vf scale=iw*1.500000:ih*1.500000 ",
+        "-vf scale=iw/8:ih/8:flags=fast,scale=iw*8:ih*8:flags=neighbor -c:v libx264 -c:a copy ",
+    } {
+        if !strings.Contains(lines, want) {
+            t.Errorf("commands should contain %q:\n%s", want, lines)
+        }
+    }
+    if len(applied) != 1 || applied[0] != 1.5 {
+        t.Errorf("Process params should be passed as the first param, but got %v", applied)
+    }
+
+    for _, c := range []struct {
+        options VideosOptions
+        want    string
+    }{
+        {VideosOptions{Process: "test-boost", Params: 5}, "process test-boost: gain is too large"},
+        {VideosOptions{Ops: []ClipOperation{{Op: "test-boost", Params: map[string]any{"gain": 1, "loud": "yes"}}}}, "loud should be a bool"},
+        {VideosOptions{Ops: []ClipOperation{{Op: "test-pixelate", Params: map[string]any{"mode": "slow"}}}}, "test-pixelate: size is required\nmode should be fast or smooth"},
+    } {
+        if err := c.options.Validate(); err == nil || !strings.Contains(err.Error(), c.want) {
+            t.Errorf("%+v should fail with %q, but got %v", c.options, c.want, err)
+        }
+    }
+}
+
+// TestRegisterOperation_Invalid 测试无效的处理器定义
+func TestRegisterOperation_Invalid(t *testing.T) {
+    apply := func(sdk *VideoSDKV2, params Params) {}
+    for name, c := range map[string]struct {
+        operation Operation
+        want      string
+    }{
+        "":               {Operation{Apply: apply}, "name is required"},
+        FlipVideo:        {Operation{Apply: apply}, "already registered"},
+        "test-both":      {Operation{Apply: apply, Filter: "hflip"}, "exactly one of Apply and Filter is required"},
+        "test-none":      {Operation{}, "exactly one of Apply and Filter is required"},
+        "test-type":      {Operation{Apply: apply, Params: []Param{{Name: "a", Type: "float"}}}, `param a has unknown type "float"`},
+        "test-duplicate": {Operation{Apply: apply, Params: []Param{{Name: "a", Type: ParamNumber}, {Name: "a", Type: ParamNumber}}}, `param name "a" is empty or duplicated`},
+        "test-default":   {Operation{Apply: apply, Params: []Param{{Name: "a", Type: ParamInteger, Default: 0.5}}}, "default of a should be an integer"},
+        "test-filter":    {Operation{Filter: "boxblur={radius}"}, "filter references undeclared param radius"},
+    } {
+        if err := RegisterOperation(name, c.operation); err == nil || !strings.Contains(err.Error(), c.want) {
+            t.Errorf("%q should fail with %q, but got %v", name, c.want, err)
+        }
+    }
+}
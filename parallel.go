@@ -0,0 +1,91 @@
+package vidfusion
+
+import (
+    "context"
+    "errors"
+    "sync"
+)
+
+// fork 创建并行处理片段的子实例
+// 子实例共享执行配置和唯一 ID，使用独立的当前文件、滤镜图和临时文件列表，命令进度汇总到当前实例
+func (sdk *VideoSDKV2) fork(ctx context.Context) *VideoSDKV2 {
+    child := &VideoSDKV2{
+        executor: sdk.executor,
+        uniqueID: sdk.uniqueID,
+        lazy:     sdk.lazy,
+        plan:     sdk.plan,
+    }
+    child.ctx = ctx
+    child.progress.fn = sdk.progress.fn
+    child.progress.parent = &sdk.progress
+    return child
+}
+
+// forEach 使用最多 WithParallel 个子实例执行 n 个任务，fn 的 i 为任务序号，调用方按序号保存结果以保证顺序确定
+// 任意任务失败时取消其余正在执行的任务，记录最先发生的错误；子实例创建的临时文件按任务顺序并入当前实例
+func (sdk *VideoSDKV2) forEach(step string, n int, fn func(i int, child *VideoSDKV2) error) *VideoSDKV2 {
+    if sdk.err != nil || n == 0 {
+        return sdk
+    }
+    workers := sdk.parallel
+    // 预演模式下依次执行，保证执行计划中命令和临时文件的顺序确定
+    if workers < 1 || sdk.plan != nil {
+        workers = 1
+    }
+    if workers > n {
+        workers = n
+    }
+    parent := sdk.ctx
+    if parent == nil {
+        parent = context.Background()
+    }
+    ctx, cancel := context.WithCancel(parent)
+    defer cancel()
+
+    children := make([]*VideoSDKV2, n)
+    var once sync.Once
+    var firstErr error
+    jobs := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range jobs {
+                children[i] = sdk.fork(ctx)
+                if err := fn(i, children[i]); err != nil {
+                    once.Do(func() {
+                        firstErr = err
+                        cancel()
+                    })
+                }
+            }
+        }()
+    }
+dispatch:
+    for i := 0; i < n; i++ {
+        select {
+        case jobs <- i:
+        case <-ctx.Done():
+            break dispatch
+        }
+    }
+    close(jobs)
+    wg.Wait()
+
+    for _, child := range children {
+        if child != nil {
+            sdk.tempFiles = append(sdk.tempFiles, child.tempFiles...)
+        }
+    }
+    if firstErr == nil {
+        firstErr = parent.Err()
+    }
+    var stepErr *StepError
+    if errors.As(firstErr, &stepErr) && sdk.err == nil {
+        sdk.err = stepErr
+    } else if firstErr != nil {
+        sdk.fail(step, firstErr)
+    }
+    return sdk
+}
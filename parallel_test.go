@@ -0,0 +1,166 @@
+package vidfusion
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// parallelRunner 模拟耗时不同的 ffmpeg 命令并统计同时执行的命令数
+// 片段时长为 4 秒，参数中包含 slow 的命令耗时更长，包含 bad 的命令失败，包含 hang 的命令一直执行到 ctx 取消
+type parallelRunner struct {
+    mu      sync.Mutex
+    running int
+    peak    int
+    lines   []string
+    concat  string // concat 列表的内容
+}
+
+// Run 执行模拟命令
+func (r *parallelRunner) Run(ctx context.Context, cmd *Command) error {
+    line := cmd.Name + " " + strings.Join(cmd.Args, " ")
+    if cmd.Name == "ffprobe" {
+        output := "4"
+        if strings.Contains(line, "-show_streams") {
+            output = probeJSON
+        }
+        _, _ = cmd.Stdout.Write([]byte(output))
+        return nil
+    }
+    r.mu.Lock()
+    r.lines = append(r.lines, line)
+    r.running++
+    if r.running > r.peak {
+        r.peak = r.running
+    }
+    for i, arg := range cmd.Args {
+        if arg == "concat" && i+4 < len(cmd.Args) {
+            data, _ := os.ReadFile(cmd.Args[i+4])
+            r.concat = string(data)
+        }
+    }
+    r.mu.Unlock()
+    defer func() {
+        r.mu.Lock()
+        r.running--
+        r.mu.Unlock()
+    }()
+    delay := 5 * time.Millisecond
+    switch {
+    case strings.Contains(line, "bad"):
+        return errors.New("exit status 1")
+    case strings.Contains(line, "hang"):
+        delay = time.Minute
+    case strings.Contains(line, "slow"):
+        delay = 30 * time.Millisecond
+    }
+    select {
+    case <-time.After(delay):
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// TestProcessVideos_Parallel 测试并行处理片段时限制进程数并保持片段顺序
+func TestProcessVideos_Parallel(t *testing.T) {
+    runner := &parallelRunner{}
+    sdk := NewVideoSDKV2("").WithRunner(runner).WithParallel(3).WithThreads(2)
+    sdk.ProcessVideos(ProcessVideosOptions{
+        VideoDuration: 20,
+        Width:         720,
+        Height:        1280,
+        VideosOptions: []VideosOptions{
+            {VideoFile: "slow.mp4", Process: FlipVideo},
+            {VideoFile: "2.mp4", Process: FlipVideo},
+            {VideoFile: "3.mp4", Process: FlipVideo},
+            {VideoFile: "4.mp4", Process: FlipVideo},
+        },
+    })
+    if sdk.Err() != nil {
+        t.Fatalf("ProcessVideos error: %v", sdk.Err())
+    }
+    if runner.peak < 2 || runner.peak > 3 {
+        t.Errorf("should run at most 3 ffmpeg processes in parallel, but got %d", runner.peak)
+    }
+    // 4 秒的片段需要 5 段才能达到 20 秒，第一个片段处理最慢但仍然排在最前面
+    files := strings.Split(strings.TrimSpace(runner.concat), "\n")
+    if len(files) != 5 {
+        t.Fatalf("should concat 5 clips, but got %q", runner.concat)
+    }
+    lines := strings.Join(runner.lines, "\n")
+    if !strings.Contains(lines, "-i slow.mp4 -vf hflip -c:v libx264 -threads 2 ") {
+        t.Errorf("thread limit should be passed to ffmpeg, but got:\n%s", lines)
+    }
+    // 根据命令的输入输出追溯 concat 列表中每个文件对应的原始片段
+    source := make(map[string]string)
+    for _, line := range runner.lines {
+        fields := strings.Fields(line)
+        input, output := "", fields[len(fields)-1]
+        for i, field := range fields {
+            if field == "-i" {
+                input = fields[i+1]
+            }
+        }
+        if origin, ok := source[filepath.Base(input)]; ok {
+            input = origin
+        }
+        source[filepath.Base(output)] = input
+    }
+    var order []string
+    for _, file := range files {
+        order = append(order, source[filepath.Base(strings.Trim(strings.TrimPrefix(file, "file "), "'"))])
+    }
+    if got := strings.Join(order, " "); got != "slow.mp4 2.mp4 3.mp4 4.mp4 slow.mp4" {
+        t.Errorf("clips should be concatenated in order, but got %s", got)
+    }
+    sdk.Cleanup()
+}
+
+// TestProcessVideos_ParallelError 测试任意片段失败时取消其余片段并返回第一个错误
+func TestProcessVideos_ParallelError(t *testing.T) {
+    runner := &parallelRunner{}
+    sdk := NewVideoSDKV2("").WithRunner(runner).WithParallel(4)
+    start := time.Now()
+    sdk.ProcessVideos(ProcessVideosOptions{
+        VideoDuration: 20,
+        Width:         720,
+        Height:        1280,
+        VideosOptions: []VideosOptions{
+            {VideoFile: "hang1.mp4", Process: FlipVideo},
+            {VideoFile: "hang2.mp4", Process: FlipVideo},
+            {VideoFile: "bad.mp4", Process: FlipVideo},
+            {VideoFile: "later.mp4", Process: FlipVideo},
+            {VideoFile: "hang3.mp4", Process: FlipVideo},
+        },
+    })
+    if elapsed := time.Since(start); elapsed > 10*time.Second {
+        t.Errorf("siblings should be cancelled, but took %v", elapsed)
+    }
+    var stepErr *StepError
+    if err := sdk.Err(); !errors.As(err, &stepErr) || stepErr.Step != "FlipVideo" || !strings.Contains(err.Error(), "exit status 1") {
+        t.Fatalf("first error should be returned, but got %v", err)
+    }
+    if lines := strings.Join(runner.lines, "\n"); strings.Contains(lines, "scale=720:1280") {
+        t.Errorf("clips should not be scaled after a failure, but got:\n%s", lines)
+    }
+    sdk.Cleanup()
+    for _, file := range sdk.tempFiles {
+        if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+            t.Errorf("temp file %s should be removed", file)
+        }
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    sdk = NewVideoSDKV2("").WithRunner(runner).WithParallel(2).WithContext(ctx)
+    sdk.ProcessVideos(ProcessVideosOptions{VideoDuration: 4, Width: 720, Height: 1280, VideosOptions: []VideosOptions{{VideoFile: "1.mp4"}}})
+    if err := sdk.Err(); !errors.Is(err, context.Canceled) {
+        t.Errorf("cancelled context should fail ProcessVideos, but got %v", err)
+    }
+}
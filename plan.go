@@ -0,0 +1,492 @@
+package vidfusion
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// Plan 预演模式记录的执行计划
+// 临时文件在参数中以 {{tmp1.mp4}} 形式的占位符表示，导出为脚本时替换为工作目录中的文件
+type Plan struct {
+    Commands []PlanCommand `json:"commands"`        // 按执行顺序记录的命令
+    Files    []PlanFile    `json:"files,omitempty"` // 执行命令前需要写入的文件，例如 concat 列表
+}
+
+// PlanCommand 执行计划中的一条命令
+type PlanCommand struct {
+    Step              string   `json:"step"`                         // 所属步骤名称
+    Name              string   `json:"name"`                         // 命令名称，ffmpeg / ffprobe / cp
+    Args              []string `json:"args"`                         // 命令参数
+    Output            string   `json:"output,omitempty"`             // 输出文件
+    EstimatedDuration float64  `json:"estimated_duration,omitempty"` // 预计输出时长（秒），未知时为 0
+}
+
+// PlanFile 执行计划中需要预先写入的文件
+type PlanFile struct {
+    Path    string `json:"path"`    // 文件路径，通常为占位符
+    Content string `json:"content"` // 文件内容
+}
+
+// placeholderPattern 匹配临时文件占位符
+var placeholderPattern = regexp.MustCompile(`\{\{([^{}]+)\}\}`)
+
+// JSON 将执行计划导出为 JSON
+func (p *Plan) JSON() ([]byte, error) {
+    return json.MarshalIndent(p, "", "  ")
+}
+
+// Shell 将执行计划导出为 POSIX shell 脚本，临时文件写入 mktemp 创建的工作目录并在退出时删除
+// ffprobe 查询不影响输出，以注释形式保留
+func (p *Plan) Shell() string {
+    var b strings.Builder
+    b.WriteString("#!/bin/sh\n")
+    b.WriteString("# render plan generated by vidfusion dry run\n")
+    b.WriteString("set -eu\n\n")
+    b.WriteString("WORKDIR=\"$(mktemp -d)\"\n")
+    b.WriteString("trap 'rm -rf \"$WORKDIR\"' EXIT\n")
+    if len(p.Files) > 0 {
+        b.WriteString("\n")
+    }
+    for _, file := range p.Files {
+        fmt.Fprintf(&b, "printf '%%s' %s > %s\n", shellWord(file.Content), shellWord(file.Path))
+    }
+    dirs := map[string]bool{".": true}
+    for _, command := range p.Commands {
+        b.WriteString("\n")
+        if command.EstimatedDuration > 0 {
+            fmt.Fprintf(&b, "# %s (estimated duration %.2fs)\n", command.Step, command.EstimatedDuration)
+        } else {
+            fmt.Fprintf(&b, "# %s\n", command.Step)
+        }
+        // 最终输出文件所在目录可能不存在
+        if command.Output != "" && !placeholderPattern.MatchString(command.Output) {
+            if dir := filepath.Dir(command.Output); !dirs[dir] {
+                dirs[dir] = true
+                fmt.Fprintf(&b, "mkdir -p %s\n", shellWord(dir))
+            }
+        }
+        words := []string{shellWord(command.Name)}
+        for _, arg := range command.Args {
+            words = append(words, shellWord(arg))
+        }
+        if command.Name == "ffprobe" {
+            b.WriteString("# ")
+        }
+        b.WriteString(strings.Join(words, " ") + "\n")
+    }
+    return b.String()
+}
+
+// safeShellWord 不需要引号的 shell 参数
+var safeShellWord = regexp.MustCompile(`^[A-Za-z0-9_./:=,+@%-]+$`)
+
+// shellWord 将参数转换为 shell 单词，占位符替换为工作目录中的文件，其余部分使用单引号转义
+func shellWord(arg string) string {
+    if !placeholderPattern.MatchString(arg) {
+        return shellQuote(arg)
+    }
+    var b strings.Builder
+    last := 0
+    for _, match := range placeholderPattern.FindAllStringSubmatchIndex(arg, -1) {
+        if match[0] > last {
+            b.WriteString(shellQuote(arg[last:match[0]]))
+        }
+        b.WriteString(`"$WORKDIR"/` + shellQuote(arg[match[2]:match[3]]))
+        last = match[1]
+    }
+    if last < len(arg) {
+        b.WriteString(shellQuote(arg[last:]))
+    }
+    return b.String()
+}
+
+// shellQuote 使用单引号转义参数
+func shellQuote(arg string) string {
+    if safeShellWord.MatchString(arg) {
+        return arg
+    }
+    return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// PlanRunner 预演模式使用的 Runner，只记录 ffmpeg 命令而不执行
+// 对计划生成的文件的 ffprobe 查询使用预计的媒体信息回答，对已存在的源文件的查询交给 probe 执行
+type PlanRunner struct {
+    mu        sync.Mutex
+    probe     Runner                // 执行源文件 ffprobe 查询的 Runner
+    plan      Plan                  // 已记录的执行计划
+    temps     map[string]string     // 临时文件路径 -> 占位符
+    media     map[string]*MediaInfo // 文件路径 -> 预计或探测到的媒体信息
+    written   map[string]bool       // 已记录内容的临时文件
+    tempCount int
+}
+
+// NewPlanRunner 创建 PlanRunner，probe 为空时使用 ExecRunner 探测源文件
+func NewPlanRunner(probe Runner) *PlanRunner {
+    if probe == nil {
+        probe = ExecRunner{}
+    }
+    return &PlanRunner{
+        probe:   probe,
+        temps:   map[string]string{},
+        media:   map[string]*MediaInfo{},
+        written: map[string]bool{},
+    }
+}
+
+// Plan 返回已记录的执行计划
+func (p *PlanRunner) Plan() *Plan {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    return &Plan{
+        Commands: append([]PlanCommand(nil), p.plan.Commands...),
+        Files:    append([]PlanFile(nil), p.plan.Files...),
+    }
+}
+
+// addTemp 登记临时文件，记录时替换为占位符
+func (p *PlanRunner) addTemp(file string) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if _, ok := p.temps[file]; ok {
+        return
+    }
+    p.tempCount++
+    p.temps[file] = fmt.Sprintf("{{tmp%d%s}}", p.tempCount, filepath.Ext(file))
+}
+
+// placeholder 将文本中登记过的临时文件路径替换为占位符
+func (p *PlanRunner) placeholder(text string) string {
+    for file, placeholder := range p.temps {
+        text = strings.ReplaceAll(text, file, placeholder)
+    }
+    return text
+}
+
+// record 记录一条命令，参数中的临时文件替换为占位符
+func (p *PlanRunner) record(step, name string, args []string, output string, duration float64) {
+    command := PlanCommand{Step: step, Name: name, Output: p.placeholder(output), EstimatedDuration: duration}
+    for _, arg := range args {
+        command.Args = append(command.Args, p.placeholder(arg))
+    }
+    p.plan.Commands = append(p.plan.Commands, command)
+}
+
+// recordCopy 记录将 src 复制到 dst 的命令，用于非延迟模式下的 Finalize
+func (p *PlanRunner) recordCopy(step, src, dst string) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    var duration float64
+    if info := p.media[src]; info != nil {
+        duration = info.Format.Duration
+        p.media[dst] = info
+    }
+    p.record(step, "cp", []string{src, dst}, dst, duration)
+}
+
+// Run 记录命令，ffmpeg 命令不会执行，只根据输入推算输出文件的媒体信息
+func (p *PlanRunner) Run(ctx context.Context, cmd *Command) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    switch cmd.Name {
+    case "ffprobe":
+        return p.runProbe(ctx, cmd)
+    case "ffmpeg":
+        return p.runFFmpeg(ctx, cmd)
+    }
+    p.record(cmd.Step, cmd.Name, cmd.Args, "", 0)
+    return nil
+}
+
+// runProbe 回答 ffprobe 查询，计划生成的文件使用预计的媒体信息，其余文件交给 probe 执行
+func (p *PlanRunner) runProbe(ctx context.Context, cmd *Command) error {
+    p.record(cmd.Step, cmd.Name, cmd.Args, "", 0)
+    file := probeTarget(cmd.Args)
+    info, planned := p.media[file]
+    if !planned || !p.isPlanned(file) {
+        return p.probe.Run(ctx, cmd)
+    }
+    joined := strings.Join(cmd.Args, " ")
+    var output string
+    switch {
+    case strings.Contains(joined, "-print_format json"):
+        data, err := mediaInfoJSON(info)
+        if err != nil {
+            return err
+        }
+        output = string(data)
+    case strings.Contains(joined, "stream=width,height"):
+        if video := info.VideoStream(); video != nil {
+            output = fmt.Sprintf("%dx%d\n", video.Width, video.Height)
+        }
+    default:
+        output = strconv.FormatFloat(info.Format.Duration, 'f', 6, 64) + "\n"
+    }
+    if cmd.Stdout != nil {
+        _, _ = cmd.Stdout.Write([]byte(output))
+    }
+    return nil
+}
+
+// isPlanned 文件是否由计划中的命令生成
+func (p *PlanRunner) isPlanned(file string) bool {
+    placeholder := p.placeholder(file)
+    for _, command := range p.plan.Commands {
+        if command.Output != "" && command.Output == placeholder {
+            return true
+        }
+    }
+    return false
+}
+
+// runFFmpeg 记录 ffmpeg 命令并推算输出文件的媒体信息
+func (p *PlanRunner) runFFmpeg(ctx context.Context, cmd *Command) error {
+    inputs := ffmpegInputs(cmd.Args)
+    output := cmd.Args[len(cmd.Args)-1]
+    var main *MediaInfo
+    var inputDuration float64
+    hasAudio := false
+    for i, input := range inputs {
+        var info *MediaInfo
+        switch input.format {
+        case "lavfi":
+            hasAudio = hasAudio || strings.Contains(input.file, "anullsrc")
+            continue
+        case "concat":
+            info = p.concatInfo(ctx, input.file)
+        default:
+            info = p.mediaInfo(ctx, input.file)
+        }
+        if info == nil {
+            continue
+        }
+        hasAudio = hasAudio || info.HasAudio()
+        if i == 0 {
+            main, inputDuration = info, info.Format.Duration
+        }
+    }
+    duration := inputDuration
+    if cmd.Duration != nil {
+        if estimated := cmd.Duration(inputDuration); estimated > 0 {
+            duration = estimated
+        }
+    }
+    p.media[output] = estimateMediaInfo(main, output, duration, hasAudio, cmd.Args)
+    p.record(cmd.Step, cmd.Name, cmd.Args, output, duration)
+    return nil
+}
+
+// mediaInfo 返回文件的媒体信息，源文件使用 probe 探测并缓存，探测失败时返回 nil
+func (p *PlanRunner) mediaInfo(ctx context.Context, file string) *MediaInfo {
+    if info, ok := p.media[file]; ok {
+        return info
+    }
+    var stdout, stderr bytes.Buffer
+    var info *MediaInfo
+    if err := p.probe.Run(ctx, &Command{Name: "ffprobe", Args: probeArgs(file), Stdout: &stdout, Stderr: &stderr}); err == nil {
+        info, _ = parseMediaInfo(stdout.Bytes())
+    }
+    p.media[file] = info
+    return info
+}
+
+// concatInfo 读取 concat 列表，记录列表内容并汇总所有片段的时长
+func (p *PlanRunner) concatInfo(ctx context.Context, listFile string) *MediaInfo {
+    data, err := os.ReadFile(listFile)
+    if err != nil {
+        return nil
+    }
+    if _, ok := p.temps[listFile]; ok && !p.written[listFile] {
+        p.written[listFile] = true
+        p.plan.Files = append(p.plan.Files, PlanFile{Path: p.placeholder(listFile), Content: p.placeholder(string(data))})
+    }
+    var first *MediaInfo
+    var total float64
+    for _, line := range strings.Split(string(data), "\n") {
+        file, ok := strings.CutPrefix(strings.TrimSpace(line), "file ")
+        if !ok {
+            continue
+        }
+        info := p.mediaInfo(ctx, strings.Trim(file, "'"))
+        if info == nil {
+            continue
+        }
+        if first == nil {
+            first = info
+        }
+        total += info.Format.Duration
+    }
+    if first == nil {
+        return nil
+    }
+    info := *first
+    info.Format.Duration = total
+    return &info
+}
+
+// probeTarget 返回 ffprobe 查询的文件，即 -i 之后的参数或最后一个参数
+func probeTarget(args []string) string {
+    for i, arg := range args {
+        if arg == "-i" && i+1 < len(args) {
+            return args[i+1]
+        }
+    }
+    if len(args) == 0 {
+        return ""
+    }
+    return args[len(args)-1]
+}
+
+// plannedInput ffmpeg 命令的一个输入
+type plannedInput struct {
+    format string // -f 指定的输入格式
+    file   string // 输入文件
+}
+
+// ffmpegInputs 解析 ffmpeg 参数中的所有输入
+func ffmpegInputs(args []string) []plannedInput {
+    var inputs []plannedInput
+    format := ""
+    for i := 0; i < len(args)-1; i++ {
+        switch args[i] {
+        case "-f":
+            format = args[i+1]
+            i++
+        case "-i":
+            inputs = append(inputs, plannedInput{format: format, file: args[i+1]})
+            format = ""
+            i++
+        }
+    }
+    return inputs
+}
+
+var (
+    // scalePattern 匹配固定尺寸的 scale 滤镜
+    scalePattern = regexp.MustCompile(`scale=(\d+):(\d+)`)
+    // scaleRatioPattern 匹配按倍数缩放的 scale 滤镜
+    scaleRatioPattern = regexp.MustCompile(`scale=iw\*([\d.]+):ih\*([\d.]+)`)
+)
+
+// estimateMediaInfo 根据主输入和命令参数推算输出文件的媒体信息
+func estimateMediaInfo(main *MediaInfo, output string, duration float64, hasAudio bool, args []string) *MediaInfo {
+    info := &MediaInfo{Format: FormatInfo{Filename: output, Duration: duration}}
+    if main != nil {
+        info.Format.FormatName = main.Format.FormatName
+        if video := main.VideoStream(); video != nil {
+            stream := *video
+            stream.Index = 0
+            stream.Duration = duration
+            info.Streams = append(info.Streams, stream)
+        }
+    }
+    video := info.VideoStream()
+    // 重新编码时 ffmpeg 按旋转角度自动旋转画面，输出不再带有旋转元数据
+    if video != nil && video.Rotation != 0 && !copiesVideo(args) {
+        video.Width, video.Height = video.DisplaySize()
+        video.Rotation = 0
+    }
+    for _, arg := range args {
+        // 图片水印的缩放不影响输出尺寸
+        for _, chain := range strings.Split(arg, ";") {
+            if video == nil || strings.Contains(chain, "[img") {
+                continue
+            }
+            if match := scalePattern.FindStringSubmatch(chain); match != nil {
+                video.Width, video.Height = parseInt(match[1]), parseInt(match[2])
+            } else if match := scaleRatioPattern.FindStringSubmatch(chain); match != nil {
+                video.Width = int64(float64(video.Width) * parseFloat(match[1]))
+                video.Height = int64(float64(video.Height) * parseFloat(match[2]))
+            }
+        }
+        if arg == "-an" {
+            hasAudio = false
+        }
+    }
+    if hasAudio {
+        audio := StreamInfo{Index: len(info.Streams), CodecType: "audio", CodecName: "aac", SampleRate: 44100, Channels: 2, ChannelLayout: "stereo", Duration: duration}
+        if main != nil {
+            if stream := main.AudioStream(); stream != nil {
+                audio = *stream
+                audio.Index = len(info.Streams)
+                audio.Duration = duration
+            }
+        }
+        info.Streams = append(info.Streams, audio)
+    }
+    return info
+}
+
+// copiesVideo 命令是否直接复制视频流
+func copiesVideo(args []string) bool {
+    for i := 0; i+1 < len(args); i++ {
+        if (args[i] == "-c:v" || args[i] == "-c") && args[i+1] == "copy" {
+            return true
+        }
+    }
+    return false
+}
+
+// mediaInfoJSON 将媒体信息转换为 ffprobe -print_format json 格式的输出
+func mediaInfoJSON(info *MediaInfo) ([]byte, error) {
+    streams := []map[string]any{}
+    for _, stream := range info.Streams {
+        streams = append(streams, map[string]any{
+            "index":          stream.Index,
+            "codec_type":     stream.CodecType,
+            "codec_name":     stream.CodecName,
+            "pix_fmt":        stream.PixelFormat,
+            "width":          stream.Width,
+            "height":         stream.Height,
+            "r_frame_rate":   strconv.FormatFloat(stream.FrameRate, 'f', -1, 64),
+            "avg_frame_rate": strconv.FormatFloat(stream.AvgFrameRate, 'f', -1, 64),
+            "sample_rate":    strconv.FormatInt(stream.SampleRate, 10),
+            "channels":       stream.Channels,
+            "channel_layout": stream.ChannelLayout,
+            "duration":       strconv.FormatFloat(stream.Duration, 'f', 6, 64),
+            "tags":           map[string]string{"rotate": strconv.FormatInt(stream.Rotation, 10)},
+        })
+    }
+    return json.Marshal(map[string]any{
+        "format": map[string]any{
+            "filename":    info.Format.Filename,
+            "format_name": info.Format.FormatName,
+            "duration":    strconv.FormatFloat(info.Format.Duration, 'f', 6, 64),
+        },
+        "streams": streams,
+    })
+}
+
+// DryRun 开启预演模式：ffmpeg 命令只记录到执行计划中而不执行，临时文件以占位符表示，
+// 源文件的 ffprobe 查询交给之前设置的 Runner 执行，计划生成的文件使用推算的时长和尺寸回答，
+// Finalize 不会生成文件，通过 Plan 获取执行计划。需要在 WithRunner 之后调用
+func (sdk *VideoSDKV2) DryRun() *VideoSDKV2 {
+    sdk.plan = NewPlanRunner(sdk.getRunner())
+    sdk.runner = sdk.plan
+    return sdk
+}
+
+// Plan 返回预演模式记录的执行计划，未开启预演模式时返回 nil
+func (sdk *VideoSDKV2) Plan() *Plan {
+    if sdk.plan == nil {
+        return nil
+    }
+    return sdk.plan.Plan()
+}
+
+// planTemp 预演模式下登记临时文件，记录执行计划时替换为占位符
+func (sdk *VideoSDKV2) planTemp(file string) {
+    if sdk.plan != nil {
+        sdk.plan.addTemp(file)
+    }
+}
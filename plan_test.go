@@ -0,0 +1,124 @@
+package vidfusion
+
+import (
+    "encoding/json"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// TestDryRun 测试预演模式只记录命令，并用推算的时长回答后续查询
+func TestDryRun(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner).DryRun()
+    sdk.FlipVideo().SpeedUpVideo(2)
+    // 查询计划生成的文件时使用推算的时长
+    if duration, err := sdk.GetVideoDuration(sdk.CurrentFile); err != nil || duration != 6.006 {
+        t.Errorf("2x speed up should be estimated as 6.006s, but got %v %v", duration, err)
+    }
+    output := filepath.Join(t.TempDir(), "out", "final.mp4")
+    if _, err := sdk.Finalize(output); err != nil {
+        t.Fatalf("Finalize error: %v", err)
+    }
+    // 只有源文件的探测交给 FakeRunner 执行
+    if lines := runner.CommandLines(); len(lines) != 1 || !strings.Contains(lines[0], "in.mp4") {
+        t.Errorf("only the source file should be probed, but got %v", lines)
+    }
+    plan := sdk.Plan()
+    var names []string
+    for _, command := range plan.Commands {
+        names = append(names, command.Step+":"+command.Name)
+    }
+    want := "FlipVideo:ffmpeg SpeedUpVideo:ffmpeg GetVideoDuration:ffprobe Finalize:cp"
+    if strings.Join(names, " ") != want {
+        t.Fatalf("unexpected plan:\n got: %s\nwant: %s", strings.Join(names, " "), want)
+    }
+    speed := plan.Commands[1]
+    if speed.EstimatedDuration != 6.006 {
+        t.Errorf("2x speed up should be estimated as 6.006s, but got %v", speed.EstimatedDuration)
+    }
+    if strings.Join(speed.Args, " ") != "-y -i {{tmp1.mp4}} -filter:v setpts=0.500000*PTS -c:v libx264 -filter:a atempo=2 -c:a aac {{tmp2.mp4}}" {
+        t.Errorf("temp files should be replaced with placeholders, but got %v", speed.Args)
+    }
+    final := plan.Commands[3]
+    if final.Output != output || final.EstimatedDuration != 6.006 || strings.Join(final.Args, " ") != "{{tmp2.mp4}} "+output {
+        t.Errorf("unexpected finalize command: %+v", final)
+    }
+
+    script := plan.Shell()
+    for _, line := range []string{
+        `WORKDIR="$(mktemp -d)"`,
+        `ffmpeg -y -i in.mp4 -vf hflip -c:v libx264 -c:a copy "$WORKDIR"/tmp1.mp4`,
+        `# ffprobe -i "$WORKDIR"/tmp2.mp4 -show_entries format=duration -v quiet -of csv=p=0`,
+        "mkdir -p " + filepath.Dir(output),
+        `cp "$WORKDIR"/tmp2.mp4 ` + output,
+    } {
+        if !strings.Contains(script, line+"\n") {
+            t.Errorf("shell script should contain %q:\n%s", line, script)
+        }
+    }
+
+    data, err := plan.JSON()
+    if err != nil {
+        t.Fatal(err)
+    }
+    var decoded Plan
+    if err := json.Unmarshal(data, &decoded); err != nil || len(decoded.Commands) != len(plan.Commands) || decoded.Commands[1].EstimatedDuration != 6.006 {
+        t.Errorf("JSON plan should round trip, but got %s %v", data, err)
+    }
+}
+
+// TestDryRun_ProcessVideos 测试预演 ProcessVideos，concat 列表内容记录到执行计划中
+func TestDryRun_ProcessVideos(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON).On("ffprobe", "format=duration", "12.012")
+    sdk := NewVideoSDKV2("").WithRunner(runner).DryRun()
+    sdk.ProcessVideos(ProcessVideosOptions{
+        VideoDuration: 20,
+        Width:         720,
+        Height:        1280,
+        VideosOptions: []VideosOptions{{VideoFile: "1.mp4", Process: FlipVideo}, {VideoFile: "2.mp4"}},
+    })
+    if sdk.Err() != nil {
+        t.Fatalf("ProcessVideos error: %v", sdk.Err())
+    }
+    if count := countCommands(runner, "ffmpeg"); count != 0 {
+        t.Errorf("dry run should not run ffmpeg, but got %v", runner.CommandLines())
+    }
+    plan := sdk.Plan()
+    if len(plan.Files) != 1 || strings.Count(plan.Files[0].Content, "file '{{tmp") != 2 {
+        t.Fatalf("concat list should be recorded with placeholders, but got %+v", plan.Files)
+    }
+    var concat *PlanCommand
+    for i, command := range plan.Commands {
+        if command.Step == "ConcatenateVideos" && strings.Contains(strings.Join(command.Args, " "), "-f concat") {
+            concat = &plan.Commands[i]
+        }
+    }
+    if concat == nil || concat.EstimatedDuration != 24.024 {
+        t.Errorf("concat should be estimated as the sum of both clips, but got %+v", concat)
+    }
+    last := plan.Commands[len(plan.Commands)-1]
+    if last.Step != "CropVideoTimeline" || last.EstimatedDuration != 20 {
+        t.Errorf("final trim should be estimated as 20s, but got %+v", last)
+    }
+    if script := plan.Shell(); !strings.Contains(script, `printf '%s' 'file '\'''"$WORKDIR"/tmp`) {
+        t.Errorf("shell script should write the concat list:\n%s", script)
+    }
+    sdk.Cleanup()
+}
+
+// Test_shellWord 测试 shell 参数转义和占位符替换
+func Test_shellWord(t *testing.T) {
+    for arg, want := range map[string]string{
+        "in.mp4":                     "in.mp4",
+        "":                           "''",
+        "my file.mp4":                "'my file.mp4'",
+        "it's":                       `'it'\''s'`,
+        "{{tmp1.mp4}}":               `"$WORKDIR"/tmp1.mp4`,
+        "subtitles='{{tmp2.srt}}'x":  `'subtitles='\'''"$WORKDIR"/tmp2.srt''\''x'`,
+    } {
+        if got := shellWord(arg); got != want {
+            t.Errorf("shellWord(%q) should be %s, but got %s", arg, want, got)
+        }
+    }
+}
@@ -0,0 +1,246 @@
+package vidfusion
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// MediaInfo ffprobe 探测到的媒体信息
+type MediaInfo struct {
+    Format  FormatInfo   `json:"format"`  // 容器信息
+    Streams []StreamInfo `json:"streams"` // 所有流
+}
+
+// FormatInfo 容器信息
+type FormatInfo struct {
+    Filename   string            `json:"filename"`       // 文件路径
+    FormatName string            `json:"format_name"`    // 容器格式，例如 mov,mp4,m4a,3gp,3g2,mj2
+    Duration   float64           `json:"duration"`       // 容器时长（秒）
+    Size       int64             `json:"size"`           // 文件大小（字节）
+    BitRate    int64             `json:"bit_rate"`       // 总比特率
+    Tags       map[string]string `json:"tags,omitempty"` // 容器标签
+}
+
+// StreamInfo 单个流的信息
+type StreamInfo struct {
+    Index          int               `json:"index"`                          // 流序号
+    CodecType      string            `json:"codec_type"`                     // 流类型 video / audio / subtitle / data
+    CodecName      string            `json:"codec_name"`                     // 编码格式，例如 h264、aac
+    Profile        string            `json:"profile,omitempty"`              // 编码 profile，例如 High
+    Level          int64             `json:"level,omitempty"`                // 编码 level，例如 40 表示 H.264 Level 4.0
+    CodecTag       string            `json:"codec_tag,omitempty"`            // 容器中的编码标签，例如 avc1、hvc1
+    PixelFormat    string            `json:"pix_fmt,omitempty"`              // 像素格式，例如 yuv420p
+    Width          int64             `json:"width,omitempty"`                // 存储宽度
+    Height         int64             `json:"height,omitempty"`               // 存储高度
+    SampleAspect   string            `json:"sample_aspect_ratio,omitempty"`  // 像素宽高比，例如 1:1
+    DisplayAspect  string            `json:"display_aspect_ratio,omitempty"` // 显示宽高比，例如 9:16
+    FrameRate      float64           `json:"r_frame_rate,omitempty"`         // 帧率（r_frame_rate）
+    AvgFrameRate   float64           `json:"avg_frame_rate,omitempty"`       // 平均帧率（avg_frame_rate）
+    SampleRate     int64             `json:"sample_rate,omitempty"`          // 音频采样率
+    Channels       int64             `json:"channels,omitempty"`             // 音频声道数
+    ChannelLayout  string            `json:"channel_layout,omitempty"`       // 音频声道布局，例如 stereo
+    BitRate        int64             `json:"bit_rate"`                       // 流比特率
+    Duration       float64           `json:"duration"`                       // 流时长（秒）
+    Rotation       int64             `json:"rotation,omitempty"`             // 显示时顺时针旋转的角度，取值 0 / 90 / 180 / 270
+    ColorRange     string            `json:"color_range,omitempty"`          // 色彩范围，例如 tv
+    ColorSpace     string            `json:"color_space,omitempty"`          // 色彩空间，例如 bt709
+    ColorTransfer  string            `json:"color_transfer,omitempty"`       // 传输特性，例如 bt709
+    ColorPrimaries string            `json:"color_primaries,omitempty"`      // 色域，例如 bt709
+    Language       string            `json:"language,omitempty"`             // 语言标签
+    AttachedPic    bool              `json:"attached_pic,omitempty"`         // 是否为封面图片等附加图片（disposition.attached_pic）
+    Tags           map[string]string `json:"tags,omitempty"`                 // 流标签
+}
+
+// DisplaySize 返回按旋转角度显示时的宽高，旋转 90 / 270 度时宽高互换；ffmpeg 解码时默认按旋转角度自动旋转，滤镜看到的是显示尺寸
+func (s StreamInfo) DisplaySize() (int64, int64) {
+    if s.Rotation%180 != 0 {
+        return s.Height, s.Width
+    }
+    return s.Width, s.Height
+}
+
+// IsVideo 是否为视频流，封面图片等附加图片流不算视频流
+func (s StreamInfo) IsVideo() bool {
+    return s.CodecType == "video" && !s.AttachedPic
+}
+
+// IsAudio 是否为音频流
+func (s StreamInfo) IsAudio() bool {
+    return s.CodecType == "audio"
+}
+
+// VideoStream 返回第一个视频流，没有视频流时返回 nil
+func (m *MediaInfo) VideoStream() *StreamInfo {
+    for i := range m.Streams {
+        if m.Streams[i].IsVideo() {
+            return &m.Streams[i]
+        }
+    }
+    return nil
+}
+
+// AudioStream 返回第一个音频流，没有音频流时返回 nil
+func (m *MediaInfo) AudioStream() *StreamInfo {
+    for i := range m.Streams {
+        if m.Streams[i].IsAudio() {
+            return &m.Streams[i]
+        }
+    }
+    return nil
+}
+
+// HasAudio 是否包含音频流
+func (m *MediaInfo) HasAudio() bool {
+    return m.AudioStream() != nil
+}
+
+// ffprobeOutput ffprobe -print_format json 的输出结构
+type ffprobeOutput struct {
+    Format struct {
+        Filename   string            `json:"filename"`
+        FormatName string            `json:"format_name"`
+        Duration   string            `json:"duration"`
+        Size       string            `json:"size"`
+        BitRate    string            `json:"bit_rate"`
+        Tags       map[string]string `json:"tags"`
+    } `json:"format"`
+    Streams []struct {
+        Index              int               `json:"index"`
+        CodecType          string            `json:"codec_type"`
+        CodecName          string            `json:"codec_name"`
+        Profile            string            `json:"profile"`
+        Level              int64             `json:"level"`
+        CodecTagString     string            `json:"codec_tag_string"`
+        PixFmt             string            `json:"pix_fmt"`
+        Width              int64             `json:"width"`
+        Height             int64             `json:"height"`
+        SampleAspectRatio  string            `json:"sample_aspect_ratio"`
+        DisplayAspectRatio string            `json:"display_aspect_ratio"`
+        RFrameRate         string            `json:"r_frame_rate"`
+        AvgFrameRate       string            `json:"avg_frame_rate"`
+        SampleRate         string            `json:"sample_rate"`
+        Channels           int64             `json:"channels"`
+        ChannelLayout      string            `json:"channel_layout"`
+        BitRate            string            `json:"bit_rate"`
+        Duration           string            `json:"duration"`
+        ColorRange         string            `json:"color_range"`
+        ColorSpace         string            `json:"color_space"`
+        ColorTransfer      string            `json:"color_transfer"`
+        ColorPrimaries     string            `json:"color_primaries"`
+        Tags               map[string]string `json:"tags"`
+        Disposition        struct {
+            AttachedPic int `json:"attached_pic"`
+        } `json:"disposition"`
+        SideDataList []struct {
+            SideDataType string  `json:"side_data_type"`
+            Rotation     float64 `json:"rotation"`
+        } `json:"side_data_list"`
+    } `json:"streams"`
+}
+
+// probeArgs 探测媒体信息的 ffprobe 参数
+func probeArgs(file string) []string {
+    return []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams", file}
+}
+
+// parseMediaInfo 解析 ffprobe 的 JSON 输出
+func parseMediaInfo(data []byte) (*MediaInfo, error) {
+    var output ffprobeOutput
+    if err := json.Unmarshal(data, &output); err != nil {
+        return nil, fmt.Errorf("failed to parse ffprobe output: %v", err)
+    }
+    info := &MediaInfo{
+        Format: FormatInfo{
+            Filename:   output.Format.Filename,
+            FormatName: output.Format.FormatName,
+            Duration:   parseFloat(output.Format.Duration),
+            Size:       parseInt(output.Format.Size),
+            BitRate:    parseInt(output.Format.BitRate),
+            Tags:       output.Format.Tags,
+        },
+    }
+    for _, stream := range output.Streams {
+        streamInfo := StreamInfo{
+            Index:          stream.Index,
+            CodecType:      stream.CodecType,
+            CodecName:      stream.CodecName,
+            Profile:        stream.Profile,
+            Level:          stream.Level,
+            CodecTag:       stream.CodecTagString,
+            PixelFormat:    stream.PixFmt,
+            Width:          stream.Width,
+            Height:         stream.Height,
+            SampleAspect:   stream.SampleAspectRatio,
+            DisplayAspect:  stream.DisplayAspectRatio,
+            FrameRate:      parseRational(stream.RFrameRate),
+            AvgFrameRate:   parseRational(stream.AvgFrameRate),
+            SampleRate:     parseInt(stream.SampleRate),
+            Channels:       stream.Channels,
+            ChannelLayout:  stream.ChannelLayout,
+            BitRate:        parseInt(stream.BitRate),
+            Duration:       parseFloat(stream.Duration),
+            ColorRange:     stream.ColorRange,
+            ColorSpace:     stream.ColorSpace,
+            ColorTransfer:  stream.ColorTransfer,
+            ColorPrimaries: stream.ColorPrimaries,
+            Language:       stream.Tags["language"],
+            AttachedPic:    stream.Disposition.AttachedPic == 1,
+            Tags:           stream.Tags,
+        }
+        // 旧版本 ffprobe 使用 rotate 标签，新版本使用 Display Matrix 附加数据（逆时针角度）
+        if rotate, ok := stream.Tags["rotate"]; ok {
+            streamInfo.Rotation = normalizeRotation(parseFloat(rotate))
+        } else {
+            for _, sideData := range stream.SideDataList {
+                if sideData.SideDataType == "Display Matrix" {
+                    streamInfo.Rotation = normalizeRotation(-sideData.Rotation)
+                }
+            }
+        }
+        info.Streams = append(info.Streams, streamInfo)
+    }
+    return info, nil
+}
+
+// normalizeRotation 将角度归一化到 0 / 90 / 180 / 270
+func normalizeRotation(degrees float64) int64 {
+    rotation := int64(math.Round(degrees/90)) * 90 % 360
+    if rotation < 0 {
+        rotation += 360
+    }
+    return rotation
+}
+
+// parseRational 解析 30000/1001 形式的分数，无法解析或分母为 0 时返回 0
+func parseRational(value string) float64 {
+    num, den, ok := strings.Cut(value, "/")
+    if !ok {
+        return parseFloat(value)
+    }
+    d := parseFloat(den)
+    if d == 0 {
+        return 0
+    }
+    return parseFloat(num) / d
+}
+
+// parseFloat 解析浮点数，ffprobe 中的 N/A 等无法解析的值返回 0
+func parseFloat(value string) float64 {
+    f, err := strconv.ParseFloat(value, 64)
+    if err != nil {
+        return 0
+    }
+    return f
+}
+
+// parseInt 解析整数，无法解析的值返回 0
+func parseInt(value string) int64 {
+    i, err := strconv.ParseInt(value, 10, 64)
+    if err != nil {
+        return 0
+    }
+    return i
+}
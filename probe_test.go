@@ -0,0 +1,107 @@
+package vidfusion
+
+import (
+    "strings"
+    "testing"
+)
+
+// probeJSON 竖屏手机视频的 ffprobe 输出示例
+const probeJSON = `{
+    "streams": [
+        {
+            "index": 0, "codec_name": "h264", "profile": "High", "codec_type": "video",
+            "width": 1920, "height": 1080, "sample_aspect_ratio": "1:1", "display_aspect_ratio": "16:9",
+            "pix_fmt": "yuv420p", "color_range": "tv", "color_space": "bt709", "color_transfer": "bt709", "color_primaries": "bt709",
+            "r_frame_rate": "30000/1001", "avg_frame_rate": "30000/1001", "duration": "12.012000", "bit_rate": "15000000",
+            "tags": {"language": "und"},
+            "side_data_list": [{"side_data_type": "Display Matrix", "displaymatrix": "...", "rotation": -90}]
+        },
+        {
+            "index": 1, "codec_name": "aac", "profile": "LC", "codec_type": "audio",
+            "sample_rate": "48000", "channels": 2, "channel_layout": "stereo",
+            "r_frame_rate": "0/0", "duration": "12.000000", "bit_rate": "192000",
+            "tags": {"language": "eng"}
+        }
+    ],
+    "format": {
+        "filename": "phone.mov", "format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+        "duration": "12.012000", "size": "22800000", "bit_rate": "15184815",
+        "tags": {"major_brand": "qt  "}
+    }
+}`
+
+// TestProbe 使用 FakeRunner 测试解析 ffprobe JSON 输出
+func TestProbe(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    info, err := NewVideoSDK().WithRunner(runner).Probe("phone.mov")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if lines := runner.CommandLines(); len(lines) != 1 || lines[0] != "ffprobe -v error -print_format json -show_format -show_streams phone.mov" {
+        t.Errorf("unexpected ffprobe command: %v", lines)
+    }
+    if info.Format.Duration != 12.012 || info.Format.Size != 22800000 || !strings.HasPrefix(info.Format.FormatName, "mov") {
+        t.Errorf("unexpected format: %+v", info.Format)
+    }
+    video := info.VideoStream()
+    if video == nil || video.Width != 1920 || video.Height != 1080 || video.PixelFormat != "yuv420p" || video.Profile != "High" {
+        t.Fatalf("unexpected video stream: %+v", video)
+    }
+    if video.Rotation != 90 || video.ColorSpace != "bt709" || video.FrameRate < 29.97 || video.FrameRate > 29.98 {
+        t.Errorf("unexpected video metadata: %+v", video)
+    }
+    audio := info.AudioStream()
+    if audio == nil || audio.SampleRate != 48000 || audio.Channels != 2 || audio.Language != "eng" || audio.FrameRate != 0 {
+        t.Errorf("unexpected audio stream: %+v", audio)
+    }
+}
+
+// TestProbe_AttachedPic 测试 MJPEG 编码的视频是视频流，只有封面图片等附加图片不算视频流
+func TestProbe_AttachedPic(t *testing.T) {
+    mjpeg := `{"streams": [{"index": 0, "codec_type": "video", "codec_name": "mjpeg", "width": 1280, "height": 720, "disposition": {"default": 1, "attached_pic": 0}}], "format": {"duration": "5"}}`
+    info, err := NewVideoSDK().WithRunner(NewFakeRunner().On("ffprobe", "-show_streams", mjpeg)).Probe("camera.avi")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if video := info.VideoStream(); video == nil || video.CodecName != "mjpeg" || video.Width != 1280 || video.AttachedPic {
+        t.Errorf("MJPEG video should be a video stream, but got %+v", video)
+    }
+
+    cover := `{"streams": [
+        {"index": 0, "codec_type": "audio", "codec_name": "mp3", "sample_rate": "44100", "channels": 2},
+        {"index": 1, "codec_type": "video", "codec_name": "png", "width": 600, "height": 600, "disposition": {"default": 0, "attached_pic": 1}}
+    ], "format": {"duration": "180"}}`
+    info, err = NewVideoSDK().WithRunner(NewFakeRunner().On("ffprobe", "-show_streams", cover)).Probe("song.mp3")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if video := info.VideoStream(); video != nil {
+        t.Errorf("cover art should not be a video stream, but got %+v", video)
+    }
+    if len(info.Streams) != 2 || !info.Streams[1].AttachedPic {
+        t.Errorf("cover art should be marked as an attached picture, but got %+v", info.Streams)
+    }
+}
+
+// Test_normalizeRotation 测试旋转角度归一化
+func Test_normalizeRotation(t *testing.T) {
+    for degrees, want := range map[float64]int64{0: 0, -90: 270, 90: 90, 180: 180, -180: 180, 270: 270, 450: 90} {
+        if got := normalizeRotation(degrees); got != want {
+            t.Errorf("normalizeRotation(%v) should be %d, but got %d", degrees, want, got)
+        }
+    }
+}
+
+// TestGetVideoDimensions_ParseError 测试无法解析尺寸时返回错误而不是 0x0
+func TestGetVideoDimensions_ParseError(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", "\n")
+    _, _, err := NewVideoSDK().WithRunner(runner).GetVideoDimensions("audio.mp3")
+    if err == nil {
+        t.Error("GetVideoDimensions should fail when ffprobe prints no dimensions")
+    }
+    runner = NewFakeRunner().On("ffprobe", "-show_streams", `{"streams": [{"codec_type": "audio", "codec_name": "mp3"}], "format": {"duration": "3"}}`)
+    _, _, err = NewVideoSDK().WithRunner(runner).GetVideoDimensions("audio.mp3")
+    if err == nil || !strings.Contains(err.Error(), "audio.mp3 has no video stream") {
+        t.Errorf("GetVideoDimensions should fail without a video stream, but got %v", err)
+    }
+}
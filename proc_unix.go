@@ -0,0 +1,21 @@
+//go:build !windows
+
+package vidfusion
+
+import (
+    "os/exec"
+    "syscall"
+)
+
+// setProcessGroup 让命令运行在独立的进程组中，便于取消时终止整个进程树
+func setProcessGroup(cmd *exec.Cmd) {
+    cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessTree 终止命令所在的整个进程组
+func killProcessTree(cmd *exec.Cmd) error {
+    if cmd.Process == nil {
+        return nil
+    }
+    return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
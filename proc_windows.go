@@ -0,0 +1,23 @@
+//go:build windows
+
+package vidfusion
+
+import (
+    "os/exec"
+    "strconv"
+)
+
+// setProcessGroup Windows 下无需设置进程组，通过 taskkill /T 终止进程树
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessTree 使用 taskkill 终止命令及其所有子进程
+func killProcessTree(cmd *exec.Cmd) error {
+    if cmd.Process == nil {
+        return nil
+    }
+    kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+    if err := kill.Run(); err != nil {
+        return cmd.Process.Kill()
+    }
+    return nil
+}
@@ -0,0 +1,247 @@
+package vidfusion
+
+import (
+    "bytes"
+    "io"
+    "math"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Progress 渲染进度，由 VideoSDKV2.OnProgress 注册的回调接收
+type Progress struct {
+    Step           string        // 当前步骤名称，例如 ConcatenateVideos
+    StepIndex      int           // 当前步骤序号，从 1 开始
+    TotalSteps     int           // 预计总步骤数，通过 ExpectSteps 设置，未设置时为 0
+    StepPercent    float64       // 当前步骤进度百分比 0-100
+    OverallPercent float64       // 整体进度百分比 0-100，TotalSteps 为 0 时等于 StepPercent
+    OutTime        time.Duration // 当前命令已输出的媒体时长
+    Duration       time.Duration // 当前命令预计输出的媒体时长，未知时为 0
+    FPS            float64       // 当前处理帧率
+    Speed          float64       // 当前处理速度，相对实时播放的倍数
+    StepETA        time.Duration // 当前命令预计剩余时间
+    ETA            time.Duration // 整体预计剩余时间，TotalSteps 为 0 时等于 StepETA
+}
+
+// ProgressFunc 进度回调函数
+type ProgressFunc func(Progress)
+
+// ffmpegProgress ffmpeg -progress 输出中的一个进度块
+type ffmpegProgress struct {
+    InputDuration float64 // 从 stderr 中解析到的第一个输入文件时长，未知时为 0
+    OutTime       float64 // 已输出的媒体时长（秒）
+    FPS           float64 // 处理帧率
+    Speed         float64 // 处理速度倍数
+    End           bool    // 是否为最后一个进度块
+}
+
+// durationPattern 匹配 ffmpeg stderr 中输入文件的时长信息
+var durationPattern = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+
+// progressParser 解析 ffmpeg 的 -progress key=value 输出和 stderr 中的输入时长
+type progressParser struct {
+    mu            sync.Mutex
+    onProgress    func(ffmpegProgress)
+    stdoutBuf     []byte
+    stderrBuf     []byte
+    current       ffmpegProgress
+    inputDuration float64
+}
+
+// newProgressParser 创建 progressParser，每解析出一个完整的进度块调用一次 onProgress
+func newProgressParser(onProgress func(ffmpegProgress)) *progressParser {
+    return &progressParser{onProgress: onProgress}
+}
+
+// stdout 返回接收 -progress pipe:1 输出的 Writer
+func (p *progressParser) stdout() io.Writer {
+    return writerFunc(func(b []byte) (int, error) {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        p.stdoutBuf = append(p.stdoutBuf, b...)
+        for {
+            i := bytes.IndexByte(p.stdoutBuf, '\n')
+            if i < 0 {
+                break
+            }
+            p.parseLine(strings.TrimSpace(string(p.stdoutBuf[:i])))
+            p.stdoutBuf = p.stdoutBuf[i+1:]
+        }
+        return len(b), nil
+    })
+}
+
+// stderr 返回接收 ffmpeg stderr 的 Writer，内容会同时写入 next
+func (p *progressParser) stderr(next io.Writer) io.Writer {
+    return writerFunc(func(b []byte) (int, error) {
+        p.mu.Lock()
+        if p.inputDuration == 0 {
+            p.stderrBuf = append(p.stderrBuf, b...)
+            if match := durationPattern.FindSubmatch(p.stderrBuf); match != nil {
+                hours, _ := strconv.ParseFloat(string(match[1]), 64)
+                minutes, _ := strconv.ParseFloat(string(match[2]), 64)
+                seconds, _ := strconv.ParseFloat(string(match[3]), 64)
+                p.inputDuration = hours*3600 + minutes*60 + seconds
+                p.stderrBuf = nil
+            }
+        }
+        p.mu.Unlock()
+        return next.Write(b)
+    })
+}
+
+// parseLine 解析一行 key=value，遇到 progress 键时输出一个进度块
+func (p *progressParser) parseLine(line string) {
+    key, value, ok := strings.Cut(line, "=")
+    if !ok {
+        return
+    }
+    switch key {
+    case "out_time_us", "out_time_ms":
+        // out_time_ms 实际上也是微秒
+        if us, err := strconv.ParseFloat(value, 64); err == nil && us >= 0 {
+            p.current.OutTime = us / 1e6
+        }
+    case "fps":
+        p.current.FPS, _ = strconv.ParseFloat(value, 64)
+    case "speed":
+        p.current.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+    case "progress":
+        p.current.End = value == "end"
+        p.current.InputDuration = p.inputDuration
+        if p.onProgress != nil {
+            p.onProgress(p.current)
+        }
+    }
+}
+
+// writerFunc 将函数适配为 io.Writer
+type writerFunc func([]byte) (int, error)
+
+// Write 实现 io.Writer 接口
+func (f writerFunc) Write(b []byte) (int, error) {
+    return f(b)
+}
+
+// progressTracker 汇总 VideoSDKV2 各步骤的进度
+// 只有最外层的公开方法算作一个步骤，ProcessVideos 等组合方法内部调用的方法计入同一步骤
+// 并行处理片段的子实例设置 parent，命令进度汇总到父实例当前的步骤中
+type progressTracker struct {
+    mu          sync.Mutex       // 并行处理片段时保护命令计数和回调
+    parent      *progressTracker // 并行处理片段时汇总进度的父实例
+    fn          ProgressFunc
+    totalSteps  int
+    stepIndex   int
+    step        string
+    depth       int
+    done        int // 当前步骤已完成的命令数
+    expected    int // 当前步骤预计执行的命令数
+    startTime   time.Time
+    lastOverall float64
+}
+
+// begin 开始一个步骤，expected 为该步骤预计执行的 ffmpeg 命令数
+func (t *progressTracker) begin(step string, expected int) {
+    if t.parent != nil {
+        return
+    }
+    t.depth++
+    if t.depth > 1 {
+        return
+    }
+    if t.startTime.IsZero() {
+        t.startTime = time.Now()
+    }
+    t.stepIndex++
+    t.step = step
+    t.done = 0
+    t.expected = expected
+}
+
+// end 结束一个步骤
+func (t *progressTracker) end() {
+    if t.parent != nil {
+        return
+    }
+    t.depth--
+}
+
+// expect 更新当前步骤预计执行的命令数，只对最外层步骤生效
+func (t *progressTracker) expect(expected int) {
+    if t.depth == 1 {
+        t.expected = expected
+    }
+}
+
+// commandDone 记录当前步骤完成了一条命令
+func (t *progressTracker) commandDone() {
+    if t.parent != nil {
+        t.parent.commandDone()
+        return
+    }
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    t.done++
+}
+
+// report 根据当前命令的进度块计算并回调进度，outputDuration 为当前命令预计输出时长
+func (t *progressTracker) report(p ffmpegProgress, outputDuration float64) {
+    if t.parent != nil {
+        t.parent.report(p, outputDuration)
+        return
+    }
+    if t.fn == nil {
+        return
+    }
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    commandFraction := 0.0
+    if p.End {
+        commandFraction = 1
+    } else if outputDuration > 0 {
+        commandFraction = math.Min(p.OutTime/outputDuration, 1)
+    }
+    expected := t.expected
+    if expected < t.done+1 {
+        expected = t.done + 1
+    }
+    stepFraction := (float64(t.done) + commandFraction) / float64(expected)
+    progress := Progress{
+        Step:        t.step,
+        StepIndex:   t.stepIndex,
+        TotalSteps:  t.totalSteps,
+        StepPercent: stepFraction * 100,
+        OutTime:     secondsToDuration(p.OutTime),
+        Duration:    secondsToDuration(outputDuration),
+        FPS:         p.FPS,
+        Speed:       p.Speed,
+    }
+    if p.Speed > 0 && outputDuration > p.OutTime {
+        progress.StepETA = secondsToDuration((outputDuration - p.OutTime) / p.Speed)
+    }
+    overall := progress.StepPercent
+    if t.totalSteps > 0 {
+        overall = (float64(t.stepIndex-1) + stepFraction) / float64(t.totalSteps) * 100
+        overall = math.Min(overall, 100)
+        // 步骤内预计命令数被修正时避免整体进度回退
+        if overall < t.lastOverall {
+            overall = t.lastOverall
+        }
+        t.lastOverall = overall
+    }
+    progress.OverallPercent = overall
+    progress.ETA = progress.StepETA
+    if t.totalSteps > 0 && overall > 0 {
+        elapsed := time.Since(t.startTime)
+        progress.ETA = time.Duration(float64(elapsed) * (100 - overall) / overall)
+    }
+    t.fn(progress)
+}
+
+// secondsToDuration 将秒数转换为 time.Duration
+func secondsToDuration(seconds float64) time.Duration {
+    return time.Duration(seconds * float64(time.Second))
+}
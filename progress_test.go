@@ -0,0 +1,67 @@
+package vidfusion
+
+import (
+    "io"
+    "testing"
+    "time"
+)
+
+// Test_progressParser 测试解析 ffmpeg -progress 输出和 stderr 中的输入时长
+func Test_progressParser(t *testing.T) {
+    var blocks []ffmpegProgress
+    parser := newProgressParser(func(p ffmpegProgress) {
+        blocks = append(blocks, p)
+    })
+    _, _ = io.WriteString(parser.stderr(io.Discard), "Input #0, mov,mp4, from 'in.mp4':\n  Duration: 00:01:")
+    _, _ = io.WriteString(parser.stderr(io.Discard), "30.50, start: 0.000000, bitrate: 1000 kb/s\n")
+    stdout := parser.stdout()
+    _, _ = io.WriteString(stdout, "fps=25.00\nout_time_us=45250000\nspeed=2.5x\nprogress=cont")
+    _, _ = io.WriteString(stdout, "inue\nout_time_us=90500000\nspeed=2.6x\nprogress=end\n")
+    if len(blocks) != 2 {
+        t.Fatalf("should parse 2 progress blocks, but got %d", len(blocks))
+    }
+    if blocks[0].InputDuration != 90.5 || blocks[0].OutTime != 45.25 || blocks[0].FPS != 25 || blocks[0].Speed != 2.5 || blocks[0].End {
+        t.Errorf("unexpected first block: %+v", blocks[0])
+    }
+    if !blocks[1].End || blocks[1].OutTime != 90.5 {
+        t.Errorf("unexpected last block: %+v", blocks[1])
+    }
+}
+
+// TestOnProgress 使用 FakeRunner 测试链式调用的步骤进度和整体进度
+func TestOnProgress(t *testing.T) {
+    runner := NewFakeRunner().Respond(FakeResponse{
+        Name:   "ffmpeg",
+        Stderr: "  Duration: 00:00:10.00, start: 0.000000\n",
+        Stdout: "out_time_us=2500000\nspeed=5x\nprogress=continue\nout_time_us=5000000\nspeed=5x\nprogress=continue\nout_time_us=10000000\nprogress=end\n",
+    })
+    var reports []Progress
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner).ExpectSteps(2).OnProgress(func(p Progress) {
+        reports = append(reports, p)
+    })
+    sdk.FlipVideo().CropVideoTimeline(0, 5)
+    if sdk.Err() != nil {
+        t.Fatalf("chain error: %v", sdk.Err())
+    }
+    if len(reports) != 6 {
+        t.Fatalf("should report 6 times, but got %d", len(reports))
+    }
+    first := reports[0]
+    if first.Step != "FlipVideo" || first.StepIndex != 1 || first.StepPercent != 25 || first.OverallPercent != 12.5 {
+        t.Errorf("unexpected first report: %+v", first)
+    }
+    if first.Duration != 10*time.Second || first.StepETA != 1500*time.Millisecond {
+        t.Errorf("unexpected first report timing: %+v", first)
+    }
+    // 裁剪到 5 秒后，输出 5 秒即完成
+    crop := reports[4]
+    if crop.Step != "CropVideoTimeline" || crop.StepPercent != 100 || crop.OverallPercent != 100 {
+        t.Errorf("unexpected crop report: %+v", crop)
+    }
+    for _, line := range runner.CommandLines() {
+        if line[:len("ffmpeg -progress pipe:1 -nostats -y")] != "ffmpeg -progress pipe:1 -nostats -y" {
+            t.Errorf("command should request progress output, but got %q", line)
+        }
+    }
+    sdk.Cleanup()
+}
@@ -0,0 +1,289 @@
+package vidfusion
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+
+    "gopkg.in/yaml.v3"
+)
+
+// RecipeVersion 当前支持的配方格式版本
+const RecipeVersion = 1
+
+// Recipe 描述一次完整渲染任务的配方，可以用 JSON 或 YAML 编写
+// 执行顺序固定为：素材（Input 或 Clips）→ Trim → Mute → Audio → Overlays → Subtitles → Output
+type Recipe struct {
+    Version   int              `json:"version" yaml:"version"`                         // 配方格式版本，省略时为当前版本
+    Name      string           `json:"name,omitempty" yaml:"name,omitempty"`           // 任务名称
+    BaseDir   string           `json:"base_dir,omitempty" yaml:"base_dir,omitempty"`   // 相对路径的基准目录，LoadRecipe 默认使用配方文件所在目录
+    Lazy      bool             `json:"lazy,omitempty" yaml:"lazy,omitempty"`           // 是否使用延迟模式
+    Input     string           `json:"input,omitempty" yaml:"input,omitempty"`         // 单个输入视频，与 Clips 二选一
+    Clips     *RecipeClips     `json:"clips,omitempty" yaml:"clips,omitempty"`         // 多个片段拼合，与 Input 二选一
+    Trim      *RecipeTrim      `json:"trim,omitempty" yaml:"trim,omitempty"`           // 裁剪时间线
+    Mute      bool             `json:"mute,omitempty" yaml:"mute,omitempty"`           // 去掉原声并添加静音轨道
+    Audio     []RecipeAudio    `json:"audio,omitempty" yaml:"audio,omitempty"`         // 依次混入的音频层，例如背景音乐和解说
+    Overlays  []OverlayOptions `json:"overlays,omitempty" yaml:"overlays,omitempty"`   // 依次叠加的图片，宽高为 0 时使用视频尺寸
+    Subtitles *RecipeSubtitles `json:"subtitles,omitempty" yaml:"subtitles,omitempty"` // 字幕
+    Output    RecipeOutput     `json:"output" yaml:"output"`                           // 输出设置
+}
+
+// RecipeClips 多个片段的处理和拼合设置，对应 ProcessVideos
+type RecipeClips struct {
+    ProcessVideosOptions `yaml:",inline"`
+    DurationFrom         string `json:"duration_from,omitempty" yaml:"duration_from,omitempty"` // 使用该音频文件的时长作为总时长，例如解说音频
+}
+
+// RecipeTrim 裁剪时间线设置
+type RecipeTrim struct {
+    Start float64 `json:"start" yaml:"start"` // 开始时间（秒）
+    End   float64 `json:"end" yaml:"end"`     // 结束时间（秒）
+}
+
+// RecipeAudio 混入的音频层
+type RecipeAudio struct {
+    File   string  `json:"file" yaml:"file"`     // 音频文件路径
+    Volume float64 `json:"volume" yaml:"volume"` // 音量倍数
+}
+
+// RecipeSubtitles 字幕设置
+type RecipeSubtitles struct {
+    File  string          `json:"file" yaml:"file"`   // 字幕文件路径
+    Style SubtitleOptions `json:"style" yaml:"style"` // 字幕样式
+}
+
+// RecipeOutput 输出设置
+type RecipeOutput struct {
+    File           string          `json:"file" yaml:"file"`                                           // 输出文件路径
+    Encoder        string          `json:"encoder,omitempty" yaml:"encoder,omitempty"`                 // 内置编码配置名称，例如 x264
+    EncoderProfile *EncoderProfile `json:"encoder_profile,omitempty" yaml:"encoder_profile,omitempty"` // 自定义编码配置，优先于 Encoder
+}
+
+// ParseRecipe 解析 JSON 或 YAML 格式的配方并校验，未知字段视为错误
+func ParseRecipe(data []byte) (*Recipe, error) {
+    var recipe Recipe
+    decoder := yaml.NewDecoder(bytes.NewReader(data))
+    decoder.KnownFields(true)
+    if err := decoder.Decode(&recipe); err != nil && !errors.Is(err, io.EOF) {
+        return nil, fmt.Errorf("failed to parse recipe: %v", err)
+    }
+    if err := recipe.Validate(); err != nil {
+        return nil, err
+    }
+    return &recipe, nil
+}
+
+// LoadRecipe 读取并校验配方文件，未设置 base_dir 时相对路径以配方文件所在目录为基准
+func LoadRecipe(path string) (*Recipe, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read recipe: %v", err)
+    }
+    recipe, err := ParseRecipe(data)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    dir := filepath.Dir(path)
+    if recipe.BaseDir == "" {
+        recipe.BaseDir = dir
+    } else if !filepath.IsAbs(recipe.BaseDir) {
+        recipe.BaseDir = filepath.Join(dir, recipe.BaseDir)
+    }
+    return recipe, nil
+}
+
+// Validate 校验配方，返回所有问题合并后的错误
+func (r *Recipe) Validate() error {
+    var errs []error
+    check := func(ok bool, format string, args ...any) {
+        if !ok {
+            errs = append(errs, fmt.Errorf(format, args...))
+        }
+    }
+    check(r.Version == 0 || r.Version == RecipeVersion, "unsupported recipe version %d", r.Version)
+    check((r.Input == "") != (r.Clips == nil), "exactly one of input and clips is required")
+    if clips := r.Clips; clips != nil {
+        check(clips.Width > 0 && clips.Height > 0, "clips: width and height must be positive")
+        check(len(clips.VideosOptions) > 0, "clips: videos is empty")
+        check((clips.VideoDuration > 0) != (clips.DurationFrom != ""), "clips: exactly one of duration and duration_from is required")
+        check(validFill(clips.Fill), "clips: unknown fill strategy %q", clips.Fill)
+        check(clips.FrameRate >= 0 && clips.SampleRate >= 0, "clips: frame_rate and sample_rate should not be negative")
+        check(validReframe(clips.Reframe), "clips: unknown reframe mode %q", clips.Reframe)
+        if err := clips.Transition.Validate(); err != nil {
+            errs = append(errs, prefixErrors("clips", err)...)
+        }
+        for i, video := range clips.VideosOptions {
+            check(video.VideoFile != "", "clips.videos[%d]: file is required", i)
+            if err := video.Validate(); err != nil {
+                errs = append(errs, prefixErrors(fmt.Sprintf("clips.videos[%d]", i), err)...)
+            }
+        }
+    }
+    if trim := r.Trim; trim != nil {
+        check(trim.Start >= 0 && trim.End > trim.Start, "trim: end must be greater than start")
+    }
+    for i, audio := range r.Audio {
+        check(audio.File != "", "audio[%d]: file is required", i)
+        check(audio.Volume > 0, "audio[%d]: volume must be positive", i)
+    }
+    for i, overlay := range r.Overlays {
+        check(overlay.ImageFile != "", "overlays[%d]: image is required", i)
+        check(overlay.ImageWidth >= 0 && overlay.ImageHeight >= 0, "overlays[%d]: width and height must not be negative", i)
+    }
+    if subtitles := r.Subtitles; subtitles != nil {
+        check(subtitles.File != "", "subtitles: file is required")
+    }
+    check(r.Output.File != "", "output: file is required")
+    if r.Output.EncoderProfile != nil {
+        if err := r.Output.EncoderProfile.Validate(); err != nil {
+            errs = append(errs, fmt.Errorf("output: %w", err))
+        }
+    } else if r.Output.Encoder != "" {
+        _, ok := LookupEncoderProfile(r.Output.Encoder)
+        check(ok, "output: unknown encoder %q", r.Output.Encoder)
+    }
+    if len(errs) > 0 {
+        return fmt.Errorf("invalid recipe: %w", errors.Join(errs...))
+    }
+    return nil
+}
+
+// prefixErrors 为合并错误中的每一条加上前缀
+func prefixErrors(prefix string, err error) []error {
+    joined, ok := err.(interface{ Unwrap() []error })
+    if !ok {
+        return []error{fmt.Errorf("%s: %w", prefix, err)}
+    }
+    var errs []error
+    for _, e := range joined.Unwrap() {
+        errs = append(errs, fmt.Errorf("%s: %w", prefix, e))
+    }
+    return errs
+}
+
+// Execute 使用 sdk 执行配方并返回输出文件路径，调用前可以在 sdk 上设置 Runner、ctx、进度回调或预演模式
+func (r *Recipe) Execute(sdk *VideoSDKV2) (string, error) {
+    if err := r.Validate(); err != nil {
+        return "", err
+    }
+    if r.Lazy {
+        sdk.Lazy()
+    }
+    if r.Output.EncoderProfile != nil {
+        sdk.WithEncoder(*r.Output.EncoderProfile)
+    } else if r.Output.Encoder != "" {
+        profile, _ := LookupEncoderProfile(r.Output.Encoder)
+        sdk.WithEncoder(profile)
+    }
+    if sdk.progress.totalSteps == 0 {
+        sdk.ExpectSteps(r.steps())
+    }
+    if r.Input != "" {
+        sdk.CurrentFile = r.path(r.Input)
+    } else {
+        options := r.Clips.ProcessVideosOptions
+        if r.Clips.DurationFrom != "" {
+            duration, err := sdk.GetMP3Duration(r.path(r.Clips.DurationFrom))
+            if err != nil {
+                sdk.fail("Recipe", fmt.Errorf("failed to get duration of %s: %w", r.Clips.DurationFrom, err))
+                return sdk.Finalize(r.path(r.Output.File))
+            }
+            options.VideoDuration = duration
+        }
+        options.VideosOptions = append([]VideosOptions(nil), options.VideosOptions...)
+        for i := range options.VideosOptions {
+            options.VideosOptions[i].VideoFile = r.path(options.VideosOptions[i].VideoFile)
+        }
+        sdk.ProcessVideos(options)
+    }
+    if r.Trim != nil {
+        sdk.CropVideoTimeline(r.Trim.Start, r.Trim.End)
+    }
+    if r.Mute {
+        sdk.Mute().MuteTrack()
+    }
+    for _, audio := range r.Audio {
+        sdk.AddBackgroundMusic(r.path(audio.File), audio.Volume)
+    }
+    for _, overlay := range r.Overlays {
+        overlay.ImageFile = r.path(overlay.ImageFile)
+        if (overlay.ImageWidth == 0 || overlay.ImageHeight == 0) && sdk.Err() == nil {
+            width, height, err := sdk.GetVideoDimensions(sdk.CurrentFile)
+            if err != nil {
+                sdk.fail("AddImageOverlay", err)
+                break
+            }
+            if overlay.ImageWidth == 0 {
+                overlay.ImageWidth = width
+            }
+            if overlay.ImageHeight == 0 {
+                overlay.ImageHeight = height
+            }
+        }
+        sdk.AddImageOverlay(overlay)
+    }
+    if r.Subtitles != nil {
+        sdk.AddSubtitles(r.path(r.Subtitles.File), r.Subtitles.Style)
+    }
+    return sdk.Finalize(r.path(r.Output.File))
+}
+
+// Assets 返回配方引用的所有素材路径，相对路径未按 BaseDir 解析
+func (r *Recipe) Assets() []string {
+    var files []string
+    if r.Input != "" {
+        files = append(files, r.Input)
+    }
+    if clips := r.Clips; clips != nil {
+        for _, video := range clips.VideosOptions {
+            files = append(files, video.VideoFile)
+        }
+        if clips.DurationFrom != "" {
+            files = append(files, clips.DurationFrom)
+        }
+    }
+    for _, audio := range r.Audio {
+        files = append(files, audio.File)
+    }
+    for _, overlay := range r.Overlays {
+        files = append(files, overlay.ImageFile)
+    }
+    if r.Subtitles != nil {
+        files = append(files, r.Subtitles.File)
+    }
+    return files
+}
+
+// steps 执行配方的预计步骤数，用于计算整体进度
+func (r *Recipe) steps() int {
+    steps := 0
+    if r.Clips != nil {
+        steps++
+    }
+    // 延迟模式下之后的步骤合并为一条命令
+    if r.Lazy {
+        return steps + 1
+    }
+    steps += len(r.Audio) + len(r.Overlays)
+    if r.Trim != nil {
+        steps++
+    }
+    if r.Mute {
+        steps += 2
+    }
+    if r.Subtitles != nil {
+        steps++
+    }
+    return steps
+}
+
+// path 将相对路径解析为基于 BaseDir 的路径
+func (r *Recipe) path(file string) string {
+    if r.BaseDir == "" || filepath.IsAbs(file) {
+        return file
+    }
+    return filepath.Join(r.BaseDir, file)
+}
@@ -0,0 +1,158 @@
+package vidfusion
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// recipeYAML README 示例流程对应的配方
+const recipeYAML = `
+version: 1
+name: anniversary
+clips:
+  duration_from: narration.wav
+  width: 720
+  height: 1280
+  videos:
+    - file: videos/1.mp4
+      process: FlipVideo
+    - file: videos/2.mp4
+      process: SpeedUpVideo
+      params: 2
+mute: true
+audio:
+  - file: music/music.flac
+    volume: 0.4
+  - file: narration.wav
+    volume: 2
+overlays:
+  - image: images/overlay.png
+subtitles:
+  file: srt.srt
+  style: {font_size: 9, font_color: 00FFFFFF, y: 150, alignment: 2, font: Arial}
+output:
+  file: out/final.mp4
+  encoder: x265
+`
+
+// TestLoadRecipe 测试加载 YAML 配方并通过 VideoSDKV2 执行
+func TestLoadRecipe(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "job.yaml")
+    if err := os.WriteFile(path, []byte(recipeYAML), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    recipe, err := LoadRecipe(path)
+    if err != nil {
+        t.Fatalf("LoadRecipe error: %v", err)
+    }
+    if recipe.BaseDir != dir || recipe.Clips.Width != 720 || len(recipe.Clips.VideosOptions) != 2 || recipe.Subtitles.Style.FontSize != 9 {
+        t.Fatalf("unexpected recipe: %+v", recipe)
+    }
+    if assets := strings.Join(recipe.Assets(), " "); assets != "videos/1.mp4 videos/2.mp4 narration.wav music/music.flac narration.wav images/overlay.png srt.srt" {
+        t.Errorf("unexpected assets: %s", assets)
+    }
+
+    runner := NewFakeRunner().
+        On("ffprobe", "-show_streams", probeJSON).
+        On("ffprobe", "format=duration", "8")
+    sdk := NewVideoSDKV2("").WithRunner(runner).DryRun()
+    output, err := recipe.Execute(sdk)
+    if err != nil {
+        t.Fatalf("Execute error: %v", err)
+    }
+    if want := filepath.Join(dir, "out", "final.mp4"); output != want {
+        t.Errorf("output should be %s, but got %s", want, output)
+    }
+    var lines []string
+    for _, command := range sdk.Plan().Commands {
+        lines = append(lines, command.Step+": "+strings.Join(command.Args, " "))
+    }
+    plan := strings.Join(lines, "\n")
+    for _, want := range []string{
+        "-i " + filepath.Join(dir, "narration.wav") + " -show_entries format=duration",
+        "-i " + filepath.Join(dir, "videos", "1.mp4") + " -vf hflip -c:v libx265 -preset medium -crf 28",
+        "CropVideoTimeline: -y -i {{tmp",
+        "Mute: ",
+        "MuteTrack: ",
+        "-i " + filepath.Join(dir, "music", "music.flac") + " -filter_complex [1:a]volume=0.4",
+        "[1:a]volume=2.0",
+        "-i " + filepath.Join(dir, "images", "overlay.png") + " -filter_complex [1:v]scale=720:1280[img]",
+        "subtitles='" + filepath.Join(dir, "srt.srt") + "':force_style='Alignment=2,Fontsize=9",
+        "Finalize: {{tmp",
+    } {
+        if !strings.Contains(plan, want) {
+            t.Errorf("plan should contain %q, but got:\n%s", want, plan)
+        }
+    }
+    if sdk.progress.totalSteps != 7 {
+        t.Errorf("recipe should expect 7 steps, but got %d", sdk.progress.totalSteps)
+    }
+}
+
+// TestParseRecipe_JSON 测试解析 JSON 配方
+func TestParseRecipe_JSON(t *testing.T) {
+    recipe, err := ParseRecipe([]byte(`{
+        "input": "in.mp4",
+        "trim": {"start": 1, "end": 5},
+        "output": {"file": "out.mp4", "encoder_profile": {"codec": "libx264", "bitrate": "4M"}}
+    }`))
+    if err != nil {
+        t.Fatalf("ParseRecipe error: %v", err)
+    }
+    runner := NewFakeRunner()
+    sdk := NewVideoSDKV2("").WithRunner(runner).DryRun()
+    if _, err := recipe.Execute(sdk); err != nil {
+        t.Fatalf("Execute error: %v", err)
+    }
+    commands := sdk.Plan().Commands
+    if len(commands) != 2 || strings.Join(commands[0].Args, " ") != "-y -i in.mp4 -ss 1.00 -to 5.00 -c:v libx264 -b:v 4M {{tmp1.mp4}}" {
+        t.Errorf("unexpected plan: %+v", commands)
+    }
+}
+
+// TestParseRecipe_Invalid 测试校验错误包含所有问题，未知字段视为错误
+func TestParseRecipe_Invalid(t *testing.T) {
+    _, err := ParseRecipe([]byte(`
+version: 2
+clips:
+  width: 720
+  videos:
+    - file: 1.mp4
+      process: Reverse
+    - file: 2.mp4
+      in: 3
+      out: 2
+      ops:
+        - {op: speed}
+        - {op: blur}
+audio:
+  - file: music.flac
+output:
+  encoder: mpeg2
+`))
+    if err == nil {
+        t.Fatal("ParseRecipe should fail")
+    }
+    for _, want := range []string{
+        "unsupported recipe version 2",
+        "clips: width and height must be positive",
+        "clips: exactly one of duration and duration_from is required",
+        `clips.videos[0]: unknown process "Reverse"`,
+        "clips.videos[1]: out must be greater than in",
+        "clips.videos[1]: ops[0]: speed: factor is required",
+        `clips.videos[1]: ops[1]: unknown operation "blur"`,
+        "audio[0]: volume must be positive",
+        "output: file is required",
+        `output: unknown encoder "mpeg2"`,
+    } {
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("error should contain %q, but got %v", want, err)
+        }
+    }
+    if _, err := ParseRecipe([]byte("input: in.mp4\noutput: {file: out.mp4}\nvolume: 2\n")); err == nil || !strings.Contains(err.Error(), "volume") {
+        t.Errorf("unknown field should be rejected, but got %v", err)
+    }
+}
@@ -0,0 +1,204 @@
+package vidfusion
+
+import (
+    "errors"
+    "fmt"
+    "regexp"
+    "slices"
+)
+
+// 裁剪和填充时画面保留的位置
+const (
+    GravityCenter      = "center"
+    GravityTop         = "top"
+    GravityBottom      = "bottom"
+    GravityLeft        = "left"
+    GravityRight       = "right"
+    GravityTopLeft     = "top-left"
+    GravityTopRight    = "top-right"
+    GravityBottomLeft  = "bottom-left"
+    GravityBottomRight = "bottom-right"
+)
+
+// gravityOffsets 各位置对应的 crop 滤镜 x、y 表达式
+var gravityOffsets = map[string][2]string{
+    GravityCenter:      {"(iw-ow)/2", "(ih-oh)/2"},
+    GravityTop:         {"(iw-ow)/2", "0"},
+    GravityBottom:      {"(iw-ow)/2", "ih-oh"},
+    GravityLeft:        {"0", "(ih-oh)/2"},
+    GravityRight:       {"iw-ow", "(ih-oh)/2"},
+    GravityTopLeft:     {"0", "0"},
+    GravityTopRight:    {"iw-ow", "0"},
+    GravityBottomLeft:  {"0", "ih-oh"},
+    GravityBottomRight: {"iw-ow", "ih-oh"},
+}
+
+// gravities 支持的位置，用于校验和操作参数的可选值
+var gravities = []string{GravityCenter, GravityTop, GravityBottom, GravityLeft, GravityRight, GravityTopLeft, GravityTopRight, GravityBottomLeft, GravityBottomRight}
+
+// colorPattern 滤镜颜色参数允许的格式：颜色名称或 #RRGGBB[AA] / 0xRRGGBB[AA]，可以带 @ 透明度后缀
+var colorPattern = regexp.MustCompile(`^(?:[A-Za-z]+|(?:#|0[xX])[0-9A-Fa-f]{6}(?:[0-9A-Fa-f]{2})?)(?:@(?:0[xX][0-9A-Fa-f]{2}|[0-9]*\.?[0-9]+))?$`)
+
+// validColor 判断颜色是否可以安全地拼接到滤镜参数中，空字符串表示默认颜色
+func validColor(color string) bool {
+    return color == "" || colorPattern.MatchString(color)
+}
+
+// CropOptions 裁剪画面区域选项，Gravity 为空时以 X、Y 作为区域左上角的坐标
+type CropOptions struct {
+    Width   int64  `json:"width" yaml:"width"`                         // 区域宽度
+    Height  int64  `json:"height" yaml:"height"`                       // 区域高度
+    X       int64  `json:"x,omitempty" yaml:"x,omitempty"`             // 区域左上角的横坐标
+    Y       int64  `json:"y,omitempty" yaml:"y,omitempty"`             // 区域左上角的纵坐标
+    Gravity string `json:"gravity,omitempty" yaml:"gravity,omitempty"` // 按位置裁剪，例如 GravityCenter、GravityTop，与 X、Y 不能同时使用
+}
+
+// Validate 校验区域尺寸、坐标和位置
+func (o CropOptions) Validate() error {
+    var errs []error
+    if o.Width <= 0 || o.Height <= 0 {
+        errs = append(errs, fmt.Errorf("crop width and height must be positive"))
+    }
+    if o.X < 0 || o.Y < 0 {
+        errs = append(errs, fmt.Errorf("crop x and y should not be negative"))
+    }
+    if o.Gravity != "" && !slices.Contains(gravities, o.Gravity) {
+        errs = append(errs, fmt.Errorf("unknown gravity %q", o.Gravity))
+    }
+    if o.Gravity != "" && (o.X != 0 || o.Y != 0) {
+        errs = append(errs, fmt.Errorf("x, y and gravity should not be used together"))
+    }
+    return errors.Join(errs...)
+}
+
+// filter 返回裁剪使用的 crop 滤镜
+func (o CropOptions) filter() string {
+    if o.Gravity == "" {
+        return fmt.Sprintf("crop=%d:%d:%d:%d", o.Width, o.Height, o.X, o.Y)
+    }
+    offsets := gravityOffsets[o.Gravity]
+    return fmt.Sprintf("crop=%d:%d:%s:%s", o.Width, o.Height, offsets[0], offsets[1])
+}
+
+// 改变画面宽高比的方式
+const (
+    ReframeStretch = "stretch" // 直接缩放到目标尺寸，宽高比不同时画面变形（默认）
+    ReframeFit     = "fit"     // 等比缩放到目标尺寸以内，空白处填充纯色
+    ReframeFill    = "fill"    // 等比缩放到覆盖目标尺寸，超出的部分按 Gravity 裁掉
+    ReframeBlur    = "blur"    // 等比缩放到目标尺寸以内，空白处使用放大并模糊的画面填充
+)
+
+// validReframe 判断是否为支持的改变宽高比方式，空字符串表示默认的 ReframeStretch
+func validReframe(mode string) bool {
+    return mode == "" || slices.Contains([]string{ReframeStretch, ReframeFit, ReframeFill, ReframeBlur}, mode)
+}
+
+// ReframeOptions 改变画面尺寸和宽高比选项
+type ReframeOptions struct {
+    Width   int64  // 目标宽度
+    Height  int64  // 目标高度
+    Mode    string // 改变宽高比的方式 ReframeStretch / ReframeFit / ReframeFill / ReframeBlur，默认 ReframeStretch
+    Gravity string // ReframeFill 保留的位置，默认 GravityCenter
+    Color   string // ReframeFit 填充的颜色，默认 black
+    Blur    int    // ReframeBlur 背景的模糊程度（高斯模糊的 sigma），默认 20
+}
+
+// Validate 校验目标尺寸、方式、位置和填充颜色
+func (o ReframeOptions) Validate() error {
+    var errs []error
+    if o.Width <= 0 || o.Height <= 0 {
+        errs = append(errs, fmt.Errorf("reframe width and height must be positive"))
+    }
+    if !validReframe(o.Mode) {
+        errs = append(errs, fmt.Errorf("unknown reframe mode %q", o.Mode))
+    }
+    if o.Gravity != "" && !slices.Contains(gravities, o.Gravity) {
+        errs = append(errs, fmt.Errorf("unknown gravity %q", o.Gravity))
+    }
+    if !validColor(o.Color) {
+        errs = append(errs, fmt.Errorf("invalid color %q", o.Color))
+    }
+    if o.Blur < 0 {
+        errs = append(errs, fmt.Errorf("blur should not be negative"))
+    }
+    return errors.Join(errs...)
+}
+
+// scale 返回等比缩放到目标尺寸以内（decrease）或覆盖目标尺寸（increase）的 scale 滤镜
+func (o ReframeOptions) scale(fit string) string {
+    return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=%s", o.Width, o.Height, fit)
+}
+
+// blurLayers 返回 ReframeBlur 的背景滤镜、前景滤镜和叠加滤镜
+func (o ReframeOptions) blurLayers() (background, foreground, overlay string) {
+    sigma := o.Blur
+    if sigma == 0 {
+        sigma = 20
+    }
+    background = fmt.Sprintf("%s,crop=%d:%d,gblur=sigma=%d", o.scale("increase"), o.Width, o.Height, sigma)
+    return background, o.scale("decrease"), "overlay=(W-w)/2:(H-h)/2,setsar=1"
+}
+
+// filter 返回 -vf 使用的滤镜，ReframeBlur 在滤镜内部拆分为背景和前景两路
+func (o ReframeOptions) filter() string {
+    switch o.Mode {
+    case ReframeFit:
+        color := o.Color
+        if color == "" {
+            color = "black"
+        }
+        return fmt.Sprintf("%s,pad=%d:%d:(ow-iw)/2:(oh-ih)/2:color=%s,setsar=1", o.scale("decrease"), o.Width, o.Height, color)
+    case ReframeFill:
+        gravity := o.Gravity
+        if gravity == "" {
+            gravity = GravityCenter
+        }
+        return fmt.Sprintf("%s,%s,setsar=1", o.scale("increase"), CropOptions{Width: o.Width, Height: o.Height, Gravity: gravity}.filter())
+    case ReframeBlur:
+        background, foreground, overlay := o.blurLayers()
+        return fmt.Sprintf("split=2[bg][fg];[bg]%s[blurred];[fg]%s[scaled];[blurred][scaled]%s", background, foreground, overlay)
+    }
+    return fmt.Sprintf("scale=%d:%d", o.Width, o.Height)
+}
+
+// apply 将改变尺寸的滤镜追加到滤镜图，ReframeBlur 使用滤镜图分配的标签拆分背景和前景，避免与其他节点的标签冲突
+func (o ReframeOptions) apply(g *filterGraph) error {
+    if o.Mode == ReframeBlur {
+        background, foreground, overlay := o.blurLayers()
+        layers := g.splitStream("v", g.video, 2)
+        g.video = g.addFilter("v", overlay, g.addFilter("v", background, layers[0]), g.addFilter("v", foreground, layers[1]))
+    } else {
+        g.videoFilter(o.filter())
+    }
+    g.width, g.height = o.Width, o.Height
+    return nil
+}
+
+// CropVideoWithOptions 裁剪画面区域，区域可以用左上角坐标或位置指定，音频保持不变
+func (sdk *VideoSDKV2) CropVideoWithOptions(options CropOptions) *VideoSDKV2 {
+    if sdk.err != nil {
+        return sdk
+    }
+    if err := options.Validate(); err != nil {
+        sdk.fail("CropVideo", err)
+        return sdk
+    }
+    return sdk.filterVideo("CropVideo", options.filter(), func(int64, int64) (int64, int64) {
+        return options.Width, options.Height
+    })
+}
+
+// Reframe 将画面调整为目标尺寸，宽高比不同时按 Mode 拉伸、填充纯色、裁剪或填充模糊背景，音频保持不变
+func (sdk *VideoSDKV2) Reframe(options ReframeOptions) *VideoSDKV2 {
+    if sdk.err != nil {
+        return sdk
+    }
+    if err := options.Validate(); err != nil {
+        sdk.fail("Reframe", err)
+        return sdk
+    }
+    if sdk.lazy {
+        return sdk.appendNode("Reframe", options.apply)
+    }
+    return sdk.filterVideo("Reframe", options.filter(), nil)
+}
@@ -0,0 +1,117 @@
+package vidfusion
+
+import (
+    "strings"
+    "testing"
+)
+
+// TestReframeOptions_filter 测试各种改变宽高比方式的滤镜
+func TestReframeOptions_filter(t *testing.T) {
+    for _, c := range []struct {
+        options ReframeOptions
+        want    string
+    }{
+        {ReframeOptions{Width: 720, Height: 1280}, "scale=720:1280"},
+        {ReframeOptions{Width: 720, Height: 1280, Mode: ReframeFit, Color: "white"}, "scale=720:1280:force_original_aspect_ratio=decrease,pad=720:1280:(ow-iw)/2:(oh-ih)/2:color=white,setsar=1"},
+        {ReframeOptions{Width: 720, Height: 1280, Mode: ReframeFill}, "scale=720:1280:force_original_aspect_ratio=increase,crop=720:1280:(iw-ow)/2:(ih-oh)/2,setsar=1"},
+        {ReframeOptions{Width: 720, Height: 1280, Mode: ReframeFill, Gravity: GravityLeft}, "scale=720:1280:force_original_aspect_ratio=increase,crop=720:1280:0:(ih-oh)/2,setsar=1"},
+        {ReframeOptions{Width: 720, Height: 1280, Mode: ReframeBlur}, "split=2[bg][fg];[bg]scale=720:1280:force_original_aspect_ratio=increase,crop=720:1280,gblur=sigma=20[blurred];" +
+            "[fg]scale=720:1280:force_original_aspect_ratio=decrease[scaled];[blurred][scaled]overlay=(W-w)/2:(H-h)/2,setsar=1"},
+    } {
+        if got := c.options.filter(); got != c.want {
+            t.Errorf("%+v filter should be %s, but got %s", c.options, c.want, got)
+        }
+    }
+}
+
+// TestReframeOptions_Validate 测试填充颜色只接受颜色名称和十六进制颜色，避免拼接到滤镜中注入其他滤镜
+func TestReframeOptions_Validate(t *testing.T) {
+    for _, color := range []string{"", "black", "DarkGreen", "#112233", "#11223344", "0xAABBCC", "0xaabbccdd", "white@0.5", "#000000@0x80"} {
+        if err := (ReframeOptions{Width: 720, Height: 1280, Mode: ReframeFit, Color: color}).Validate(); err != nil {
+            t.Errorf("color %q should be valid, but got %v", color, err)
+        }
+    }
+    for _, color := range []string{
+        "black:x=0",
+        "black,movie=/etc/passwd",
+        "black;[0:v]null",
+        "black[out]",
+        "[in]black",
+        "#1122",
+        "white@",
+        "0x11223344@0.5:",
+    } {
+        sdk := NewVideoSDKV2("in.mp4").WithRunner(NewFakeRunner())
+        if err := sdk.Reframe(ReframeOptions{Width: 720, Height: 1280, Mode: ReframeFit, Color: color}).Err(); err == nil || !strings.Contains(err.Error(), "invalid color") {
+            t.Errorf("color %q should be rejected, but got %v", color, err)
+        }
+    }
+}
+
+// TestCropVideoWithOptions 测试按坐标或位置裁剪画面，不缩放画面
+func TestCropVideoWithOptions(t *testing.T) {
+    runner := NewFakeRunner()
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner)
+    sdk.CropVideo(1080, 1080).CropVideoWithOptions(CropOptions{Width: 720, Height: 720, Gravity: GravityBottomRight})
+    lines := runner.CommandLines()
+    if sdk.Err() != nil || len(lines) != 2 || !strings.Contains(lines[0], "-vf crop=1080:1080:(iw-ow)/2:(ih-oh)/2 ") || !strings.Contains(lines[1], "-vf crop=720:720:iw-ow:ih-oh ") {
+        t.Errorf("should crop without scaling, but got %v %v", lines, sdk.Err())
+    }
+
+    for _, c := range []struct {
+        options CropOptions
+        want    string
+    }{
+        {CropOptions{Width: 0, Height: 100}, "crop width and height must be positive"},
+        {CropOptions{Width: 100, Height: 100, X: -1}, "crop x and y should not be negative"},
+        {CropOptions{Width: 100, Height: 100, Gravity: "middle"}, `unknown gravity "middle"`},
+        {CropOptions{Width: 100, Height: 100, X: 10, Gravity: GravityTop}, "x, y and gravity should not be used together"},
+    } {
+        sdk := NewVideoSDKV2("in.mp4").WithRunner(NewFakeRunner())
+        if err := sdk.CropVideoWithOptions(c.options).Err(); err == nil || !strings.Contains(err.Error(), c.want) {
+            t.Errorf("%+v should fail with %q, but got %v", c.options, c.want, err)
+        }
+    }
+}
+
+// TestLazy_Reframe 测试延迟模式下模糊背景使用滤镜图分配的标签，多次调用不会冲突
+func TestLazy_Reframe(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner).Lazy()
+    sdk.Reframe(ReframeOptions{Width: 1080, Height: 1920, Mode: ReframeBlur, Blur: 10}).Reframe(ReframeOptions{Width: 720, Height: 1280, Mode: ReframeBlur})
+    width, height, err := sdk.GetVideoDimensions(sdk.CurrentFile)
+    if err != nil || width != 720 || height != 1280 {
+        t.Errorf("GetVideoDimensions should return 720x1280, but got %dx%d %v", width, height, err)
+    }
+    sdk.Flush()
+    lines := runner.CommandLines()
+    want := "[0:v]split=2[v1][v2];[v1]scale=1080:1920:force_original_aspect_ratio=increase,crop=1080:1920,gblur=sigma=10[v3];" +
+        "[v2]scale=1080:1920:force_original_aspect_ratio=decrease[v4];[v3][v4]overlay=(W-w)/2:(H-h)/2,setsar=1[v5];[v5]split=2[v6][v7];"
+    if sdk.Err() != nil || len(lines) != 2 || !strings.Contains(lines[1], want) || !strings.Contains(lines[1], "-map [v10] ") {
+        t.Errorf("command should contain %q, but got %v %v", want, lines, sdk.Err())
+    }
+}
+
+// TestProcessVideos_Reframe 测试片段按选择的方式调整到目标尺寸
+func TestProcessVideos_Reframe(t *testing.T) {
+    options := ProcessVideosOptions{
+        VideoDuration: 4,
+        Width:         720,
+        Height:        1280,
+        Reframe:       ReframeFill,
+        VideosOptions: []VideosOptions{{VideoFile: "1.mp4"}},
+    }
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON).On("ffprobe", "format=duration", "4")
+    sdk := NewVideoSDKV2("").WithRunner(runner)
+    if err := sdk.ProcessVideos(options).Err(); err != nil {
+        t.Fatalf("ProcessVideos error: %v", err)
+    }
+    if lines := strings.Join(runner.CommandLines(), "\n"); !strings.Contains(lines, "-i 1.mp4 -vf scale=720:1280:force_original_aspect_ratio=increase,crop=720:1280:(iw-ow)/2:(ih-oh)/2,setsar=1 ") {
+        t.Errorf("clips should be cropped to fill 720x1280, but got:\n%s", lines)
+    }
+
+    options.Reframe = "zoom"
+    if err := NewVideoSDKV2("").WithRunner(NewFakeRunner()).ProcessVideos(options).Err(); err == nil || !strings.Contains(err.Error(), `unknown reframe mode "zoom"`) {
+        t.Errorf("unknown reframe mode should fail, but got %v", err)
+    }
+}
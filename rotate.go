@@ -0,0 +1,147 @@
+package vidfusion
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "slices"
+)
+
+// 转置方向，对应 ffmpeg transpose 滤镜的 dir 参数
+const (
+    TransposeClock      = "clock"       // 顺时针旋转 90 度
+    TransposeCClock     = "cclock"      // 逆时针旋转 90 度
+    TransposeClockFlip  = "clock_flip"  // 顺时针旋转 90 度后垂直翻转，即沿右上到左下的对角线翻转
+    TransposeCClockFlip = "cclock_flip" // 逆时针旋转 90 度后垂直翻转，即沿左上到右下的对角线翻转
+)
+
+// transposeDirections 支持的转置方向，用于校验和操作参数的可选值
+var transposeDirections = []string{TransposeClock, TransposeCClock, TransposeClockFlip, TransposeCClockFlip}
+
+// RotateOptions 旋转选项
+type RotateOptions struct {
+    Angle  float64 // 顺时针旋转的角度，负数表示逆时针；90 的倍数使用无损的 transpose，其余角度使用 rotate 滤镜
+    Color  string  // 非 90 倍数的角度旋转后露出的角落填充的颜色，默认 black
+    Expand bool    // 非 90 倍数的角度是否扩大画布以容纳完整的画面，默认保持原尺寸并裁掉超出的角落
+}
+
+// Validate 校验角度和填充颜色
+func (o RotateOptions) Validate() error {
+    var errs []error
+    if math.IsNaN(o.Angle) || math.IsInf(o.Angle, 0) {
+        errs = append(errs, fmt.Errorf("invalid angle %v", o.Angle))
+    }
+    if !validColor(o.Color) {
+        errs = append(errs, fmt.Errorf("invalid color %q", o.Color))
+    }
+    return errors.Join(errs...)
+}
+
+// degrees 返回归一化到 [0, 360) 的角度
+func (o RotateOptions) degrees() float64 {
+    degrees := math.Mod(o.Angle, 360)
+    if degrees < 0 {
+        degrees += 360
+    }
+    return degrees
+}
+
+// filter 返回旋转使用的滤镜，不需要旋转时返回空字符串
+func (o RotateOptions) filter() string {
+    switch o.degrees() {
+    case 0:
+        return ""
+    case 90:
+        return "transpose=clock"
+    case 180:
+        return "hflip,vflip"
+    case 270:
+        return "transpose=cclock"
+    }
+    color := o.Color
+    if color == "" {
+        color = "black"
+    }
+    radians := o.degrees() * math.Pi / 180
+    if !o.Expand {
+        return fmt.Sprintf("rotate=%.6f:c=%s", radians, color)
+    }
+    // 宽高取偶数以兼容 yuv420p
+    return fmt.Sprintf("rotate=%.6f:ow=ceil(rotw(%.6f)/2)*2:oh=ceil(roth(%.6f)/2)*2:c=%s", radians, radians, radians, color)
+}
+
+// resize 返回旋转后的画面尺寸
+func (o RotateOptions) resize(width, height int64) (int64, int64) {
+    degrees := o.degrees()
+    switch {
+    case degrees == 90 || degrees == 270:
+        return height, width
+    case !o.Expand || math.Mod(degrees, 90) == 0:
+        return width, height
+    }
+    radians := degrees * math.Pi / 180
+    sin, cos := math.Abs(math.Sin(radians)), math.Abs(math.Cos(radians))
+    even := func(size float64) int64 {
+        return int64(math.Ceil(size/2)) * 2
+    }
+    return even(float64(width)*cos + float64(height)*sin), even(float64(width)*sin + float64(height)*cos)
+}
+
+// Rotate 顺时针旋转视频，负数表示逆时针，任意角度旋转露出的角落填充黑色
+func (sdk *VideoSDKV2) Rotate(angle float64) *VideoSDKV2 {
+    return sdk.RotateWithOptions(RotateOptions{Angle: angle})
+}
+
+// RotateWithOptions 按选项旋转视频，音频保持不变；角度为 360 的倍数时不执行任何命令
+func (sdk *VideoSDKV2) RotateWithOptions(options RotateOptions) *VideoSDKV2 {
+    if sdk.err != nil {
+        return sdk
+    }
+    if err := options.Validate(); err != nil {
+        sdk.fail("Rotate", err)
+        return sdk
+    }
+    filter := options.filter()
+    if filter == "" {
+        return sdk
+    }
+    return sdk.filterVideo("Rotate", filter, options.resize)
+}
+
+// VFlip 垂直翻转视频
+func (sdk *VideoSDKV2) VFlip() *VideoSDKV2 {
+    return sdk.filterVideo("VFlip", "vflip", nil)
+}
+
+// Transpose 按 direction 转置视频，TransposeClock / TransposeCClock / TransposeClockFlip / TransposeCClockFlip，宽高互换
+func (sdk *VideoSDKV2) Transpose(direction string) *VideoSDKV2 {
+    if sdk.err != nil {
+        return sdk
+    }
+    if !slices.Contains(transposeDirections, direction) {
+        sdk.fail("Transpose", fmt.Errorf("unknown transpose direction %q", direction))
+        return sdk
+    }
+    return sdk.filterVideo("Transpose", "transpose="+direction, swapSize)
+}
+
+// NormalizeRotation 按旋转元数据旋转画面并清除元数据，之后的流复制和不支持旋转元数据的播放器都能得到正确方向的画面；
+// 没有旋转元数据时不执行任何命令
+func (sdk *VideoSDKV2) NormalizeRotation() *VideoSDKV2 {
+    if sdk.err != nil {
+        return sdk
+    }
+    info, err := sdk.Probe(sdk.CurrentFile)
+    if err != nil {
+        sdk.fail("NormalizeRotation", err)
+        return sdk
+    }
+    if video := info.VideoStream(); video == nil || video.Rotation == 0 {
+        return sdk
+    }
+    return sdk.runStep("NormalizeRotation", func(outputFile string) []string {
+        // ffmpeg 解码时默认按元数据自动旋转，重新编码后清除输出的旋转标签
+        args := append([]string{"-i", sdk.CurrentFile}, sdk.videoArgs()...)
+        return append(args, "-c:a", "copy", "-metadata:s:v:0", "rotate=0", outputFile)
+    })
+}
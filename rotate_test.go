@@ -0,0 +1,99 @@
+package vidfusion
+
+import (
+    "strings"
+    "testing"
+)
+
+// TestRotateOptions 测试 90 的倍数使用 transpose，任意角度使用 rotate 滤镜并推算输出尺寸
+func TestRotateOptions(t *testing.T) {
+    for _, c := range []struct {
+        options       RotateOptions
+        filter        string
+        width, height int64
+    }{
+        {RotateOptions{Angle: 90}, "transpose=clock", 1080, 1920},
+        {RotateOptions{Angle: -90}, "transpose=cclock", 1080, 1920},
+        {RotateOptions{Angle: 540}, "hflip,vflip", 1920, 1080},
+        {RotateOptions{Angle: -360}, "", 1920, 1080},
+        {RotateOptions{Angle: 30}, "rotate=0.523599:c=black", 1920, 1080},
+        {RotateOptions{Angle: -30, Color: "white", Expand: true}, "rotate=5.759587:ow=ceil(rotw(5.759587)/2)*2:oh=ceil(roth(5.759587)/2)*2:c=white", 2204, 1896},
+    } {
+        if got := c.options.filter(); got != c.filter {
+            t.Errorf("%+v filter should be %q, but got %q", c.options, c.filter, got)
+        }
+        if width, height := c.options.resize(1920, 1080); width != c.width || height != c.height {
+            t.Errorf("%+v should resize 1920x1080 to %dx%d, but got %dx%d", c.options, c.width, c.height, width, height)
+        }
+    }
+}
+
+// TestRotate 测试旋转、垂直翻转和转置生成的命令
+func TestRotate(t *testing.T) {
+    runner := NewFakeRunner()
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner)
+    sdk.Rotate(720).Rotate(-90).VFlip().Transpose(TransposeClockFlip).RotateWithOptions(RotateOptions{Angle: 15, Color: "0x202020"})
+    if sdk.Err() != nil {
+        t.Fatalf("Rotate error: %v", sdk.Err())
+    }
+    lines := runner.CommandLines()
+    // 旋转 720 度不执行命令
+    for i, want := range []string{"-i in.mp4 -vf transpose=cclock ", "-vf vflip ", "-vf transpose=clock_flip ", "-vf rotate=0.261799:c=0x202020 "} {
+        if len(lines) != 4 || !strings.Contains(lines[i], want) {
+            t.Fatalf("command %d should contain %q, but got:\n%s", i, want, strings.Join(lines, "\n"))
+        }
+    }
+
+    sdk = NewVideoSDKV2("in.mp4").WithRunner(NewFakeRunner()).Transpose("flip")
+    if err := sdk.Err(); err == nil || !strings.Contains(err.Error(), `unknown transpose direction "flip"`) {
+        t.Errorf("unknown transpose direction should fail, but got %v", err)
+    }
+    sdk = NewVideoSDKV2("in.mp4").WithRunner(NewFakeRunner()).RotateWithOptions(RotateOptions{Angle: 15, Color: "black[v];movie=a.png"})
+    if err := sdk.Err(); err == nil || !strings.Contains(err.Error(), `invalid color "black[v];movie=a.png"`) {
+        t.Errorf("invalid color should fail, but got %v", err)
+    }
+}
+
+// TestLazy_Rotate 测试延迟模式下按显示尺寸推算旋转后的尺寸
+func TestLazy_Rotate(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner).Lazy()
+    // 源文件 1920x1080 带有旋转元数据，显示为 1080x1920
+    sdk.RotateWithOptions(RotateOptions{Angle: 30, Expand: true}).Transpose(TransposeClock)
+    width, height, err := sdk.GetVideoDimensions(sdk.CurrentFile)
+    if err != nil || width != 2204 || height != 1896 {
+        t.Errorf("GetVideoDimensions should return 2204x1896, but got %dx%d %v", width, height, err)
+    }
+    if lines := runner.CommandLines(); len(lines) != 1 {
+        t.Errorf("dimensions should be inferred without flushing, but got %v", lines)
+    }
+}
+
+// TestNormalizeRotation 测试按旋转元数据旋转画面，没有旋转元数据时跳过
+func TestNormalizeRotation(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner).DryRun()
+    sdk.NormalizeRotation()
+    info, err := sdk.Probe(sdk.CurrentFile)
+    if err != nil || info.VideoStream().Rotation != 0 || info.VideoStream().Width != 1080 || info.VideoStream().Height != 1920 {
+        t.Fatalf("normalized video should be 1080x1920 without rotation, but got %+v %v", info, err)
+    }
+    sdk.NormalizeRotation()
+    commands := sdk.Plan().Commands
+    var ffmpeg []string
+    for _, command := range commands {
+        if command.Name == "ffmpeg" {
+            ffmpeg = append(ffmpeg, strings.Join(command.Args, " "))
+        }
+    }
+    if len(ffmpeg) != 1 || !strings.Contains(ffmpeg[0], "-i in.mp4 -c:v libx264 -c:a copy -metadata:s:v:0 rotate=0 ") {
+        t.Errorf("should normalize rotation once, but got %v", ffmpeg)
+    }
+
+    runner = NewFakeRunner().On("ffprobe", "-show_streams", probeJSON).On("ffprobe", "format=duration", "12.012")
+    sdk = NewVideoSDKV2("").WithRunner(runner)
+    sdk.ProcessVideos(ProcessVideosOptions{VideoDuration: 10, Width: 720, Height: 1280, NormalizeRotation: true, VideosOptions: []VideosOptions{{VideoFile: "1.mp4"}}})
+    if lines := strings.Join(runner.CommandLines(), "\n"); sdk.Err() != nil || !strings.Contains(lines, "-i 1.mp4 -c:v libx264 -c:a copy -metadata:s:v:0 rotate=0 ") {
+        t.Errorf("clips should be normalized on ingest, but got %v:\n%s", sdk.Err(), lines)
+    }
+}
@@ -0,0 +1,33 @@
+package vidfusion
+
+import (
+    "context"
+    "io"
+)
+
+// Command 一次外部命令调用
+type Command struct {
+    Name     string                       // 命令名称，ffmpeg 或 ffprobe
+    Args     []string                     // 命令参数
+    Stdout   io.Writer                    // 标准输出写入位置
+    Stderr   io.Writer                    // 标准错误写入位置
+    Step     string                       // 所属步骤名称
+    Duration func(input float64) float64 // 根据输入时长估算输出时长，为空表示与输入相同
+}
+
+// Runner 执行外部命令的接口，可以注入到 VideoSDK 和 VideoSDKV2 中替换默认的 os/exec 实现
+type Runner interface {
+    // Run 执行命令并等待结束，ctx 取消时应尽快终止命令
+    Run(ctx context.Context, cmd *Command) error
+}
+
+// ExecRunner 基于 os/exec 的默认 Runner，ctx 取消时终止整个进程树
+type ExecRunner struct{}
+
+// Run 执行命令
+func (ExecRunner) Run(ctx context.Context, cmd *Command) error {
+    c := commandContext(ctx, cmd.Name, cmd.Args...)
+    c.Stdout = cmd.Stdout
+    c.Stderr = cmd.Stderr
+    return c.Run()
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "os"
+    "path/filepath"
+
+    "github.com/HeartGarlic/vidfusion"
+)
+
+// routes 注册 HTTP 接口
+//
+//	POST /jobs              提交任务，请求体为 JSON/YAML 配方，或 multipart/form-data（recipe 字段为配方，其余文件为素材）
+//	GET  /jobs              列出所有任务
+//	GET  /jobs/{id}         查询任务状态和进度
+//	POST /jobs/{id}/cancel  取消任务
+//	GET  /jobs/{id}/output  下载输出文件
+func (s *Server) routes() {
+    s.mux = http.NewServeMux()
+    s.mux.HandleFunc("POST /jobs", s.handleSubmit)
+    s.mux.HandleFunc("GET /jobs", s.handleList)
+    s.mux.HandleFunc("GET /jobs/{id}", s.handleGet)
+    s.mux.HandleFunc("POST /jobs/{id}/cancel", s.handleCancel)
+    s.mux.HandleFunc("GET /jobs/{id}/output", s.handleOutput)
+}
+
+// ServeHTTP 实现 http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.mux.ServeHTTP(w, r)
+}
+
+// handleSubmit 提交任务
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+    if s.options.MaxUploadSize > 0 {
+        r.Body = http.MaxBytesReader(w, r.Body, s.options.MaxUploadSize)
+    }
+    id, err := s.store.create()
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    var data []byte
+    mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    if mediaType == "multipart/form-data" {
+        data, err = s.readMultipart(r, s.store.assetsDir(id))
+    } else {
+        data, err = io.ReadAll(r.Body)
+    }
+    if err != nil {
+        _ = s.store.remove(id)
+        var maxBytes *http.MaxBytesError
+        if errors.As(err, &maxBytes) {
+            writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: err.Error()})
+            return
+        }
+        writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+        return
+    }
+    recipe, err := vidfusion.ParseRecipe(data)
+    if err != nil {
+        _ = s.store.remove(id)
+        writeError(w, fmt.Errorf("%w: %w", ErrInvalidJob, err))
+        return
+    }
+    job, err := s.submit(id, recipe)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    w.Header().Set("Location", "/jobs/"+job.ID)
+    writeJSON(w, http.StatusAccepted, job)
+}
+
+// readMultipart 读取 multipart 请求，将上传的文件保存到素材目录并返回 recipe 字段的配方内容
+func (s *Server) readMultipart(r *http.Request, dir string) ([]byte, error) {
+    reader, err := r.MultipartReader()
+    if err != nil {
+        return nil, err
+    }
+    var recipe []byte
+    for {
+        part, err := reader.NextPart()
+        if errors.Is(err, io.EOF) {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        // 配方可以是普通字段，也可以作为文件上传
+        if part.FormName() == "recipe" {
+            if recipe, err = io.ReadAll(part); err != nil {
+                return nil, err
+            }
+            continue
+        }
+        if part.FileName() == "" {
+            return nil, fmt.Errorf("unexpected form field %q", part.FormName())
+        }
+        if err := saveAsset(part, dir, part.FileName()); err != nil {
+            return nil, err
+        }
+    }
+    if recipe == nil {
+        return nil, fmt.Errorf("recipe field is required")
+    }
+    return recipe, nil
+}
+
+// saveAsset 将上传的文件保存到素材目录，只保留文件名
+func saveAsset(src io.Reader, dir, name string) error {
+    name = filepath.Base(filepath.FromSlash(name))
+    if !filepath.IsLocal(name) {
+        return fmt.Errorf("invalid file name %q", name)
+    }
+    file, err := os.Create(filepath.Join(dir, name))
+    if err != nil {
+        return fmt.Errorf("failed to save %s: %v", name, err)
+    }
+    if _, err := io.Copy(file, src); err != nil {
+        _ = file.Close()
+        return fmt.Errorf("failed to save %s: %w", name, err)
+    }
+    return file.Close()
+}
+
+// handleList 列出所有任务
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, s.Jobs())
+}
+
+// handleGet 查询任务
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+    job, err := s.Job(r.PathValue("id"))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, job)
+}
+
+// handleCancel 取消任务
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+    job, err := s.Cancel(r.PathValue("id"))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, job)
+}
+
+// handleOutput 下载输出文件，支持 Range 请求
+func (s *Server) handleOutput(w http.ResponseWriter, r *http.Request) {
+    id := r.PathValue("id")
+    job, err := s.Job(id)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if job.Status != StatusSucceeded {
+        writeJSON(w, http.StatusConflict, errorResponse{Error: fmt.Sprintf("job %s is %s", id, job.Status)})
+        return
+    }
+    file, err := os.Open(filepath.Join(s.store.outputDir(id), job.Output))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    defer file.Close()
+    info, err := file.Stat()
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": job.Output}))
+    http.ServeContent(w, r, job.Output, info.ModTime(), file)
+}
+
+// errorResponse 错误响应
+type errorResponse struct {
+    Error string `json:"error"`
+}
+
+// writeError 根据错误类型返回对应的状态码
+func writeError(w http.ResponseWriter, err error) {
+    status := http.StatusInternalServerError
+    switch {
+    case errors.Is(err, ErrInvalidJob):
+        status = http.StatusBadRequest
+    case errors.Is(err, ErrJobNotFound):
+        status = http.StatusNotFound
+    case errors.Is(err, ErrJobFinished):
+        status = http.StatusConflict
+    case errors.Is(err, ErrClosed):
+        status = http.StatusServiceUnavailable
+    }
+    writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// writeJSON 输出 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    _ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,416 @@
+// Package server 提供可嵌入的 net/http 渲染服务
+// 任务以配方加素材的形式提交，按并发上限排队执行，任务状态保存在本地目录中，重启后未完成的任务会重新执行
+package server
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/HeartGarlic/vidfusion"
+)
+
+// Status 任务状态
+type Status string
+
+// 任务状态
+const (
+    StatusQueued    Status = "queued"    // 排队中
+    StatusRunning   Status = "running"   // 渲染中
+    StatusSucceeded Status = "succeeded" // 渲染成功，可以下载输出文件
+    StatusFailed    Status = "failed"    // 渲染失败
+    StatusCanceled  Status = "canceled"  // 已取消
+)
+
+// 服务返回的错误
+var (
+    ErrInvalidJob  = errors.New("invalid job")          // 配方或素材无效
+    ErrJobNotFound = errors.New("job not found")        // 任务不存在
+    ErrJobFinished = errors.New("job already finished") // 任务已经结束，不能取消
+    ErrClosed      = errors.New("server is closed")     // 服务已关闭
+)
+
+// Job 渲染任务
+type Job struct {
+    ID         string            `json:"id"`                    // 任务 ID
+    Name       string            `json:"name,omitempty"`        // 配方中的任务名称
+    Status     Status            `json:"status"`                // 任务状态
+    Progress   JobProgress       `json:"progress"`              // 渲染进度
+    Error      string            `json:"error,omitempty"`       // 失败原因
+    Output     string            `json:"output"`                // 输出文件名，成功后通过 GET /jobs/{id}/output 下载
+    CreatedAt  time.Time         `json:"created_at"`            // 提交时间
+    StartedAt  *time.Time        `json:"started_at,omitempty"`  // 最近一次开始渲染的时间
+    FinishedAt *time.Time        `json:"finished_at,omitempty"` // 结束时间
+    Recipe     *vidfusion.Recipe `json:"recipe"`                // 配方，相对路径以任务素材目录为基准
+}
+
+// JobProgress 任务的渲染进度
+type JobProgress struct {
+    Step       string  `json:"step,omitempty"` // 当前步骤名称
+    StepIndex  int     `json:"step_index"`     // 当前步骤序号，从 1 开始
+    TotalSteps int     `json:"total_steps"`    // 预计总步骤数
+    Percent    float64 `json:"percent"`        // 整体进度百分比 0-100
+    ETA        float64 `json:"eta"`            // 预计剩余时间（秒）
+}
+
+// Options 渲染服务配置
+type Options struct {
+    Dir           string                       // 任务存储目录，必填
+    Concurrency   int                          // 同时渲染的任务数，默认 1，ffmpeg 本身已经会使用多线程
+    AssetRoots    []string                     // 允许配方以绝对路径引用素材的目录，为空时只能使用上传的素材
+    MaxUploadSize int64                        // 单次提交的最大请求体大小（字节），0 表示不限制
+    NewSDK        func() *vidfusion.VideoSDKV2 // 创建执行任务的 SDK，可以设置 Runner、超时、编码配置等，默认 NewVideoSDKV2("")
+    Logger        *slog.Logger                 // 日志记录器，默认不输出日志
+}
+
+// Server 渲染服务，实现了 http.Handler，可以挂载到已有的 ServeMux 上
+type Server struct {
+    options Options
+    store   store
+    mux     *http.ServeMux
+    logger  *slog.Logger
+
+    ctx      context.Context
+    shutdown context.CancelFunc
+    wg       sync.WaitGroup
+
+    mu       sync.Mutex
+    cond     *sync.Cond
+    closed   bool
+    jobs     map[string]*Job
+    queue    []string
+    cancels  map[string]context.CancelFunc
+    canceled map[string]bool
+}
+
+// New 创建渲染服务并启动工作协程，上次退出时排队中和渲染中的任务会重新排队
+func New(options Options) (*Server, error) {
+    if options.Dir == "" {
+        return nil, fmt.Errorf("server: Dir is required")
+    }
+    if options.Concurrency <= 0 {
+        options.Concurrency = 1
+    }
+    if options.NewSDK == nil {
+        options.NewSDK = func() *vidfusion.VideoSDKV2 { return vidfusion.NewVideoSDKV2("") }
+    }
+    if options.Logger == nil {
+        options.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+    }
+    roots := make([]string, 0, len(options.AssetRoots))
+    for _, root := range options.AssetRoots {
+        abs, err := filepath.Abs(root)
+        if err != nil {
+            return nil, fmt.Errorf("server: invalid asset root %s: %v", root, err)
+        }
+        roots = append(roots, abs)
+    }
+    options.AssetRoots = roots
+    if err := os.MkdirAll(options.Dir, os.ModePerm); err != nil {
+        return nil, fmt.Errorf("server: failed to create job store: %v", err)
+    }
+    s := &Server{
+        options:  options,
+        store:    store{dir: options.Dir, logger: options.Logger},
+        logger:   options.Logger,
+        jobs:     make(map[string]*Job),
+        cancels:  make(map[string]context.CancelFunc),
+        canceled: make(map[string]bool),
+    }
+    s.cond = sync.NewCond(&s.mu)
+    s.ctx, s.shutdown = context.WithCancel(context.Background())
+    jobs, err := s.store.load()
+    if err != nil {
+        return nil, fmt.Errorf("server: %w", err)
+    }
+    for _, job := range jobs {
+        s.jobs[job.ID] = job
+        // 上次退出时被中断的任务重新排队
+        if job.Status == StatusRunning {
+            job.Status = StatusQueued
+            job.Progress = JobProgress{}
+            if err := s.store.save(job); err != nil {
+                return nil, fmt.Errorf("server: %w", err)
+            }
+        }
+        if job.Status == StatusQueued {
+            s.queue = append(s.queue, job.ID)
+        }
+    }
+    s.routes()
+    s.logger.Info("render server started", "dir", options.Dir, "jobs", len(jobs), "queued", len(s.queue))
+    for i := 0; i < options.Concurrency; i++ {
+        s.wg.Add(1)
+        go s.worker()
+    }
+    return s, nil
+}
+
+// Close 停止接收任务并中断正在渲染的任务，被中断的任务保持排队状态，下次启动时重新执行
+func (s *Server) Close() error {
+    s.mu.Lock()
+    if s.closed {
+        s.mu.Unlock()
+        return nil
+    }
+    s.closed = true
+    s.cond.Broadcast()
+    s.mu.Unlock()
+    s.shutdown()
+    s.wg.Wait()
+    return nil
+}
+
+// Submit 提交配方，返回排队中的任务
+// 配方中的相对路径以任务素材目录为基准，绝对路径必须位于 Options.AssetRoots 中，输出文件只取文件名，保存在任务输出目录
+func (s *Server) Submit(recipe *vidfusion.Recipe) (Job, error) {
+    id, err := s.store.create()
+    if err != nil {
+        return Job{}, err
+    }
+    return s.submit(id, recipe)
+}
+
+// submit 校验配方并将已创建目录的任务加入队列，失败时删除任务目录
+func (s *Server) submit(id string, recipe *vidfusion.Recipe) (job Job, err error) {
+    defer func() {
+        if err != nil {
+            _ = s.store.remove(id)
+        }
+    }()
+    if recipe.BaseDir != "" {
+        return Job{}, fmt.Errorf("%w: base_dir is set by the server", ErrInvalidJob)
+    }
+    if err := recipe.Validate(); err != nil {
+        return Job{}, fmt.Errorf("%w: %w", ErrInvalidJob, err)
+    }
+    recipe.BaseDir = s.store.assetsDir(id)
+    if err := s.checkAssets(recipe); err != nil {
+        return Job{}, fmt.Errorf("%w: %w", ErrInvalidJob, err)
+    }
+    output := filepath.Base(recipe.Output.File)
+    recipe.Output.File = filepath.Join(s.store.outputDir(id), output)
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.closed {
+        return Job{}, ErrClosed
+    }
+    created := &Job{
+        ID:        id,
+        Name:      recipe.Name,
+        Status:    StatusQueued,
+        Output:    output,
+        CreatedAt: time.Now(),
+        Recipe:    recipe,
+    }
+    if err := s.store.save(created); err != nil {
+        return Job{}, err
+    }
+    s.jobs[id] = created
+    s.queue = append(s.queue, id)
+    s.cond.Signal()
+    s.logger.Info("job queued", "job", id, "name", recipe.Name)
+    return *created, nil
+}
+
+// checkAssets 检查配方引用的素材都存在，且没有引用素材目录和 AssetRoots 以外的文件
+func (s *Server) checkAssets(recipe *vidfusion.Recipe) error {
+    var errs []error
+    for _, file := range recipe.Assets() {
+        path := file
+        if filepath.IsAbs(file) {
+            if !s.allowed(file) {
+                errs = append(errs, fmt.Errorf("%s is outside the allowed asset roots", file))
+                continue
+            }
+        } else if filepath.IsLocal(file) {
+            path = filepath.Join(recipe.BaseDir, file)
+        } else {
+            errs = append(errs, fmt.Errorf("%s is outside the job assets", file))
+            continue
+        }
+        if info, err := os.Stat(path); err != nil || info.IsDir() {
+            errs = append(errs, fmt.Errorf("asset %s not found", file))
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// allowed 判断绝对路径是否位于 AssetRoots 中
+func (s *Server) allowed(file string) bool {
+    for _, root := range s.options.AssetRoots {
+        if rel, err := filepath.Rel(root, file); err == nil && filepath.IsLocal(rel) {
+            return true
+        }
+    }
+    return false
+}
+
+// Jobs 返回所有任务，按提交时间排序
+func (s *Server) Jobs() []Job {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    jobs := make([]Job, 0, len(s.jobs))
+    for _, job := range s.jobs {
+        jobs = append(jobs, *job)
+    }
+    sort.SliceStable(jobs, func(i, j int) bool {
+        return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+    })
+    return jobs
+}
+
+// Job 返回指定任务
+func (s *Server) Job(id string) (Job, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    job, ok := s.jobs[id]
+    if !ok {
+        return Job{}, ErrJobNotFound
+    }
+    return *job, nil
+}
+
+// Cancel 取消排队中或渲染中的任务，渲染中的任务会终止正在执行的 ffmpeg
+func (s *Server) Cancel(id string) (Job, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    job, ok := s.jobs[id]
+    if !ok {
+        return Job{}, ErrJobNotFound
+    }
+    switch job.Status {
+    case StatusQueued:
+        for i, queued := range s.queue {
+            if queued == id {
+                s.queue = append(s.queue[:i], s.queue[i+1:]...)
+                break
+            }
+        }
+        s.finish(job, StatusCanceled, "")
+    case StatusRunning:
+        // 由工作协程在 ffmpeg 退出后更新状态
+        s.canceled[id] = true
+        s.cancels[id]()
+    default:
+        return *job, ErrJobFinished
+    }
+    s.logger.Info("job canceled", "job", id)
+    return *job, nil
+}
+
+// OutputFile 返回成功任务的输出文件路径
+func (s *Server) OutputFile(id string) (string, error) {
+    job, err := s.Job(id)
+    if err != nil {
+        return "", err
+    }
+    if job.Status != StatusSucceeded {
+        return "", fmt.Errorf("job %s is %s", id, job.Status)
+    }
+    return filepath.Join(s.store.outputDir(id), job.Output), nil
+}
+
+// worker 依次取出排队的任务执行，直到服务关闭
+func (s *Server) worker() {
+    defer s.wg.Done()
+    for {
+        job, ctx := s.next()
+        if job == nil {
+            return
+        }
+        s.execute(ctx, job)
+    }
+}
+
+// next 等待并取出下一个排队的任务，服务关闭时返回 nil
+func (s *Server) next() (*Job, context.Context) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for len(s.queue) == 0 && !s.closed {
+        s.cond.Wait()
+    }
+    if s.closed {
+        return nil, nil
+    }
+    job := s.jobs[s.queue[0]]
+    s.queue = s.queue[1:]
+    ctx, cancel := context.WithCancel(s.ctx)
+    s.cancels[job.ID] = cancel
+    now := time.Now()
+    job.Status = StatusRunning
+    job.StartedAt = &now
+    job.Progress = JobProgress{}
+    s.save(job)
+    return job, ctx
+}
+
+// execute 执行任务的配方并记录结果
+func (s *Server) execute(ctx context.Context, job *Job) {
+    s.logger.Info("job started", "job", job.ID)
+    sdk := s.options.NewSDK().WithContext(ctx).OnProgress(func(p vidfusion.Progress) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        job.Progress = JobProgress{
+            Step:       p.Step,
+            StepIndex:  p.StepIndex,
+            TotalSteps: p.TotalSteps,
+            Percent:    p.OverallPercent,
+            ETA:        p.ETA.Seconds(),
+        }
+    })
+    _, err := job.Recipe.Execute(sdk)
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.cancels[job.ID]()
+    delete(s.cancels, job.ID)
+    canceled := s.canceled[job.ID]
+    delete(s.canceled, job.ID)
+    switch {
+    case err == nil:
+        job.Progress.Percent = 100
+        job.Progress.ETA = 0
+        s.finish(job, StatusSucceeded, "")
+        s.logger.Info("job succeeded", "job", job.ID)
+    case canceled:
+        _ = os.Remove(job.Recipe.Output.File)
+        s.finish(job, StatusCanceled, "")
+    case s.ctx.Err() != nil:
+        // 服务关闭导致的中断，保持排队状态等待下次启动
+        _ = os.Remove(job.Recipe.Output.File)
+        job.Status = StatusQueued
+        job.Progress = JobProgress{}
+        s.save(job)
+        s.logger.Info("job interrupted by shutdown", "job", job.ID)
+    default:
+        _ = os.Remove(job.Recipe.Output.File)
+        s.finish(job, StatusFailed, err.Error())
+        s.logger.Error("job failed", "job", job.ID, "error", err)
+    }
+}
+
+// finish 将任务标记为结束状态，调用方需要持有锁
+func (s *Server) finish(job *Job, status Status, message string) {
+    now := time.Now()
+    job.Status = status
+    job.Error = message
+    job.FinishedAt = &now
+    s.save(job)
+}
+
+// save 保存任务状态，失败时只记录日志，内存中的状态仍然有效
+func (s *Server) save(job *Job) {
+    if err := s.store.save(job); err != nil {
+        s.logger.Error("failed to persist job", "job", job.ID, "error", err)
+    }
+}
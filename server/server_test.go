@@ -0,0 +1,330 @@
+package server
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "io"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/HeartGarlic/vidfusion"
+)
+
+// renderRunner 模拟 ffmpeg 的 Runner，将输出写入最后一个参数指定的文件
+// blocked 为 true 时 ffmpeg 会一直等待直到 ctx 取消
+type renderRunner struct {
+    mu      sync.Mutex
+    blocked bool
+    lines   []string
+}
+
+// Run 记录命令并生成输出文件
+func (r *renderRunner) Run(ctx context.Context, cmd *vidfusion.Command) error {
+    r.mu.Lock()
+    r.lines = append(r.lines, cmd.Name+" "+strings.Join(cmd.Args, " "))
+    blocked := r.blocked
+    r.mu.Unlock()
+    if cmd.Name != "ffmpeg" {
+        return nil
+    }
+    if blocked {
+        <-ctx.Done()
+        return ctx.Err()
+    }
+    return os.WriteFile(cmd.Args[len(cmd.Args)-1], []byte("rendered"), 0o644)
+}
+
+// commandLines 返回记录的命令行
+func (r *renderRunner) commandLines() []string {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return append([]string(nil), r.lines...)
+}
+
+// newTestServer 创建使用 renderRunner 的渲染服务和本地 HTTP 服务
+func newTestServer(t *testing.T, dir string, runner *renderRunner, roots ...string) (*Server, *httptest.Server) {
+    t.Helper()
+    srv, err := New(Options{
+        Dir:        dir,
+        AssetRoots: roots,
+        NewSDK: func() *vidfusion.VideoSDKV2 {
+            return vidfusion.NewVideoSDKV2("").WithRunner(runner)
+        },
+    })
+    if err != nil {
+        t.Fatalf("New error: %v", err)
+    }
+    ts := httptest.NewServer(srv)
+    t.Cleanup(func() {
+        ts.Close()
+        _ = srv.Close()
+    })
+    return srv, ts
+}
+
+// writeAsset 在目录中创建素材文件
+func writeAsset(t *testing.T, dir, name string) string {
+    t.Helper()
+    path := filepath.Join(dir, name)
+    if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+// decodeJob 解析任务响应
+func decodeJob(t *testing.T, resp *http.Response, status int) Job {
+    t.Helper()
+    defer resp.Body.Close()
+    body, _ := io.ReadAll(resp.Body)
+    if resp.StatusCode != status {
+        t.Fatalf("status should be %d, but got %d: %s", status, resp.StatusCode, body)
+    }
+    var job Job
+    if err := json.Unmarshal(body, &job); err != nil {
+        t.Fatalf("failed to decode job: %v: %s", err, body)
+    }
+    return job
+}
+
+// waitStatus 轮询任务直到进入指定状态
+func waitStatus(t *testing.T, ts *httptest.Server, id string, status Status) Job {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        resp, err := http.Get(ts.URL + "/jobs/" + id)
+        if err != nil {
+            t.Fatal(err)
+        }
+        job := decodeJob(t, resp, http.StatusOK)
+        if job.Status == status {
+            return job
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("job %s should be %s, but is %s: %s", id, status, job.Status, job.Error)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+// TestServer_SubmitJSON 测试提交引用本地素材路径的 JSON 配方并下载输出
+func TestServer_SubmitJSON(t *testing.T) {
+    assets := t.TempDir()
+    input := writeAsset(t, assets, "in.mp4")
+    runner := &renderRunner{}
+    _, ts := newTestServer(t, t.TempDir(), runner, assets)
+
+    recipe := `{"name": "demo", "input": "` + filepath.ToSlash(input) + `", "trim": {"start": 1, "end": 3}, "output": {"file": "out/final.mp4"}}`
+    resp, err := http.Post(ts.URL+"/jobs", "application/json", strings.NewReader(recipe))
+    if err != nil {
+        t.Fatal(err)
+    }
+    job := decodeJob(t, resp, http.StatusAccepted)
+    if resp.Header.Get("Location") != "/jobs/"+job.ID || job.Name != "demo" || job.Output != "final.mp4" {
+        t.Fatalf("unexpected job: %+v", job)
+    }
+    job = waitStatus(t, ts, job.ID, StatusSucceeded)
+    if job.Progress.Percent != 100 || job.FinishedAt == nil {
+        t.Errorf("succeeded job should be complete, but got %+v", job)
+    }
+    if lines := runner.commandLines(); len(lines) == 0 || !strings.Contains(strings.Join(lines, "\n"), "-i "+input+" -ss 1.00 -to 3.00") {
+        t.Errorf("recipe should be executed, but got %v", lines)
+    }
+
+    resp, err = http.Get(ts.URL + "/jobs/" + job.ID + "/output")
+    if err != nil {
+        t.Fatal(err)
+    }
+    body, _ := io.ReadAll(resp.Body)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK || string(body) != "rendered" || !strings.Contains(resp.Header.Get("Content-Disposition"), "final.mp4") {
+        t.Errorf("output should be downloaded, but got %d %q %v", resp.StatusCode, body, resp.Header)
+    }
+
+    resp, err = http.Get(ts.URL + "/jobs")
+    if err != nil {
+        t.Fatal(err)
+    }
+    var jobs []Job
+    _ = json.NewDecoder(resp.Body).Decode(&jobs)
+    resp.Body.Close()
+    if len(jobs) != 1 || jobs[0].ID != job.ID {
+        t.Errorf("job list should contain the job, but got %+v", jobs)
+    }
+}
+
+// TestServer_SubmitMultipart 测试上传素材和 YAML 配方
+func TestServer_SubmitMultipart(t *testing.T) {
+    dir := t.TempDir()
+    runner := &renderRunner{}
+    _, ts := newTestServer(t, dir, runner)
+
+    var body bytes.Buffer
+    writer := multipart.NewWriter(&body)
+    _ = writer.WriteField("recipe", "input: in.mp4\nmute: true\noutput:\n  file: out.mp4\n")
+    part, _ := writer.CreateFormFile("video", "in.mp4")
+    _, _ = part.Write([]byte("video"))
+    _ = writer.Close()
+    resp, err := http.Post(ts.URL+"/jobs", writer.FormDataContentType(), &body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    job := decodeJob(t, resp, http.StatusAccepted)
+    waitStatus(t, ts, job.ID, StatusSucceeded)
+    uploaded := filepath.Join(dir, job.ID, "assets", "in.mp4")
+    if data, err := os.ReadFile(uploaded); err != nil || string(data) != "video" {
+        t.Fatalf("uploaded asset should be saved, but got %q %v", data, err)
+    }
+    if lines := runner.commandLines(); !strings.Contains(strings.Join(lines, "\n"), "-i "+uploaded) {
+        t.Errorf("relative paths should resolve to uploaded assets, but got %v", lines)
+    }
+}
+
+// TestServer_SubmitInvalid 测试无效的配方和素材引用
+func TestServer_SubmitInvalid(t *testing.T) {
+    dir := t.TempDir()
+    assets := t.TempDir()
+    writeAsset(t, assets, "in.mp4")
+    outside := writeAsset(t, t.TempDir(), "secret.mp4")
+    _, ts := newTestServer(t, dir, &renderRunner{}, assets)
+
+    for recipe, want := range map[string]string{
+        `{"input": "in.mp4", "output": {"file": "out.mp4"}}`:                            "asset in.mp4 not found",
+        `{"input": "../in.mp4", "output": {"file": "out.mp4"}}`:                         "outside the job assets",
+        `{"input": "` + filepath.ToSlash(outside) + `", "output": {"file": "out.mp4"}}`: "outside the allowed asset roots",
+        `{"input": "in.mp4", "base_dir": "/", "output": {"file": "out.mp4"}}`:           "base_dir is set by the server",
+        `{"input": "in.mp4", "output": {}}`:                                             "output: file is required",
+        `{"input": "in.mp4", "unknown": 1, "output": {"file": "out.mp4"}}`:              "unknown",
+    } {
+        resp, err := http.Post(ts.URL+"/jobs", "application/json", strings.NewReader(recipe))
+        if err != nil {
+            t.Fatal(err)
+        }
+        body, _ := io.ReadAll(resp.Body)
+        resp.Body.Close()
+        if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), want) {
+            t.Errorf("%s should be rejected with %q, but got %d %s", recipe, want, resp.StatusCode, body)
+        }
+    }
+    if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+        t.Errorf("rejected jobs should not be stored, but got %d entries", len(entries))
+    }
+    for _, path := range []string{"/jobs/missing", "/jobs/missing/output"} {
+        resp, err := http.Get(ts.URL + path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        resp.Body.Close()
+        if resp.StatusCode != http.StatusNotFound {
+            t.Errorf("%s should be 404, but got %d", path, resp.StatusCode)
+        }
+    }
+}
+
+// TestServer_Cancel 测试取消渲染中和排队中的任务
+func TestServer_Cancel(t *testing.T) {
+    assets := t.TempDir()
+    input := writeAsset(t, assets, "in.mp4")
+    srv, ts := newTestServer(t, t.TempDir(), &renderRunner{blocked: true}, assets)
+    recipe := &vidfusion.Recipe{Input: input, Mute: true, Output: vidfusion.RecipeOutput{File: "out.mp4"}}
+    running, err := srv.Submit(recipe)
+    if err != nil {
+        t.Fatal(err)
+    }
+    queued, err := srv.Submit(&vidfusion.Recipe{Input: input, Mute: true, Output: vidfusion.RecipeOutput{File: "out.mp4"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    waitStatus(t, ts, running.ID, StatusRunning)
+
+    resp, err := http.Get(ts.URL + "/jobs/" + running.ID + "/output")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusConflict {
+        t.Errorf("output of a running job should be 409, but got %d", resp.StatusCode)
+    }
+
+    for _, id := range []string{queued.ID, running.ID} {
+        resp, err := http.Post(ts.URL+"/jobs/"+id+"/cancel", "", nil)
+        if err != nil {
+            t.Fatal(err)
+        }
+        decodeJob(t, resp, http.StatusOK)
+        waitStatus(t, ts, id, StatusCanceled)
+    }
+    resp, err = http.Post(ts.URL+"/jobs/"+running.ID+"/cancel", "", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusConflict {
+        t.Errorf("canceling a finished job should be 409, but got %d", resp.StatusCode)
+    }
+}
+
+// TestServer_Restart 测试重启后继续执行被中断和排队中的任务
+func TestServer_Restart(t *testing.T) {
+    dir := t.TempDir()
+    assets := t.TempDir()
+    input := writeAsset(t, assets, "in.mp4")
+    srv, ts := newTestServer(t, dir, &renderRunner{blocked: true}, assets)
+    var ids []string
+    for i := 0; i < 2; i++ {
+        job, err := srv.Submit(&vidfusion.Recipe{Input: input, Mute: true, Output: vidfusion.RecipeOutput{File: "out.mp4"}})
+        if err != nil {
+            t.Fatal(err)
+        }
+        ids = append(ids, job.ID)
+    }
+    waitStatus(t, ts, ids[0], StatusRunning)
+    _ = srv.Close()
+    if _, err := srv.Submit(&vidfusion.Recipe{Input: input, Output: vidfusion.RecipeOutput{File: "out.mp4"}}); err != ErrClosed {
+        t.Errorf("closed server should reject jobs, but got %v", err)
+    }
+    for _, id := range ids {
+        data, err := os.ReadFile(filepath.Join(dir, id, jobFile))
+        if err != nil || !strings.Contains(string(data), `"status": "queued"`) {
+            t.Fatalf("interrupted job should be persisted as queued, but got %s %v", data, err)
+        }
+        if _, err := os.Stat(filepath.Join(dir, id, pendingFile)); !os.IsNotExist(err) {
+            t.Errorf("saved job should not be marked as unfinished, but got %v", err)
+        }
+    }
+
+    _, ts = newTestServer(t, dir, &renderRunner{}, assets)
+    for _, id := range ids {
+        waitStatus(t, ts, id, StatusSucceeded)
+    }
+}
+
+// TestServer_LoadUnfinished 测试启动时只清理服务创建但未保存状态的任务目录，保留其他目录
+func TestServer_LoadUnfinished(t *testing.T) {
+    dir := t.TempDir()
+    unfinished, err := store{dir: dir}.create()
+    if err != nil {
+        t.Fatal(err)
+    }
+    unknown := filepath.Join(dir, "backups")
+    if err := os.MkdirAll(unknown, os.ModePerm); err != nil {
+        t.Fatal(err)
+    }
+    keep := writeAsset(t, unknown, "keep.mp4")
+
+    newTestServer(t, dir, &renderRunner{})
+    if _, err := os.Stat(filepath.Join(dir, unfinished)); !os.IsNotExist(err) {
+        t.Errorf("unfinished job directory should be removed, but got %v", err)
+    }
+    if _, err := os.Stat(keep); err != nil {
+        t.Errorf("unknown directory should be kept, but got %v", err)
+    }
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "sort"
+)
+
+// jobFile 保存任务状态的文件名
+const jobFile = "job.json"
+
+// pendingFile 标记任务目录由服务创建但尚未写入状态文件，只有带标记的目录会在启动时被清理
+const pendingFile = ".pending"
+
+// store 基于本地目录的任务存储，每个任务一个子目录
+// <dir>/<id>/job.json 保存任务状态，assets/ 保存上传的素材，output/ 保存渲染结果
+type store struct {
+    dir    string
+    logger *slog.Logger
+}
+
+// jobDir 任务目录
+func (s store) jobDir(id string) string {
+    return filepath.Join(s.dir, id)
+}
+
+// assetsDir 任务素材目录，也是配方中相对路径的基准目录
+func (s store) assetsDir(id string) string {
+    return filepath.Join(s.dir, id, "assets")
+}
+
+// outputDir 任务输出目录
+func (s store) outputDir(id string) string {
+    return filepath.Join(s.dir, id, "output")
+}
+
+// create 生成新的任务 ID 并创建任务目录
+func (s store) create() (string, error) {
+    buf := make([]byte, 8)
+    if _, err := rand.Read(buf); err != nil {
+        return "", fmt.Errorf("failed to generate job id: %v", err)
+    }
+    id := hex.EncodeToString(buf)
+    for _, dir := range []string{s.assetsDir(id), s.outputDir(id)} {
+        if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+            return "", fmt.Errorf("failed to create job directory: %v", err)
+        }
+    }
+    if err := os.WriteFile(filepath.Join(s.jobDir(id), pendingFile), nil, 0o644); err != nil {
+        return "", fmt.Errorf("failed to create job directory: %v", err)
+    }
+    return id, nil
+}
+
+// save 保存任务状态，先写临时文件再重命名，避免进程退出时留下不完整的文件；首次保存后移除未完成标记
+func (s store) save(job *Job) error {
+    data, err := json.MarshalIndent(job, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode job %s: %v", job.ID, err)
+    }
+    path := filepath.Join(s.jobDir(job.ID), jobFile)
+    if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+        return fmt.Errorf("failed to save job %s: %v", job.ID, err)
+    }
+    if err := os.Rename(path+".tmp", path); err != nil {
+        return fmt.Errorf("failed to save job %s: %v", job.ID, err)
+    }
+    if err := os.Remove(filepath.Join(s.jobDir(job.ID), pendingFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+        return fmt.Errorf("failed to save job %s: %v", job.ID, err)
+    }
+    return nil
+}
+
+// load 读取所有任务并按创建时间排序，带有未完成标记的目录是提交到一半的任务，直接删除；
+// 其他没有状态文件的目录不是服务创建的，跳过并保留
+func (s store) load() ([]*Job, error) {
+    entries, err := os.ReadDir(s.dir)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read job store: %v", err)
+    }
+    var jobs []*Job
+    for _, entry := range entries {
+        if !entry.IsDir() {
+            continue
+        }
+        data, err := os.ReadFile(filepath.Join(s.dir, entry.Name(), jobFile))
+        if errors.Is(err, os.ErrNotExist) {
+            if _, err := os.Stat(filepath.Join(s.dir, entry.Name(), pendingFile)); err == nil {
+                s.logger.Info("removing unfinished job", "job", entry.Name())
+                _ = s.remove(entry.Name())
+            } else {
+                s.logger.Warn("skipping unknown directory in job store", "dir", entry.Name())
+            }
+            continue
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to load job %s: %v", entry.Name(), err)
+        }
+        var job Job
+        if err := json.Unmarshal(data, &job); err != nil {
+            return nil, fmt.Errorf("failed to load job %s: %v", entry.Name(), err)
+        }
+        jobs = append(jobs, &job)
+    }
+    sort.SliceStable(jobs, func(i, j int) bool {
+        return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+    })
+    return jobs, nil
+}
+
+// remove 删除任务目录
+func (s store) remove(id string) error {
+    return os.RemoveAll(s.jobDir(id))
+}
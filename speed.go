@@ -0,0 +1,174 @@
+package vidfusion
+
+import (
+    "errors"
+    "fmt"
+)
+
+// SpeedKeyframe 变速曲线的关键帧，从 Time 开始到下一个关键帧之间按 Speed 倍速播放
+type SpeedKeyframe struct {
+    Time  float64 `json:"time" yaml:"time"`   // 源视频中的时间点（秒）
+    Speed float64 `json:"speed" yaml:"speed"` // 速度倍数，大于 1 加速，小于 1 慢动作
+}
+
+// SpeedCurveOptions 变速曲线选项，第一个关键帧之前按原速播放
+type SpeedCurveOptions struct {
+    Keyframes   []SpeedKeyframe `json:"keyframes" yaml:"keyframes"`                         // 按时间递增的关键帧
+    Audio       string          `json:"audio,omitempty" yaml:"audio,omitempty"`             // 音频的处理方式 SpeedAudioTempo / SpeedAudioDrop，默认 SpeedAudioTempo
+    Interpolate bool            `json:"interpolate,omitempty" yaml:"interpolate,omitempty"` // 慢于原速的区间是否使用 minterpolate 补帧
+    FrameRate   float64         `json:"frame_rate,omitempty" yaml:"frame_rate,omitempty"`   // 补帧的目标帧率，默认 30
+}
+
+// speedSegment 变速曲线中速度不变的一段，end 为 0 表示到视频结尾
+type speedSegment struct {
+    start, end, speed float64
+}
+
+// Validate 校验关键帧和音频处理方式
+func (o SpeedCurveOptions) Validate() error {
+    var errs []error
+    if len(o.Keyframes) == 0 {
+        errs = append(errs, fmt.Errorf("keyframes is empty"))
+    }
+    for i, k := range o.Keyframes {
+        if k.Time < 0 {
+            errs = append(errs, fmt.Errorf("keyframes[%d]: time should not be negative", i))
+        }
+        if k.Speed <= 0 {
+            errs = append(errs, fmt.Errorf("keyframes[%d]: speed must be positive", i))
+        }
+        if i > 0 && k.Time <= o.Keyframes[i-1].Time {
+            errs = append(errs, fmt.Errorf("keyframes[%d]: time (%.2f) should be greater than the previous keyframe (%.2f)", i, k.Time, o.Keyframes[i-1].Time))
+        }
+    }
+    if o.Audio != "" && o.Audio != SpeedAudioTempo && o.Audio != SpeedAudioDrop {
+        errs = append(errs, fmt.Errorf("unknown speed audio mode %q", o.Audio))
+    }
+    if o.FrameRate < 0 {
+        errs = append(errs, fmt.Errorf("frame rate should not be negative"))
+    }
+    return errors.Join(errs...)
+}
+
+// segments 将关键帧拆分为速度不变的区间
+func (o SpeedCurveOptions) segments() []speedSegment {
+    var segments []speedSegment
+    if first := o.Keyframes[0]; first.Time > 0 {
+        segments = append(segments, speedSegment{0, first.Time, 1})
+    }
+    for i, k := range o.Keyframes {
+        segment := speedSegment{start: k.Time, speed: k.Speed}
+        if i+1 < len(o.Keyframes) {
+            segment.end = o.Keyframes[i+1].Time
+        }
+        segments = append(segments, segment)
+    }
+    return segments
+}
+
+// OutputDuration 计算时长为 source 的视频按变速曲线处理后的时长，source 未知（为 0）时返回 0
+func (o SpeedCurveOptions) OutputDuration(source float64) float64 {
+    if source <= 0 {
+        return 0
+    }
+    var duration float64
+    for _, s := range o.segments() {
+        end := s.end
+        if end == 0 || end > source {
+            end = source
+        }
+        if end > s.start {
+            duration += (end - s.start) / s.speed
+        }
+    }
+    return duration
+}
+
+// frameRate 补帧的目标帧率
+func (o SpeedCurveOptions) frameRate() float64 {
+    if o.FrameRate > 0 {
+        return o.FrameRate
+    }
+    return 30
+}
+
+// trim 返回区间的 trim / atrim 参数
+func (s speedSegment) trim() string {
+    if s.end == 0 {
+        return fmt.Sprintf("start=%.3f", s.start)
+    }
+    return fmt.Sprintf("start=%.3f:end=%.3f", s.start, s.end)
+}
+
+// apply 将变速曲线追加到滤镜图：按区间拆分音视频流，分别变速后再用 concat 滤镜拼接
+func (o SpeedCurveOptions) apply(g *filterGraph) error {
+    for i, k := range o.Keyframes {
+        if g.duration > 0 && k.Time >= g.duration {
+            return fmt.Errorf("keyframes[%d]: time (%.2f) should be less than the duration (%.2f)", i, k.Time, g.duration)
+        }
+    }
+    if o.Audio == SpeedAudioDrop {
+        g.audio = ""
+    }
+    segments := o.segments()
+    videos := g.splitStream("v", g.video, len(segments))
+    var audios []string
+    if g.audio != "" {
+        audios = g.splitStream("a", g.audio, len(segments))
+    }
+    var parts []string
+    for i, s := range segments {
+        filter := fmt.Sprintf("trim=%s,setpts=%f*(PTS-STARTPTS)", s.trim(), 1/s.speed)
+        if o.Interpolate && s.speed < 1 {
+            // 慢动作区间用运动补偿插帧，避免重复帧造成的卡顿
+            filter += fmt.Sprintf(",minterpolate=fps=%s:mi_mode=mci:mc_mode=aobmc:vsbmc=1", frameRateExpr(o.frameRate()))
+        }
+        parts = append(parts, g.addFilter("v", filter, videos[i]))
+        if audios != nil {
+            parts = append(parts, g.addFilter("a", fmt.Sprintf("atrim=%s,asetpts=PTS-STARTPTS,%s", s.trim(), atempoFilter(s.speed)), audios[i]))
+        }
+    }
+    switch {
+    case len(segments) == 1 && audios == nil:
+        g.video = parts[0]
+    case len(segments) == 1:
+        g.video, g.audio = parts[0], parts[1]
+    case audios == nil:
+        g.video = g.addFilter("v", fmt.Sprintf("concat=n=%d:v=1:a=0", len(segments)), parts...)
+    default:
+        // concat 滤镜要求输入按 [v0][a0][v1][a1] 的顺序交错排列
+        outputs := g.addMultiFilter(fmt.Sprintf("concat=n=%d:v=1:a=1", len(segments)), parts, "v", "a")
+        g.video, g.audio = outputs[0], outputs[1]
+    }
+    g.duration = o.OutputDuration(g.duration)
+    return nil
+}
+
+// SpeedCurve 按关键帧变速，可以在一条命令中实现加速、慢动作和速度渐变，
+// 慢于原速的区间可以使用 minterpolate 补帧，输出时长可以通过 SpeedCurveOptions.OutputDuration 预先计算
+func (sdk *VideoSDKV2) SpeedCurve(options SpeedCurveOptions) *VideoSDKV2 {
+    if sdk.err != nil {
+        return sdk
+    }
+    if err := options.Validate(); err != nil {
+        sdk.fail("SpeedCurve", err)
+        return sdk
+    }
+    if sdk.lazy {
+        return sdk.appendNode("SpeedCurve", options.apply)
+    }
+    info, err := sdk.Probe(sdk.CurrentFile)
+    if err != nil {
+        sdk.fail("SpeedCurve", err)
+        return sdk
+    }
+    graph := newFilterGraph(sdk.CurrentFile, info)
+    if err := options.apply(graph); err != nil {
+        sdk.fail("SpeedCurve", err)
+        return sdk
+    }
+    sdk.log().Info("speed curve", "segments", len(options.segments()), "duration", graph.duration)
+    return sdk.runStepDuration("SpeedCurve", graph.outputDuration, func(outputFile string) []string {
+        return graph.compile(outputFile, sdk.encoderProfile())
+    })
+}
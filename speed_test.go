@@ -0,0 +1,76 @@
+package vidfusion
+
+import (
+    "strings"
+    "testing"
+)
+
+// TestSpeedCurveOptions_OutputDuration 测试按关键帧计算变速后的时长
+func TestSpeedCurveOptions_OutputDuration(t *testing.T) {
+    for _, c := range []struct {
+        keyframes []SpeedKeyframe
+        source    float64
+        want      float64
+    }{
+        {[]SpeedKeyframe{{Time: 0, Speed: 2}}, 10, 5},
+        {[]SpeedKeyframe{{Time: 2, Speed: 0.5}, {Time: 4, Speed: 4}}, 12, 2 + 4 + 2},
+        {[]SpeedKeyframe{{Time: 2, Speed: 0.5}, {Time: 20, Speed: 4}}, 12, 2 + 20},
+        {[]SpeedKeyframe{{Time: 2, Speed: 0.5}}, 0, 0},
+    } {
+        if got := (SpeedCurveOptions{Keyframes: c.keyframes}).OutputDuration(c.source); got != c.want {
+            t.Errorf("%v of %vs should last %vs, but got %v", c.keyframes, c.source, c.want, got)
+        }
+    }
+}
+
+// TestSpeedCurve 测试按区间拆分变速后拼接，慢动作区间补帧
+func TestSpeedCurve(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner)
+    sdk.SpeedCurve(SpeedCurveOptions{Keyframes: []SpeedKeyframe{{Time: 2, Speed: 0.5}, {Time: 4, Speed: 2}}, Interpolate: true, FrameRate: 60})
+    if sdk.Err() != nil {
+        t.Fatalf("SpeedCurve error: %v", sdk.Err())
+    }
+    lines := runner.CommandLines()
+    want := "-i in.mp4 -filter_complex [0:v]split=3[v1][v2][v3];[0:a]asplit=3[a4][a5][a6];" +
+        "[v1]trim=start=0.000:end=2.000,setpts=1.000000*(PTS-STARTPTS)[v7];[a4]atrim=start=0.000:end=2.000,asetpts=PTS-STARTPTS,atempo=1[a8];" +
+        "[v2]trim=start=2.000:end=4.000,setpts=2.000000*(PTS-STARTPTS),minterpolate=fps=60:mi_mode=mci:mc_mode=aobmc:vsbmc=1[v9];[a5]atrim=start=2.000:end=4.000,asetpts=PTS-STARTPTS,atempo=0.5[a10];" +
+        "[v3]trim=start=4.000,setpts=0.500000*(PTS-STARTPTS)[v11];[a6]atrim=start=4.000,asetpts=PTS-STARTPTS,atempo=2[a12];" +
+        "[v7][a8][v9][a10][v11][a12]concat=n=3:v=1:a=1[v13][a14] -map [v13] -c:v libx264 -map [a14] -c:a aac -b:a 192k "
+    if len(lines) != 2 || !strings.Contains(lines[1], want) {
+        t.Errorf("command should contain %q, but got:\n%s", want, strings.Join(lines, "\n"))
+    }
+}
+
+// TestLazy_SpeedCurve 测试延迟模式下变速曲线与其他节点合并，丢弃音频时不拆分音频流
+func TestLazy_SpeedCurve(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner).Lazy()
+    sdk.FlipVideo().SpeedCurve(SpeedCurveOptions{Keyframes: []SpeedKeyframe{{Time: 6, Speed: 3}}, Audio: SpeedAudioDrop})
+    // 6 + 6.012 / 3
+    if duration, err := sdk.GetVideoDuration(sdk.CurrentFile); err != nil || duration != 8.004 {
+        t.Errorf("duration should be 8.004s, but got %v %v", duration, err)
+    }
+    sdk.Flush()
+    lines := runner.CommandLines()
+    want := "[0:v]hflip[v1];[v1]split=2[v2][v3];[v2]trim=start=0.000:end=6.000,setpts=1.000000*(PTS-STARTPTS)[v4];" +
+        "[v3]trim=start=6.000,setpts=0.333333*(PTS-STARTPTS)[v5];[v4][v5]concat=n=2:v=1:a=0[v6] -map [v6] -c:v libx264 -an "
+    if sdk.Err() != nil || len(lines) != 2 || !strings.Contains(lines[1], want) {
+        t.Errorf("command should contain %q, but got %v %v", want, lines, sdk.Err())
+    }
+
+    for _, c := range []struct {
+        options SpeedCurveOptions
+        want    string
+    }{
+        {SpeedCurveOptions{}, "keyframes is empty"},
+        {SpeedCurveOptions{Keyframes: []SpeedKeyframe{{Time: 2, Speed: 1}, {Time: 1, Speed: 0}}}, "keyframes[1]: speed must be positive\nkeyframes[1]: time (1.00) should be greater than the previous keyframe (2.00)"},
+        {SpeedCurveOptions{Keyframes: []SpeedKeyframe{{Time: 1, Speed: 2}}, Audio: "mute"}, `unknown speed audio mode "mute"`},
+        {SpeedCurveOptions{Keyframes: []SpeedKeyframe{{Time: 15, Speed: 2}}}, "keyframes[0]: time (15.00) should be less than the duration (12.01)"},
+    } {
+        sdk := NewVideoSDKV2("in.mp4").WithRunner(NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)).Lazy()
+        if err := sdk.SpeedCurve(c.options).Err(); err == nil || !strings.Contains(err.Error(), c.want) {
+            t.Errorf("%+v should fail with %q, but got %v", c.options, c.want, err)
+        }
+    }
+}
@@ -0,0 +1,129 @@
+package vidfusion
+
+import (
+    "errors"
+    "fmt"
+    "slices"
+    "strings"
+)
+
+// TransitionCut 硬切，用于在设置了默认转场时指定某个衔接处不使用转场
+const TransitionCut = "cut"
+
+// xfadeTransitions ffmpeg xfade 滤镜支持的转场效果
+var xfadeTransitions = []string{
+    "fade", "fadeblack", "fadewhite", "fadegrays", "fadefast", "fadeslow", "dissolve", "distance", "pixelize", "radial", "hblur",
+    "wipeleft", "wiperight", "wipeup", "wipedown", "wipetl", "wipetr", "wipebl", "wipebr",
+    "slideleft", "slideright", "slideup", "slidedown", "smoothleft", "smoothright", "smoothup", "smoothdown",
+    "circlecrop", "rectcrop", "circleclose", "circleopen", "horzclose", "horzopen", "vertclose", "vertopen",
+    "diagbl", "diagbr", "diagtl", "diagtr", "hlslice", "hrslice", "vuslice", "vdslice", "squeezeh", "squeezev", "zoomin",
+}
+
+// Transition 两个片段衔接处的转场，前一个片段的结尾和后一个片段的开头重叠 Duration 秒
+type Transition struct {
+    Type     string  `json:"type,omitempty" yaml:"type,omitempty"` // xfade 转场效果，例如 fade、dissolve、wipeleft、slideleft、zoomin、circleopen，默认 fade；TransitionCut 表示硬切
+    Duration float64 `json:"duration" yaml:"duration"`             // 转场时长（秒）
+}
+
+// Validate 校验转场效果和时长
+func (t *Transition) Validate() error {
+    if t == nil || t.Type == TransitionCut {
+        return nil
+    }
+    var errs []error
+    if t.Type != "" && !slices.Contains(xfadeTransitions, t.Type) {
+        errs = append(errs, fmt.Errorf("unknown transition %q", t.Type))
+    }
+    if t.Duration <= 0 {
+        errs = append(errs, fmt.Errorf("transition duration must be positive"))
+    }
+    return errors.Join(errs...)
+}
+
+// overlap 返回转场重叠的时长，硬切时为 0
+func (t *Transition) overlap() float64 {
+    if t == nil || t.Type == TransitionCut {
+        return 0
+    }
+    return t.Duration
+}
+
+// filter 返回转场使用的 xfade 滤镜
+func (t *Transition) filter(offset float64) string {
+    transition := t.Type
+    if transition == "" {
+        transition = "fade"
+    }
+    return fmt.Sprintf("xfade=transition=%s:duration=%.3f:offset=%.3f", transition, t.Duration, offset)
+}
+
+// concatTransitions 使用 xfade / acrossfade 合并视频，硬切的衔接处使用 concat 滤镜
+// 每个视频先统一尺寸、帧率、像素格式和音频格式，没有音轨的视频使用静音
+func (sdk *VideoSDKV2) concatTransitions(videoList []string, options ConcatOptions, transitions []*Transition) *VideoSDKV2 {
+    defer sdk.trackStep("ConcatenateVideos", 1)()
+    format := sdk.concatFormat(options)
+    durations := make([]float64, len(videoList))
+    withAudio := make([]bool, len(videoList))
+    for i, video := range videoList {
+        info, err := sdk.Probe(video)
+        if err != nil {
+            sdk.fail("ConcatenateVideos", err)
+            return sdk
+        }
+        durations[i] = rangeAt(options.Ranges, i).length(info.Format.Duration)
+        withAudio[i] = info.HasAudio()
+    }
+
+    args := []string{}
+    var filters []string
+    for i, video := range videoList {
+        args = append(args, rangeAt(options.Ranges, i).args()...)
+        args = append(args, "-i", video)
+        // xfade 要求两路输入的尺寸、帧率、像素格式和时间基相同
+        filters = append(filters, fmt.Sprintf("[%d:v]%s,settb=AVTB[v%d]", i, normalizeFilter(options.Width, options.Height, "1", format.frameRate, format.pixelFormat), i))
+        if withAudio[i] {
+            filters = append(filters, fmt.Sprintf("[%d:a]aresample=%d,aformat=sample_fmts=fltp:channel_layouts=stereo[a%d]", i, format.sampleRate, i))
+        } else {
+            filters = append(filters, fmt.Sprintf("anullsrc=r=%d:cl=stereo,atrim=duration=%.3f,aformat=sample_fmts=fltp[a%d]", format.sampleRate, durations[i], i))
+        }
+    }
+    video, audio := "v0", "a0"
+    length := durations[0]
+    for i := 1; i < len(videoList); i++ {
+        transition := transitions[i-1]
+        overlap := transition.overlap()
+        nextVideo, nextAudio := fmt.Sprintf("xv%d", i), fmt.Sprintf("xa%d", i)
+        if overlap == 0 {
+            filters = append(filters,
+                fmt.Sprintf("[%s][v%d]concat=n=2:v=1:a=0[%s]", video, i, nextVideo),
+                fmt.Sprintf("[%s][a%d]concat=n=2:v=0:a=1[%s]", audio, i, nextAudio))
+        } else {
+            if overlap >= durations[i-1] || overlap >= durations[i] {
+                sdk.fail("ConcatenateVideos", fmt.Errorf("transition %d (%.2fs) must be shorter than %s (%.2fs) and %s (%.2fs)", i-1, overlap, videoList[i-1], durations[i-1], videoList[i], durations[i]))
+                return sdk
+            }
+            filters = append(filters,
+                fmt.Sprintf("[%s][v%d]%s[%s]", video, i, transition.filter(length-overlap), nextVideo),
+                fmt.Sprintf("[%s][a%d]acrossfade=d=%.3f[%s]", audio, i, overlap, nextAudio))
+        }
+        video, audio = nextVideo, nextAudio
+        length += durations[i] - overlap
+    }
+
+    duration := func(float64) float64 {
+        return length
+    }
+    return sdk.runStepDuration("ConcatenateVideos", duration, func(outputFile string) []string {
+        args := append(args, "-filter_complex", strings.Join(filters, ";"), "-map", "["+video+"]")
+        args = append(args, sdk.videoArgs()...)
+        return append(args, "-map", "["+audio+"]", "-c:a", "aac", "-b:a", "192k", outputFile)
+    })
+}
+
+// transition 返回片段 clip 之后衔接处的转场，片段设置的转场优先于默认转场
+func (o ProcessVideosOptions) transition(clip int) *Transition {
+    if transition := o.VideosOptions[clip].Transition; transition != nil {
+        return transition
+    }
+    return o.Transition
+}
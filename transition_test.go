@@ -0,0 +1,162 @@
+package vidfusion
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// TestConcatenateVideosWithOptions 测试按衔接处使用不同的转场合并视频
+func TestConcatenateVideosWithOptions(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk := NewVideoSDKV2("").WithRunner(runner)
+    sdk.ConcatenateVideosWithOptions([]string{"1.mp4", "2.mp4", "3.mp4", "4.mp4"}, ConcatOptions{
+        Width:       720,
+        Height:      1280,
+        Transition:  &Transition{Duration: 1},
+        Transitions: []*Transition{nil, {Type: "wipeleft", Duration: 0.5}, {Type: TransitionCut}},
+    })
+    if sdk.Err() != nil {
+        t.Fatalf("ConcatenateVideosWithOptions error: %v", sdk.Err())
+    }
+    var ffmpeg []string
+    for _, line := range runner.CommandLines() {
+        if strings.HasPrefix(line, "ffmpeg ") {
+            ffmpeg = append(ffmpeg, line)
+        }
+    }
+    if len(ffmpeg) != 1 {
+        t.Fatalf("should concat in a single command, but got:\n%s", strings.Join(ffmpeg, "\n"))
+    }
+    for _, want := range []string{
+        "-i 1.mp4 -i 2.mp4 -i 3.mp4 -i 4.mp4 -filter_complex ",
+        "[0:v]scale=720:1280:force_original_aspect_ratio=decrease,pad=720:1280:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=30,format=yuv420p,settb=AVTB[v0]",
+        "[v0][v1]xfade=transition=fade:duration=1.000:offset=11.012[xv1]",
+        "[a0][a1]acrossfade=d=1.000[xa1]",
+        "[xv1][v2]xfade=transition=wipeleft:duration=0.500:offset=22.524[xv2]",
+        "[xv2][v3]concat=n=2:v=1:a=0[xv3]",
+        "[xa2][a3]concat=n=2:v=0:a=1[xa3]",
+        "-map [xv3] ",
+        "-map [xa3] -c:a aac",
+    } {
+        if !strings.Contains(ffmpeg[0], want) {
+            t.Errorf("command should contain %q:\n%s", want, ffmpeg[0])
+        }
+    }
+
+    runner = NewFakeRunner().On("ffprobe", "-show_streams", probeJSON)
+    sdk = NewVideoSDKV2("").WithRunner(runner)
+    sdk.ConcatenateVideosWithOptions([]string{"1.mp4", "2.mp4"}, ConcatOptions{Width: 720, Height: 1280, Transitions: []*Transition{{Type: TransitionCut}}})
+    if sdk.Err() != nil {
+        t.Fatalf("ConcatenateVideosWithOptions error: %v", sdk.Err())
+    }
+    if lines := strings.Join(runner.CommandLines(), "\n"); !strings.Contains(lines, "-f concat") || strings.Contains(lines, "xfade") {
+        t.Errorf("hard cuts should use the concat demuxer, but got:\n%s", lines)
+    }
+}
+
+// TestConcatenateVideosWithOptions_Invalid 测试无效的转场
+func TestConcatenateVideosWithOptions_Invalid(t *testing.T) {
+    for _, c := range []struct {
+        options ConcatOptions
+        want    string
+    }{
+        {ConcatOptions{Transition: &Transition{Type: "spin", Duration: 1}}, `unknown transition "spin"`},
+        {ConcatOptions{Transition: &Transition{Type: "fade"}}, "transition duration must be positive"},
+        {ConcatOptions{Transitions: []*Transition{nil, {Duration: -1}}}, "transitions[1]: transition duration must be positive"},
+        {ConcatOptions{Transitions: []*Transition{nil, nil, nil}}, "3 transitions for 3 videos"},
+        {ConcatOptions{Transition: &Transition{Duration: 20}}, "transition 0 (20.00s) must be shorter than 1.mp4 (12.01s)"},
+    } {
+        sdk := NewVideoSDKV2("").WithRunner(NewFakeRunner().On("ffprobe", "-show_streams", probeJSON))
+        sdk.ConcatenateVideosWithOptions([]string{"1.mp4", "2.mp4", "3.mp4"}, c.options)
+        if err := sdk.Err(); err == nil || !strings.Contains(err.Error(), c.want) {
+            t.Errorf("%+v should fail with %q, but got %v", c.options, c.want, err)
+        }
+    }
+}
+
+// TestProcessVideos_Transition 测试转场重叠的部分不计入总时长，片段设置的转场优先于默认转场
+func TestProcessVideos_Transition(t *testing.T) {
+    options := ProcessVideosOptions{
+        VideoDuration: 12,
+        Transition:    &Transition{Duration: 1},
+        VideosOptions: []VideosOptions{{VideoFile: "a.mp4"}, {VideoFile: "b.mp4", Transition: &Transition{Type: TransitionCut}}, {VideoFile: "c.mp4"}},
+    }
+    lengths := []float64{4, 6, 10}
+    for fill, want := range map[string]string{
+        FillLoop: "0:0-4@0~1 1:0-6@3 2:0-3@9",
+        FillOnce: "0:0-2.6@0~1 1:0-3.9@1.6 2:0-6.5@5.5",
+    } {
+        options.Fill = fill
+        _, manifest, err := fillSegments(options, lengths)
+        if err != nil {
+            t.Fatalf("%s: fillSegments error: %v", fill, err)
+        }
+        var got []string
+        for _, s := range manifest.Segments {
+            segment := fmt.Sprintf("%d:%g-%.2g@%.2g", s.Clip, s.Start, s.End, s.Offset)
+            if s.Transition > 0 {
+                segment += fmt.Sprintf("~%g", s.Transition)
+            }
+            got = append(got, segment)
+        }
+        if strings.Join(got, " ") != want {
+            t.Errorf("%s: segments should be %s, but got %s", fill, want, strings.Join(got, " "))
+        }
+    }
+
+    // 按比例缩短后比转场还短的片段，以及循环时跟在长转场之后的短片段，在处理片段之前报错
+    for _, c := range []struct {
+        fill     string
+        duration float64
+        lengths  []float64
+        want     string
+    }{
+        {FillOnce, 6, []float64{1.5, 10}, "once: a.mp4 (0.94s) must be longer than the transition after it (1.20s)"},
+        {FillLoop, 20, []float64{10, 3}, "loop: b.mp4 (3.00s) must be longer than the transition before it (5.00s)"},
+    } {
+        transition := &Transition{Duration: 1.2}
+        if c.fill == FillLoop {
+            transition.Duration = 5
+        }
+        options := ProcessVideosOptions{VideoDuration: c.duration, Fill: c.fill, VideosOptions: []VideosOptions{{VideoFile: "a.mp4", Transition: transition}, {VideoFile: "b.mp4"}}}
+        if _, _, err := fillSegments(options, c.lengths); err == nil || err.Error() != c.want {
+            t.Errorf("%s: short clips next to a transition should fail with %q, but got %v", c.fill, c.want, err)
+        }
+    }
+
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON).On("ffprobe", "format=duration", "4")
+    sdk := NewVideoSDKV2("").WithRunner(runner)
+    sdk.ProcessVideos(ProcessVideosOptions{
+        VideoDuration: 10,
+        Width:         720,
+        Height:        1280,
+        Transition:    &Transition{Type: "dissolve", Duration: 1},
+        VideosOptions: []VideosOptions{{VideoFile: "1.mp4"}, {VideoFile: "2.mp4"}},
+    })
+    if sdk.Err() != nil {
+        t.Fatalf("ProcessVideos error: %v", sdk.Err())
+    }
+    if manifest := sdk.Manifest(); len(manifest.Segments) != 3 || manifest.Segments[2].Offset != 6 || manifest.Segments[2].End != 4 {
+        t.Errorf("3 clips with 1s transitions should fill 10s, but got %+v", manifest)
+    }
+    lines := strings.Join(runner.CommandLines(), "\n")
+    if strings.Count(lines, "xfade=transition=dissolve") != 2 || strings.Contains(lines, "-f concat") {
+        t.Errorf("clips should be joined with dissolve transitions, but got:\n%s", lines)
+    }
+
+    // 转场不短于片段时循环填充无法增加总时长，需要在选择片段之前报错而不是无限循环
+    for _, fill := range []string{FillLoop, FillShuffle} {
+        sdk = NewVideoSDKV2("").WithRunner(NewFakeRunner().On("ffprobe", "-show_streams", probeJSON).On("ffprobe", "format=duration", "4"))
+        sdk.ProcessVideos(ProcessVideosOptions{
+            VideoDuration: 10,
+            Width:         720,
+            Height:        1280,
+            Fill:          fill,
+            VideosOptions: []VideosOptions{{VideoFile: "1.mp4", Transition: &Transition{Type: "fade", Duration: 4}}},
+        })
+        if err := sdk.Err(); err == nil || !strings.Contains(err.Error(), "video 1.mp4 (4.00s) must be longer than its transition (4.00s)") {
+            t.Errorf("%s: transition as long as the clip should fail, but got %v", fill, err)
+        }
+    }
+}
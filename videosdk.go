@@ -1,59 +1,175 @@
 package vidfusion
 
 import (
+    "context"
     "fmt"
     "io/ioutil"
+    "log/slog"
     "os"
     "path/filepath"
+    "strings"
+    "time"
 )
 
 // VideoSDK 核心结构体
-type VideoSDK struct{}
+type VideoSDK struct {
+    executor
+}
 
 // NewVideoSDK 创建 VideoSDK 实例
 func NewVideoSDK() *VideoSDK {
     return &VideoSDK{}
 }
 
+// WithContext 返回使用 ctx 执行命令的 VideoSDK 副本，ctx 取消时正在执行的 ffmpeg 进程树会被终止
+func (sdk *VideoSDK) WithContext(ctx context.Context) *VideoSDK {
+    clone := *sdk
+    clone.ctx = ctx
+    return &clone
+}
+
+// WithTimeout 返回为每条命令设置超时时间的 VideoSDK 副本，0 表示不限制
+func (sdk *VideoSDK) WithTimeout(timeout time.Duration) *VideoSDK {
+    clone := *sdk
+    clone.timeout = timeout
+    return &clone
+}
+
+// WithRunner 返回使用 runner 执行命令的 VideoSDK 副本
+func (sdk *VideoSDK) WithRunner(runner Runner) *VideoSDK {
+    clone := *sdk
+    clone.runner = runner
+    return &clone
+}
+
+// WithLogger 返回使用 logger 记录日志的 VideoSDK 副本，默认丢弃所有日志
+func (sdk *VideoSDK) WithLogger(logger *slog.Logger) *VideoSDK {
+    clone := *sdk
+    clone.logger = logger
+    return &clone
+}
+
+// WithEncoder 返回使用 profile 编码视频的 VideoSDK 副本，默认使用全局 Encoder
+func (sdk *VideoSDK) WithEncoder(profile EncoderProfile) *VideoSDK {
+    clone := *sdk
+    clone.encoder = &profile
+    return &clone
+}
+
 // GetMP3Duration 获取 MP3 文件时长
 func (sdk *VideoSDK) GetMP3Duration(mp3File string) (float64, error) {
-    return runCommandAndExtractFloat("ffprobe", "-i", mp3File, "-show_entries", "format=duration", "-v", "quiet", "-of", "csv=p=0")
+    return sdk.runCommandAndExtractFloat("ffprobe", "-i", mp3File, "-show_entries", "format=duration", "-v", "quiet", "-of", "csv=p=0")
 }
 
 // GetVideoDuration 获取视频时长
 func (sdk *VideoSDK) GetVideoDuration(videoFile string) (float64, error) {
-    return runCommandAndExtractFloat("ffprobe", "-i", videoFile, "-show_entries", "format=duration", "-v", "quiet", "-of", "csv=p=0")
+    return sdk.runCommandAndExtractFloat("ffprobe", "-i", videoFile, "-show_entries", "format=duration", "-v", "quiet", "-of", "csv=p=0")
 }
 
 // CropVideoTimeline 裁剪视频时间线
 func (sdk *VideoSDK) CropVideoTimeline(inputFile, outputFile string, start, end float64) error {
-    return runCommand("ffmpeg", "-i", inputFile, "-ss", fmt.Sprintf("%.2f", start), "-to", fmt.Sprintf("%.2f", end), outputFile)
+    args := append([]string{"-i", inputFile, "-ss", fmt.Sprintf("%.2f", start), "-to", fmt.Sprintf("%.2f", end)}, sdk.videoArgs()...)
+    return sdk.runCommand("ffmpeg", append(args, outputFile)...)
 }
 
-// CropVideo 裁剪视频
+// CropVideo 从画面中心裁剪出 width x height 的区域，不缩放画面
 func (sdk *VideoSDK) CropVideo(inputFile, outputFile string, width, height int64) error {
-    return runCommand("ffmpeg", "-i", inputFile, "-vf", fmt.Sprintf("scale=%d:%d", width, height), outputFile)
+    return sdk.CropVideoWithOptions(inputFile, outputFile, CropOptions{Width: width, Height: height, Gravity: GravityCenter})
+}
+
+// CropVideoWithOptions 按选项裁剪画面区域
+func (sdk *VideoSDK) CropVideoWithOptions(inputFile, outputFile string, options CropOptions) error {
+    if err := options.Validate(); err != nil {
+        return err
+    }
+    args := append([]string{"-i", inputFile, "-vf", options.filter()}, sdk.videoArgs()...)
+    return sdk.runCommand("ffmpeg", append(args, "-c:a", "copy", outputFile)...)
+}
+
+// Reframe 将画面调整为目标尺寸，宽高比不同时按 Mode 拉伸、填充纯色、裁剪或填充模糊背景
+func (sdk *VideoSDK) Reframe(inputFile, outputFile string, options ReframeOptions) error {
+    if err := options.Validate(); err != nil {
+        return err
+    }
+    args := append([]string{"-i", inputFile, "-vf", options.filter()}, sdk.videoArgs()...)
+    return sdk.runCommand("ffmpeg", append(args, "-c:a", "copy", outputFile)...)
 }
 
 // FlipVideo 翻转视频
 func (sdk *VideoSDK) FlipVideo(inputFile, outputFile string) error {
-    return runCommand("ffmpeg", "-i", inputFile, "-vf", "hflip", "-c:v", "libx264", "-c:a", "copy", outputFile)
+    args := append([]string{"-i", inputFile, "-vf", "hflip"}, sdk.videoArgs()...)
+    return sdk.runCommand("ffmpeg", append(args, "-c:a", "copy", outputFile)...)
 }
 
-// SpeedUpVideo 加速视频
+// 加速视频时音频的处理方式
+const (
+    SpeedAudioTempo = "tempo" // 使用 atempo 同步变速，音调保持不变（默认）
+    SpeedAudioDrop  = "drop"  // 去掉音频
+)
+
+// SpeedOptions 加速视频选项
+type SpeedOptions struct {
+    Speed float64 // 速度倍数，大于 1 加速，小于 1 减速，输出时长为原时长除以 Speed
+    Audio string  // 音频的处理方式 SpeedAudioTempo / SpeedAudioDrop，默认 SpeedAudioTempo
+}
+
+// Validate 校验加速选项
+func (o SpeedOptions) Validate() error {
+    if o.Speed <= 0 {
+        return fmt.Errorf("speed must be positive")
+    }
+    if o.Audio != "" && o.Audio != SpeedAudioTempo && o.Audio != SpeedAudioDrop {
+        return fmt.Errorf("unknown speed audio mode %q", o.Audio)
+    }
+    return nil
+}
+
+// args 返回视频和音频的变速参数，视频编码参数插入在两者之间
+func (o SpeedOptions) args(videoArgs []string) []string {
+    args := append([]string{"-filter:v", fmt.Sprintf("setpts=%f*PTS", 1/o.Speed)}, videoArgs...)
+    if o.Audio == SpeedAudioDrop {
+        return append(args, "-an")
+    }
+    // 没有音轨时 ffmpeg 会忽略音频滤镜
+    return append(args, "-filter:a", atempoFilter(o.Speed), "-c:a", "aac")
+}
+
+// atempoFilter 返回音频变速滤镜，atempo 单个滤镜只支持 0.5 到 2 倍，超出范围时串联多个
+func atempoFilter(speed float64) string {
+    var filters []string
+    for ; speed > 2; speed /= 2 {
+        filters = append(filters, "atempo=2")
+    }
+    for ; speed < 0.5; speed /= 0.5 {
+        filters = append(filters, "atempo=0.5")
+    }
+    return strings.Join(append(filters, fmt.Sprintf("atempo=%.6g", speed)), ",")
+}
+
+// SpeedUpVideo 加速视频，音频使用 atempo 同步变速
 func (sdk *VideoSDK) SpeedUpVideo(inputFile, outputFile string, speed float64) error {
-    return runCommand("ffmpeg", "-i", inputFile, "-filter:v", fmt.Sprintf("setpts=%f*PTS", 1/speed), outputFile)
+    return sdk.SpeedUpVideoWithOptions(inputFile, outputFile, SpeedOptions{Speed: speed})
+}
+
+// SpeedUpVideoWithOptions 按选项加速视频
+func (sdk *VideoSDK) SpeedUpVideoWithOptions(inputFile, outputFile string, options SpeedOptions) error {
+    if err := options.Validate(); err != nil {
+        return err
+    }
+    args := append([]string{"-i", inputFile}, options.args(sdk.videoArgs())...)
+    return sdk.runCommand("ffmpeg", append(args, outputFile)...)
 }
 
 // ScaleUpVideo 放大视频
 func (sdk *VideoSDK) ScaleUpVideo(inputFile, outputFile string, scale float64) error {
-    return runCommand("ffmpeg", "-i", inputFile, "-vf", fmt.Sprintf("scale=iw*%f:ih*%f", scale, scale), outputFile)
+    args := append([]string{"-i", inputFile, "-vf", fmt.Sprintf("scale=iw*%f:ih*%f", scale, scale)}, sdk.videoArgs()...)
+    return sdk.runCommand("ffmpeg", append(args, outputFile)...)
 }
 
 // AddBackgroundMusic 添加背景音乐
 func (sdk *VideoSDK) AddBackgroundMusic(videoFile, audioFile, outputFile string, volume float64) error {
     // 构建 ffmpeg 命令
-    return runCommand("ffmpeg",
+    return sdk.runCommand("ffmpeg",
         "-i", videoFile,
         "-i", audioFile,
         "-filter_complex", fmt.Sprintf("[1:a]volume=%.1f[a1];[0:a][a1]amix=inputs=2:duration=first:dropout_transition=2[a]", volume),
@@ -67,20 +183,25 @@ func (sdk *VideoSDK) AddBackgroundMusic(videoFile, audioFile, outputFile string,
     )
 }
 
-// GetVideoDimensions 获取视频的宽度和高度
+// Probe 使用 ffprobe 一次性探测文件的容器和所有流信息
+func (sdk *VideoSDK) Probe(file string) (*MediaInfo, error) {
+    return sdk.probe(file)
+}
+
+// GetVideoDimensions 获取视频显示时的宽度和高度，带有旋转元数据的竖屏视频返回旋转后的宽高
 func (sdk *VideoSDK) GetVideoDimensions(videoFile string) (int64, int64, error) {
-    return runCommandAndExtractDimensions("ffprobe", "-v", "error", "-select_streams", "v:0", "-show_entries", "stream=width,height", "-of", "csv=s=x:p=0", videoFile)
+    return sdk.videoDimensions(videoFile)
 }
 
 // OverlayOptions 用于配置图片覆盖选项
 type OverlayOptions struct {
-    ImageWidth  int64  // 图片宽度
-    ImageHeight int64  // 图片高度
-    XPosition   int64  // 图片起始的 X 坐标
-    YPosition   int64  // 图片起始的 Y 坐标
-    VideoFile   string // 视频文件路径
-    ImageFile   string // 图片文件路径
-    OutputFile  string // 输出文件路径
+    ImageWidth  int64  `json:"width" yaml:"width"`   // 图片宽度
+    ImageHeight int64  `json:"height" yaml:"height"` // 图片高度
+    XPosition   int64  `json:"x" yaml:"x"`           // 图片起始的 X 坐标
+    YPosition   int64  `json:"y" yaml:"y"`           // 图片起始的 Y 坐标
+    VideoFile   string `json:"-" yaml:"-"`           // 视频文件路径
+    ImageFile   string `json:"image" yaml:"image"`   // 图片文件路径
+    OutputFile  string `json:"-" yaml:"-"`           // 输出文件路径
 }
 
 // AddImageOverlay 添加图片覆盖，支持设置图片大小、起始位置
@@ -88,14 +209,14 @@ func (sdk *VideoSDK) AddImageOverlay(options OverlayOptions) error {
     // 使用传入的宽度和高度来缩放图片，并在指定位置进行覆盖
     filterComplex := fmt.Sprintf("[1:v]scale=%d:%d[img];[0:v][img]overlay=%d:%d",
         options.ImageWidth, options.ImageHeight, options.XPosition, options.YPosition)
-    
-    return runCommand("ffmpeg", "-i", options.VideoFile, "-i", options.ImageFile,
-        "-filter_complex", filterComplex,
-        "-c:v", "libx264", "-preset", "slow", "-crf", "23", "-c:a", "copy", options.OutputFile)
+
+    args := append([]string{"-i", options.VideoFile, "-i", options.ImageFile, "-filter_complex", filterComplex}, sdk.videoArgs()...)
+    return sdk.runCommand("ffmpeg", append(args, "-c:a", "copy", options.OutputFile)...)
 }
 
-// ConcatenateVideos 合并多个视频，在视频尺寸不一致时，强制合并
+// ConcatenateVideos 合并多个视频，合并前将每个视频等比缩放并填充到目标尺寸，统一帧率、像素格式和音频，没有音轨的视频补充静音
 func (sdk *VideoSDK) ConcatenateVideos(videoList []string, outputFile string, targetWidth, targetHeight int) error {
+    format := sdk.concatFormat(ConcatOptions{})
     // 创建一个唯一的临时文件
     tempFile, err := ioutil.TempFile("", "videos_*.txt")
     if err != nil {
@@ -103,32 +224,25 @@ func (sdk *VideoSDK) ConcatenateVideos(videoList []string, outputFile string, ta
     }
     defer os.Remove(tempFile.Name()) // 确保在函数结束时删除临时文件
     defer tempFile.Close()
-    
+
     // 创建一个临时目录存储缩放后的视频
     tempDir, err := ioutil.TempDir("", "scaled_videos")
     if err != nil {
         return fmt.Errorf("failed to create temp dir: %v", err)
     }
     defer os.RemoveAll(tempDir) // 确保临时目录在完成后被删除
-    
+
     // 逐个视频进行缩放处理
-    for _, video := range videoList {
-        // 为每个视频生成一个新的输出文件名
-        scaledVideo := filepath.Join(tempDir, filepath.Base(video))
-        
-        // 使用 ffmpeg 缩放视频到指定尺寸并统一帧率
-        // 如果视频尺寸大于目标尺寸，则裁剪
-        scaleFilter := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", targetWidth, targetHeight)
-        err := runCommand(
-            "ffmpeg",
-            "-i", video,
-            "-vf", scaleFilter,
-            "-r", "30",
-            "-c:a", "copy",
-            scaledVideo,
-        )
+    for i, video := range videoList {
+        info, err := sdk.probe(video)
         if err != nil {
-            return fmt.Errorf("failed to scale video %s: %v", video, err)
+            return fmt.Errorf("failed to probe video %s: %w", video, err)
+        }
+        // 不同目录下的视频可能同名，临时文件名加上序号避免覆盖
+        scaledVideo := filepath.Join(tempDir, fmt.Sprintf("%d_%s", i, filepath.Base(video)))
+        args := sdk.scaledArgs(video, ConcatRange{}, info.HasAudio(), int64(targetWidth), int64(targetHeight), format, scaledVideo)
+        if err := sdk.runCommand("ffmpeg", args...); err != nil {
+            return fmt.Errorf("failed to scale video %s: %w", video, err)
         }
         // 将处理后的视频路径写入临时文件
         _, err = tempFile.WriteString(fmt.Sprintf("file '%s'\n", scaledVideo))
@@ -136,14 +250,14 @@ func (sdk *VideoSDK) ConcatenateVideos(videoList []string, outputFile string, ta
             return fmt.Errorf("failed to write to temp file: %v", err)
         }
     }
-    
-    // 使用缩放后的视频进行合并，不带入视频原声，强制编码
-    return runCommand("ffmpeg", "-f", "concat", "-safe", "0", "-i", tempFile.Name(), "-c:v", "libx264", outputFile)
+
+    // 所有视频的参数已经一致，合并时不需要重新编码
+    return sdk.runCommand("ffmpeg", "-f", "concat", "-safe", "0", "-i", tempFile.Name(), "-c", "copy", outputFile)
 }
 
 // MuteVideo 关闭视频原声
 func (sdk *VideoSDK) MuteVideo(videoFile, outputFile string) error {
-    return runCommand(
+    return sdk.runCommand(
         "ffmpeg",
         "-i", videoFile,
         "-an", // 移除视频中的所有音轨
@@ -157,7 +271,7 @@ func (sdk *VideoSDK) MuteVideo(videoFile, outputFile string) error {
 
 // MuteTrack 添加静音音轨
 func (sdk *VideoSDK) MuteTrack(videoFile, outputFile string) error {
-    return runCommand(
+    return sdk.runCommand(
         "ffmpeg",
         "-i", videoFile,
         "-f", "lavfi", "-i", "anullsrc=r=44100:cl=stereo", // 添加静音音轨
@@ -170,12 +284,12 @@ func (sdk *VideoSDK) MuteTrack(videoFile, outputFile string) error {
 
 // SubtitleOptions 用于配置字幕样式的选项
 type SubtitleOptions struct {
-    FontSize  int64  // 字号
-    XPosition int64  // 左右位置（负值表示靠右）
-    YPosition int64  // 上下位置（负值表示靠下）
-    Font      string // 字体
-    FontColor string // 字体颜色
-    Alignment int64  // 对齐方式（1 左对齐，2 居中对齐，3 右对齐）
+    FontSize  int64  `json:"font_size" yaml:"font_size"`   // 字号
+    XPosition int64  `json:"x" yaml:"x"`                   // 左右位置（负值表示靠右）
+    YPosition int64  `json:"y" yaml:"y"`                   // 上下位置（负值表示靠下）
+    Font      string `json:"font" yaml:"font"`             // 字体
+    FontColor string `json:"font_color" yaml:"font_color"` // 字体颜色
+    Alignment int64  `json:"alignment" yaml:"alignment"`   // 对齐方式（1 左对齐，2 居中对齐，3 右对齐）
 }
 
 // AddSubtitles 添加字幕并应用样式
@@ -191,18 +305,20 @@ func (sdk *VideoSDK) AddSubtitles(videoFile, subtitleFile, outputFile string, op
         options.XPosition, // 如果想要两个边距相同，可以重复使用
         options.YPosition,
     )
-    
+
     // 使用转义后的文件路径和样式
-    return runCommand("ffmpeg",
+    args := []string{
         "-i", videoFile,
         "-i", subtitleFile,
         "-vf", fmt.Sprintf("subtitles='%s':force_style='%s'", subtitleFile, style), // 使用双引号
-        "-c:v", "libx264",
+    }
+    args = append(args, sdk.videoArgs()...)
+    return sdk.runCommand("ffmpeg", append(args,
         "-c:a", "aac",
         "-b:a", "192k",
         "-shortest",
         outputFile,
-    )
+    )...)
 }
 
 // GetRandomVideos 随机选择多个视频文件
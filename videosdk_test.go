@@ -2,6 +2,7 @@ package vidfusion
 
 import (
     "os"
+    "strings"
     "testing"
 )
 
@@ -282,3 +283,95 @@ func TestVideoSDK_CompleteExample(t *testing.T) {
     }()
     t.Log("视频处理完成")
 }
+
+// TestVideoSDK_Commands 使用 FakeRunner 测试各个操作生成的命令行
+func TestVideoSDK_Commands(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON).On("ffprobe", "format=duration", "12.5")
+    sdk := NewVideoSDK().WithRunner(runner)
+
+    duration, err := sdk.GetVideoDuration("in.mp4")
+    if err != nil || duration != 12.5 {
+        t.Errorf("GetVideoDuration should return 12.5, but got %v %v", duration, err)
+    }
+    width, height, err := sdk.GetVideoDimensions("in.mp4")
+    // 1920x1080 的视频带有 -90 度的旋转元数据，显示为竖屏
+    if err != nil || width != 1080 || height != 1920 {
+        t.Errorf("GetVideoDimensions should return 1080x1920, but got %dx%d %v", width, height, err)
+    }
+    runner.Reset()
+
+    tests := []struct {
+        name string
+        run  func() error
+        want string
+    }{
+        {"CropVideoTimeline", func() error { return sdk.CropVideoTimeline("in.mp4", "out.mp4", 1, 5) }, "ffmpeg -y -i in.mp4 -ss 1.00 -to 5.00 -c:v libx264 out.mp4"},
+        {"CropVideo", func() error { return sdk.CropVideo("in.mp4", "out.mp4", 720, 1280) }, "ffmpeg -y -i in.mp4 -vf crop=720:1280:(iw-ow)/2:(ih-oh)/2 -c:v libx264 -c:a copy out.mp4"},
+        {"CropVideoWithOptions", func() error {
+            return sdk.CropVideoWithOptions("in.mp4", "out.mp4", CropOptions{Width: 1080, Height: 1080, X: 420})
+        }, "ffmpeg -y -i in.mp4 -vf crop=1080:1080:420:0 -c:v libx264 -c:a copy out.mp4"},
+        {"Reframe", func() error {
+            return sdk.Reframe("in.mp4", "out.mp4", ReframeOptions{Width: 720, Height: 1280, Mode: ReframeFit})
+        }, "ffmpeg -y -i in.mp4 -vf scale=720:1280:force_original_aspect_ratio=decrease,pad=720:1280:(ow-iw)/2:(oh-ih)/2:color=black,setsar=1 -c:v libx264 -c:a copy out.mp4"},
+        {"FlipVideo", func() error { return sdk.FlipVideo("in.mp4", "out.mp4") }, "ffmpeg -y -i in.mp4 -vf hflip -c:v libx264 -c:a copy out.mp4"},
+        {"SpeedUpVideo", func() error { return sdk.SpeedUpVideo("in.mp4", "out.mp4", 2) }, "ffmpeg -y -i in.mp4 -filter:v setpts=0.500000*PTS -c:v libx264 -filter:a atempo=2 -c:a aac out.mp4"},
+        {"SpeedUpVideoWithOptions", func() error {
+            return sdk.SpeedUpVideoWithOptions("in.mp4", "out.mp4", SpeedOptions{Speed: 3, Audio: SpeedAudioDrop})
+        }, "ffmpeg -y -i in.mp4 -filter:v setpts=0.333333*PTS -c:v libx264 -an out.mp4"},
+        {"ScaleUpVideo", func() error { return sdk.ScaleUpVideo("in.mp4", "out.mp4", 1.5) }, "ffmpeg -y -i in.mp4 -vf scale=iw*1.500000:ih*1.500000 -c:v libx264 out.mp4"},
+        {"MuteTrack", func() error { return sdk.MuteTrack("in.mp4", "out.mp4") }, "ffmpeg -y -i in.mp4 -f lavfi -i anullsrc=r=44100:cl=stereo -c:v copy -c:a aac -shortest out.mp4"},
+        {"AddImageOverlay", func() error {
+            return sdk.AddImageOverlay(OverlayOptions{ImageWidth: 720, ImageHeight: 1280, VideoFile: "in.mp4", ImageFile: "logo.png", OutputFile: "out.mp4"})
+        }, "ffmpeg -y -i in.mp4 -i logo.png -filter_complex [1:v]scale=720:1280[img];[0:v][img]overlay=0:0 -c:v libx264 -c:a copy out.mp4"},
+    }
+    for _, tt := range tests {
+        runner.Reset()
+        if err := tt.run(); err != nil {
+            t.Errorf("%s error: %v", tt.name, err)
+            continue
+        }
+        lines := runner.CommandLines()
+        if len(lines) != 1 || lines[0] != tt.want {
+            t.Errorf("%s should run %q, but got %v", tt.name, tt.want, lines)
+        }
+    }
+}
+
+// TestVideoSDK_ConcatenateVideos_Normalize 测试合并前统一尺寸、帧率、像素格式和音频，同名视频使用不同的临时文件
+func TestVideoSDK_ConcatenateVideos_Normalize(t *testing.T) {
+    silent := strings.Replace(probeJSON, `"codec_type": "audio"`, `"codec_type": "data"`, 1)
+    runner := NewFakeRunner().On("ffprobe", "b/1.mp4", silent).On("ffprobe", "-show_streams", probeJSON)
+    if err := NewVideoSDK().WithRunner(runner).ConcatenateVideos([]string{"a/1.mp4", "b/1.mp4"}, "out.mp4", 720, 1280); err != nil {
+        t.Fatalf("ConcatenateVideos error: %v", err)
+    }
+    var ffmpeg []string
+    for _, line := range runner.CommandLines() {
+        if strings.HasPrefix(line, "ffmpeg ") {
+            ffmpeg = append(ffmpeg, line)
+        }
+    }
+    filter := "-vf scale=720:1280:force_original_aspect_ratio=decrease,pad=720:1280:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=30,format=yuv420p -map 0:v:0 -c:v libx264 "
+    if len(ffmpeg) != 3 ||
+        !strings.Contains(ffmpeg[0], "-i a/1.mp4 "+filter+"-map 0:a:0 -c:a aac -ar 44100 -ac 2 ") || !strings.HasSuffix(ffmpeg[0], "/0_1.mp4") ||
+        !strings.Contains(ffmpeg[1], "-i b/1.mp4 -f lavfi -i anullsrc=r=44100:cl=stereo "+filter+"-map 1:a:0 -shortest -c:a aac ") || !strings.HasSuffix(ffmpeg[1], "/1_1.mp4") ||
+        !strings.Contains(ffmpeg[2], "-f concat -safe 0 -i ") || !strings.HasSuffix(ffmpeg[2], " -c copy out.mp4") {
+        t.Errorf("unexpected commands:\n%s", strings.Join(ffmpeg, "\n"))
+    }
+}
+
+// Test_atempoFilter 测试超出 atempo 范围的倍数拆分为多个串联的滤镜
+func Test_atempoFilter(t *testing.T) {
+    for speed, want := range map[float64]string{
+        1.6:  "atempo=1.6",
+        2:    "atempo=2",
+        3:    "atempo=2,atempo=1.5",
+        10:   "atempo=2,atempo=2,atempo=2,atempo=1.25",
+        0.5:  "atempo=0.5",
+        0.3:  "atempo=0.5,atempo=0.6",
+        0.25: "atempo=0.5,atempo=0.5",
+    } {
+        if got := atempoFilter(speed); got != want {
+            t.Errorf("atempoFilter(%v) should be %s, but got %s", speed, want, got)
+        }
+    }
+}
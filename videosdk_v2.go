@@ -1,10 +1,14 @@
 package vidfusion
 
 import (
+    "context"
     "fmt"
     "io/ioutil"
+    "log/slog"
     "os"
     "path/filepath"
+    "slices"
+    "time"
 )
 
 // 编码方式 h264_nvenc
@@ -13,7 +17,9 @@ const (
     H264Nvenc = "h264_nvenc"
 )
 
-// Encoder 视频编码器
+// Encoder 未通过 WithEncoder 设置编码配置时使用的视频编码器，H264Nvenc 同时开启 cuda 硬件解码
+//
+// Deprecated: 全局变量由所有实例共享，使用 WithEncoder 为每个实例设置 EncoderProfile
 var Encoder = Libx264
 
 const (
@@ -23,10 +29,19 @@ const (
 )
 
 // VideoSDKV2 核心结构体
+// 链式调用中任意一步失败后会记录第一个错误，后续步骤直接跳过，错误通过 Err 或 Finalize 返回
 type VideoSDKV2 struct {
+    executor
     CurrentFile string
     tempFiles   []string
-    uniqueID    string // 唯一ID
+    uniqueID    string          // 唯一ID
+    err         error           // 链式调用中遇到的第一个错误
+    progress    progressTracker // 进度汇总
+    lazy        bool            // 是否为延迟模式
+    graph       *filterGraph    // 延迟模式下尚未执行的滤镜图
+    plan        *PlanRunner     // 预演模式下记录执行计划的 Runner
+    manifest    *Manifest       // 最近一次 ProcessVideos 的拼合清单
+    parallel    int             // ProcessVideos 同时处理片段的最大 ffmpeg 进程数
 }
 
 // NewVideoSDKV2 创建 VideoSDKV2 实例
@@ -38,224 +53,492 @@ func NewVideoSDKV2(inputFile string) *VideoSDKV2 {
     }
 }
 
-// getNextTempFile 生成下一个临时文件路径
+// WithContext 设置执行命令使用的 ctx，ctx 取消时终止正在执行的 ffmpeg 进程树，当前步骤失败并返回 context 错误
+func (sdk *VideoSDKV2) WithContext(ctx context.Context) *VideoSDKV2 {
+    sdk.ctx = ctx
+    return sdk
+}
+
+// WithTimeout 设置每条命令的超时时间，0 表示不限制
+func (sdk *VideoSDKV2) WithTimeout(timeout time.Duration) *VideoSDKV2 {
+    sdk.timeout = timeout
+    return sdk
+}
+
+// WithRunner 设置执行命令使用的 Runner，默认使用 ExecRunner
+func (sdk *VideoSDKV2) WithRunner(runner Runner) *VideoSDKV2 {
+    sdk.runner = runner
+    return sdk
+}
+
+// WithLogger 设置结构化日志记录器，默认丢弃所有日志
+func (sdk *VideoSDKV2) WithLogger(logger *slog.Logger) *VideoSDKV2 {
+    sdk.logger = logger
+    return sdk
+}
+
+// WithEncoder 设置视频编码配置，所有需要重新编码视频的步骤都使用该配置，默认使用全局 Encoder
+func (sdk *VideoSDKV2) WithEncoder(profile EncoderProfile) *VideoSDKV2 {
+    sdk.encoder = &profile
+    return sdk
+}
+
+// WithParallel 设置 ProcessVideos 同时处理片段的最大 ffmpeg 进程数，默认 1 即依次处理
+// 处理结果的顺序与片段顺序一致，任意片段失败时会终止其余正在处理的片段；预演模式下始终依次处理
+func (sdk *VideoSDKV2) WithParallel(n int) *VideoSDKV2 {
+    sdk.parallel = n
+    return sdk
+}
+
+// WithThreads 设置每个 ffmpeg 进程的编码线程数（-threads），与 WithParallel 配合避免超额占用 CPU，0 表示由 ffmpeg 决定
+func (sdk *VideoSDKV2) WithThreads(n int) *VideoSDKV2 {
+    sdk.threads = n
+    return sdk
+}
+
+// OnProgress 设置进度回调，每个 ffmpeg 命令执行过程中会根据 -progress 输出多次回调
+func (sdk *VideoSDKV2) OnProgress(fn ProgressFunc) *VideoSDKV2 {
+    sdk.progress.fn = fn
+    return sdk
+}
+
+// ExpectSteps 设置链式调用预计的步骤数，用于计算整体进度，每个公开的处理方法算作一个步骤
+func (sdk *VideoSDKV2) ExpectSteps(steps int) *VideoSDKV2 {
+    sdk.progress.totalSteps = steps
+    return sdk
+}
+
+// trackStep 开始一个包含多条命令的步骤，返回结束步骤的函数
+func (sdk *VideoSDKV2) trackStep(step string, expected int) func() {
+    sdk.progress.begin(step, expected)
+    return sdk.progress.end
+}
+
+// getNextTempFile 生成下一个临时文件路径，创建失败时记录错误并返回空字符串
 func (sdk *VideoSDKV2) getNextTempFile() string {
     tempFile, err := ioutil.TempFile("", sdk.uniqueID+"_video_*.mp4")
     if err != nil {
-        panic(fmt.Sprintf("failed to create temp file: %v", err))
+        sdk.fail("getNextTempFile", fmt.Errorf("failed to create temp file: %v", err))
+        return ""
     }
+    _ = tempFile.Close()
     sdk.tempFiles = append(sdk.tempFiles, tempFile.Name())
+    sdk.planTemp(tempFile.Name())
+    sdk.log().Debug("temp file created", "file", tempFile.Name())
     return tempFile.Name()
 }
 
+// Err 返回链式调用中遇到的第一个错误
+func (sdk *VideoSDKV2) Err() error {
+    return sdk.err
+}
+
+// fail 记录步骤错误，只保留第一个错误
+func (sdk *VideoSDKV2) fail(step string, err error) {
+    if sdk.err == nil {
+        sdk.err = newStepError(step, err)
+    }
+}
+
+// runStep 执行一个生成新文件的 ffmpeg 步骤，成功后将输出文件设置为当前文件
+// 之前的步骤已经失败时直接跳过
+func (sdk *VideoSDKV2) runStep(step string, buildArgs func(outputFile string) []string) *VideoSDKV2 {
+    return sdk.runStepDuration(step, nil, buildArgs)
+}
+
+// runStepDuration 与 runStep 相同，duration 根据输入时长计算输出时长，用于计算进度，为空表示时长不变
+func (sdk *VideoSDKV2) runStepDuration(step string, duration func(input float64) float64, buildArgs func(outputFile string) []string) *VideoSDKV2 {
+    if sdk.err != nil {
+        return sdk
+    }
+    defer sdk.trackStep(step, 1)()
+    outputFile := sdk.getNextTempFile()
+    if sdk.err != nil {
+        return sdk
+    }
+    if err := sdk.runFFmpeg(step, duration, buildArgs(outputFile)...); err != nil {
+        // 清理失败步骤的输出文件
+        sdk.removeTempFile(outputFile)
+        sdk.fail(step, err)
+        return sdk
+    }
+    sdk.CurrentFile = outputFile
+    return sdk
+}
+
+// runFFmpeg 执行一条 ffmpeg 命令，设置了进度回调时解析并汇报进度
+func (sdk *VideoSDKV2) runFFmpeg(step string, duration func(input float64) float64, args ...string) error {
+    e := sdk.withStep(step)
+    e.duration = duration
+    if sdk.progress.fn == nil {
+        return e.runCommandProgress(nil, "ffmpeg", args...)
+    }
+    err := e.runCommandProgress(func(p ffmpegProgress) {
+        outputDuration := p.InputDuration
+        if duration != nil {
+            outputDuration = duration(p.InputDuration)
+        }
+        sdk.progress.report(p, outputDuration)
+    }, "ffmpeg", args...)
+    if err == nil {
+        sdk.progress.commandDone()
+    }
+    return err
+}
+
+// removeTempFile 删除指定的临时文件并从临时文件列表中移除
+func (sdk *VideoSDKV2) removeTempFile(file string) {
+    _ = os.Remove(file)
+    sdk.log().Debug("temp file removed", "file", file)
+    for i, tempFile := range sdk.tempFiles {
+        if tempFile == file {
+            sdk.tempFiles = append(sdk.tempFiles[:i], sdk.tempFiles[i+1:]...)
+            break
+        }
+    }
+}
+
 // Cleanup 清理临时文件
 func (sdk *VideoSDKV2) Cleanup() {
     for _, file := range sdk.tempFiles {
         _ = os.Remove(file)
-        fmt.Println("Removed temp file:", file)
+        sdk.log().Debug("temp file removed", "file", file)
     }
 }
 
 // CropVideoTimeline 裁剪视频时间线
 func (sdk *VideoSDKV2) CropVideoTimeline(start, end float64) *VideoSDKV2 {
-    outputFile := sdk.getNextTempFile()
-    err := runCommand("ffmpeg", "-i", sdk.CurrentFile, "-ss", fmt.Sprintf("%.2f", start), "-to", fmt.Sprintf("%.2f", end), outputFile)
-    if err != nil {
-        panic(fmt.Sprintf("failed to crop video: %v", err))
+    if sdk.lazy {
+        return sdk.appendNode("CropVideoTimeline", func(g *filterGraph) error {
+            g.videoFilter(fmt.Sprintf("trim=start=%.2f:end=%.2f,setpts=PTS-STARTPTS", start, end))
+            g.audioFilter(fmt.Sprintf("atrim=start=%.2f:end=%.2f,asetpts=PTS-STARTPTS", start, end))
+            g.duration = trimmedDuration(g.duration, start, end)
+            return nil
+        })
     }
-    sdk.CurrentFile = outputFile
-    return sdk
+    duration := func(input float64) float64 {
+        if input > 0 && input < end {
+            return input - start
+        }
+        return end - start
+    }
+    return sdk.runStepDuration("CropVideoTimeline", duration, func(outputFile string) []string {
+        args := append([]string{"-i", sdk.CurrentFile, "-ss", fmt.Sprintf("%.2f", start), "-to", fmt.Sprintf("%.2f", end)}, sdk.videoArgs()...)
+        return append(args, outputFile)
+    })
 }
 
-// CropVideo 裁剪视频
+// CropVideo 从画面中心裁剪出 width x height 的区域，不缩放画面；需要缩放到目标尺寸时使用 Reframe
 func (sdk *VideoSDKV2) CropVideo(width, height int64) *VideoSDKV2 {
-    outputFile := sdk.getNextTempFile()
-    err := runCommand("ffmpeg", "-i", sdk.CurrentFile, "-vf", fmt.Sprintf("scale=%d:%d", width, height), outputFile)
-    if err != nil {
-        panic(fmt.Sprintf("failed to crop video: %v", err))
-    }
-    sdk.CurrentFile = outputFile
-    return sdk
+    return sdk.CropVideoWithOptions(CropOptions{Width: width, Height: height, Gravity: GravityCenter})
 }
 
 // FlipVideo 翻转视频
 func (sdk *VideoSDKV2) FlipVideo() *VideoSDKV2 {
-    outputFile := sdk.getNextTempFile()
-    err := runCommand("ffmpeg", "-i", sdk.CurrentFile, "-vf", "hflip", "-c:v", Encoder, "-c:a", "copy", outputFile)
-    if err != nil {
-        panic(fmt.Sprintf("failed to flip video: %v", err))
+    if sdk.lazy {
+        return sdk.appendNode("FlipVideo", func(g *filterGraph) error {
+            g.videoFilter("hflip")
+            return nil
+        })
     }
-    sdk.CurrentFile = outputFile
-    return sdk
+    return sdk.runStep("FlipVideo", func(outputFile string) []string {
+        args := append([]string{"-i", sdk.CurrentFile, "-vf", "hflip"}, sdk.videoArgs()...)
+        return append(args, "-c:a", "copy", outputFile)
+    })
 }
 
-// SpeedUpVideo 加速视频
+// SpeedUpVideo 加速视频，音频使用 atempo 同步变速，输出时长为原时长除以 speed
 func (sdk *VideoSDKV2) SpeedUpVideo(speed float64) *VideoSDKV2 {
-    outputFile := sdk.getNextTempFile()
-    err := runCommand("ffmpeg", "-i", sdk.CurrentFile, "-filter:v", fmt.Sprintf("setpts=%f*PTS", 1/speed), outputFile)
-    if err != nil {
-        panic(fmt.Sprintf("failed to speed up video: %v", err))
+    return sdk.SpeedUpVideoWithOptions(SpeedOptions{Speed: speed})
+}
+
+// SpeedUpVideoWithOptions 按选项加速视频，视频和音频在同一条命令中变速，不需要再裁剪时间线
+func (sdk *VideoSDKV2) SpeedUpVideoWithOptions(options SpeedOptions) *VideoSDKV2 {
+    if sdk.err != nil {
+        return sdk
     }
-    sdk.CurrentFile = outputFile
-    duration, err := sdk.GetVideoDuration(outputFile)
-    if err != nil {
-        panic(fmt.Sprintf("failed to get video duration: %v", err))
+    if err := options.Validate(); err != nil {
+        sdk.fail("SpeedUpVideo", err)
+        return sdk
     }
-    // 调用裁剪视频时间线方法 缩减视频时长
-    if speed > 0 {
-        sdk.CropVideoTimeline(0, duration/speed)
+    if sdk.lazy {
+        return sdk.appendNode("SpeedUpVideo", func(g *filterGraph) error {
+            g.videoFilter(fmt.Sprintf("setpts=%f*PTS", 1/options.Speed))
+            if options.Audio == SpeedAudioDrop {
+                g.audio = ""
+            } else {
+                g.audioFilter(atempoFilter(options.Speed))
+            }
+            if g.duration > 0 {
+                g.duration = g.duration / options.Speed
+            }
+            return nil
+        })
     }
-    return sdk
+    duration := func(input float64) float64 {
+        return input / options.Speed
+    }
+    return sdk.runStepDuration("SpeedUpVideo", duration, func(outputFile string) []string {
+        return append(append([]string{"-i", sdk.CurrentFile}, options.args(sdk.videoArgs())...), outputFile)
+    })
 }
 
 // ScaleUpVideo 放大视频
 func (sdk *VideoSDKV2) ScaleUpVideo(scale float64) *VideoSDKV2 {
-    outputFile := sdk.getNextTempFile()
-    err := runCommand("ffmpeg", "-i", sdk.CurrentFile, "-vf", fmt.Sprintf("scale=iw*%f:ih*%f", scale, scale), outputFile)
-    if err != nil {
-        panic(fmt.Sprintf("failed to scale up video: %v", err))
+    if sdk.lazy {
+        return sdk.appendNode("ScaleUpVideo", func(g *filterGraph) error {
+            g.videoFilter(fmt.Sprintf("scale=iw*%f:ih*%f", scale, scale))
+            // 缩放后的尺寸由 ffmpeg 取整，查询尺寸时需要重新探测
+            g.width, g.height = 0, 0
+            return nil
+        })
     }
-    sdk.CurrentFile = outputFile
-    return sdk
+    return sdk.runStep("ScaleUpVideo", func(outputFile string) []string {
+        args := append([]string{"-i", sdk.CurrentFile, "-vf", fmt.Sprintf("scale=iw*%f:ih*%f", scale, scale)}, sdk.videoArgs()...)
+        return append(args, outputFile)
+    })
 }
 
 // AddBackgroundMusic 添加背景音乐
 func (sdk *VideoSDKV2) AddBackgroundMusic(audioFile string, volume float64) *VideoSDKV2 {
-    outputFile := sdk.getNextTempFile()
-    err := runCommand("ffmpeg",
-        "-i", sdk.CurrentFile,
-        "-i", audioFile,
-        "-filter_complex", fmt.Sprintf("[1:a]volume=%.1f[a1];[0:a][a1]amix=inputs=2:duration=first:dropout_transition=2[a]", volume),
-        "-map", "0:v", // 选择视频流
-        "-map", "[a]", // 选择混合后的音频流
-        "-c:v", "copy", // 复制视频流
-        "-c:a", "aac", // 使用 AAC 编码音频
-        "-b:a", "192k", // 设置音频比特率
-        "-shortest", // 输出文件最短持续时间
-        outputFile,
-    )
-    if err != nil {
-        panic(fmt.Sprintf("failed to add background music: %v", err))
+    if sdk.lazy {
+        return sdk.appendNode("AddBackgroundMusic", func(g *filterGraph) error {
+            if g.audio == "" {
+                return fmt.Errorf("no audio stream to mix %s into, call MuteTrack first", audioFile)
+            }
+            input := g.addInput(audioFile)
+            music := g.addFilter("a", fmt.Sprintf("volume=%.1f", volume), fmt.Sprintf("%d:a", input))
+            g.audio = g.addFilter("a", "amix=inputs=2:duration=first:dropout_transition=2", g.audio, music)
+            return nil
+        })
     }
-    sdk.CurrentFile = outputFile
-    return sdk
+    return sdk.runStep("AddBackgroundMusic", func(outputFile string) []string {
+        return []string{
+            "-i", sdk.CurrentFile,
+            "-i", audioFile,
+            "-filter_complex", fmt.Sprintf("[1:a]volume=%.1f[a1];[0:a][a1]amix=inputs=2:duration=first:dropout_transition=2[a]", volume),
+            "-map", "0:v", // 选择视频流
+            "-map", "[a]", // 选择混合后的音频流
+            "-c:v", "copy", // 复制视频流
+            "-c:a", "aac", // 使用 AAC 编码音频
+            "-b:a", "192k", // 设置音频比特率
+            "-shortest", // 输出文件最短持续时间
+            outputFile,
+        }
+    })
 }
 
 // AddImageOverlay 添加图片水印
 func (sdk *VideoSDKV2) AddImageOverlay(options OverlayOptions) *VideoSDKV2 {
-    outputFile := sdk.getNextTempFile()
+    if sdk.lazy {
+        return sdk.appendNode("AddImageOverlay", func(g *filterGraph) error {
+            input := g.addInput(options.ImageFile)
+            image := g.addFilter("img", fmt.Sprintf("scale=%d:%d", options.ImageWidth, options.ImageHeight), fmt.Sprintf("%d:v", input))
+            g.video = g.addFilter("v", fmt.Sprintf("overlay=%d:%d", options.XPosition, options.YPosition), g.video, image)
+            return nil
+        })
+    }
     // 使用传入的宽度和高度来缩放图片，并在指定位置进行覆盖
     filterComplex := fmt.Sprintf("[1:v]scale=%d:%d[img];[0:v][img]overlay=%d:%d", options.ImageWidth, options.ImageHeight, options.XPosition, options.YPosition)
-    err := runCommand("ffmpeg", "-i", sdk.CurrentFile, "-i", options.ImageFile,
-        "-filter_complex", filterComplex,
-        "-c:v", Encoder, "-preset", "slow", "-crf", "23", "-c:a", "copy", outputFile)
-    if err != nil {
-        panic(fmt.Sprintf("failed to add image overlay: %v", err))
-    }
-    sdk.CurrentFile = outputFile
-    return sdk
+    return sdk.runStep("AddImageOverlay", func(outputFile string) []string {
+        args := append([]string{"-i", sdk.CurrentFile, "-i", options.ImageFile, "-filter_complex", filterComplex}, sdk.videoArgs()...)
+        return append(args, "-c:a", "copy", outputFile)
+    })
 }
 
 // Mute 关闭视频原声
 func (sdk *VideoSDKV2) Mute() *VideoSDKV2 {
-    outputFile := sdk.getNextTempFile()
-    err := runCommand("ffmpeg", "-i", sdk.CurrentFile, "-an", "-c:v", "copy", "-c:a", "aac", outputFile)
-    if err != nil {
-        panic(fmt.Sprintf("failed to mute video: %v", err))
+    if sdk.lazy {
+        return sdk.appendNode("Mute", func(g *filterGraph) error {
+            g.audio = ""
+            return nil
+        })
     }
-    sdk.CurrentFile = outputFile
-    return sdk
+    return sdk.runStep("Mute", func(outputFile string) []string {
+        return []string{"-i", sdk.CurrentFile, "-an", "-c:v", "copy", "-c:a", "aac", outputFile}
+    })
 }
 
 // MuteTrack 添加静音轨道
+// 延迟模式下已有音轨时保留原音轨，与 ffmpeg 默认选择双声道原音轨的行为一致
 func (sdk *VideoSDKV2) MuteTrack() *VideoSDKV2 {
-    outputFile := sdk.getNextTempFile()
-    err := runCommand(
-        "ffmpeg", "-i", sdk.CurrentFile,
-        "-f", "lavfi", "-i", "anullsrc=r=44100:cl=stereo", // 添加静音音轨
-        "-c:v", "copy", // 保持视频编码不变
-        "-c:a", "aac", // 使用 AAC 音频编码
-        "-shortest", // 确保音轨与视频长度一致
-        outputFile,
-    )
-    if err != nil {
-        panic(fmt.Sprintf("failed to mute track: %v", err))
+    if sdk.lazy {
+        return sdk.appendNode("MuteTrack", func(g *filterGraph) error {
+            if g.audio != "" {
+                return nil
+            }
+            if g.duration > 0 {
+                g.audio = g.addFilter("a", fmt.Sprintf("anullsrc=r=44100:cl=stereo,atrim=duration=%.3f", g.duration))
+            } else {
+                g.audio = g.addFilter("a", "anullsrc=r=44100:cl=stereo")
+                g.shortest = true
+            }
+            return nil
+        })
     }
-    sdk.CurrentFile = outputFile
-    return sdk
+    return sdk.runStep("MuteTrack", func(outputFile string) []string {
+        return []string{
+            "-i", sdk.CurrentFile,
+            "-f", "lavfi", "-i", "anullsrc=r=44100:cl=stereo", // 添加静音音轨
+            "-c:v", "copy", // 保持视频编码不变
+            "-c:a", "aac", // 使用 AAC 音频编码
+            "-shortest", // 确保音轨与视频长度一致
+            outputFile,
+        }
+    })
 }
 
 // ConcatenateVideos 合并多个视频
+// 每个视频先统一为 targetWidth x targetHeight（等比缩放后填充黑边）、方形像素、30 帧恒定帧率、yuv420p 和 44100Hz 双声道，
+// 没有音轨的视频补充静音，然后直接流复制合并
 func (sdk *VideoSDKV2) ConcatenateVideos(videoList []string, targetWidth, targetHeight int64) *VideoSDKV2 {
+    return sdk.ConcatenateVideosWithOptions(videoList, ConcatOptions{Width: targetWidth, Height: targetHeight})
+}
+
+// concatScaled 将每个视频统一参数后输出到临时文件，再流复制合并
+func (sdk *VideoSDKV2) concatScaled(videoList []string, options ConcatOptions) *VideoSDKV2 {
+    format := sdk.concatFormat(options)
+    withAudio := make([]bool, len(videoList))
+    for i, video := range videoList {
+        info, err := sdk.Probe(video)
+        if err != nil {
+            sdk.fail("ConcatenateVideos", err)
+            return sdk
+        }
+        withAudio[i] = info.HasAudio()
+    }
+    defer sdk.trackStep("ConcatenateVideos", len(videoList)+1)()
     tempFile, err := ioutil.TempFile("", "videos_*.txt")
     if err != nil {
-        panic(fmt.Sprintf("failed to create temp file: %v", err))
+        sdk.fail("ConcatenateVideos", fmt.Errorf("failed to create temp file: %v", err))
+        return sdk
     }
     defer os.Remove(tempFile.Name())
     defer tempFile.Close()
-    
+    sdk.planTemp(tempFile.Name())
+
     tempDir, err := ioutil.TempDir("", "scaled_videos")
     if err != nil {
-        panic(fmt.Sprintf("failed to create temp dir: %v", err))
+        sdk.fail("ConcatenateVideos", fmt.Errorf("failed to create temp dir: %v", err))
+        return sdk
     }
     defer os.RemoveAll(tempDir)
-    
-    for _, video := range videoList {
-        scaledVideo := filepath.Join(tempDir, filepath.Base(video))
-        scaleFilter := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", targetWidth, targetHeight)
-        err := runCommand("ffmpeg", "-i", video, "-vf", scaleFilter, "-r", "30", "-c:a", "copy", scaledVideo)
+
+    // 合并后的总时长，由缩放命令的进度信息累计，只在需要汇报进度时统计
+    var totalDuration float64
+    for i, video := range videoList {
+        // 同一个文件可能出现多次，临时文件名加上序号避免覆盖
+        scaledVideo := filepath.Join(tempDir, fmt.Sprintf("%d_%s", i, filepath.Base(video)))
+        sdk.planTemp(scaledVideo)
+        r := rangeAt(options.Ranges, i)
+        args := sdk.scaledArgs(video, r, withAudio[i], options.Width, options.Height, format, scaledVideo)
+        var videoDuration float64
+        err := sdk.runFFmpeg("ConcatenateVideos", func(input float64) float64 {
+            videoDuration = r.length(input)
+            return videoDuration
+        }, args...)
+        totalDuration += videoDuration
         if err != nil {
-            panic(fmt.Sprintf("failed to scale video %s: %v", video, err))
+            sdk.fail("ConcatenateVideos", err)
+            return sdk
         }
         _, err = tempFile.WriteString(fmt.Sprintf("file '%s'\n", scaledVideo))
         if err != nil {
-            panic(fmt.Sprintf("failed to write to temp file: %v", err))
+            sdk.fail("ConcatenateVideos", fmt.Errorf("failed to write to temp file: %v", err))
+            return sdk
         }
     }
-    
-    outputFile := sdk.getNextTempFile()
-    err = runCommand("ffmpeg", "-f", "concat", "-safe", "0", "-i", tempFile.Name(), "-c:v", Encoder, outputFile)
-    if err != nil {
-        panic(fmt.Sprintf("failed to concatenate videos: %v", err))
+
+    duration := func(float64) float64 {
+        return totalDuration
     }
-    sdk.CurrentFile = outputFile
-    return sdk
+    // 所有视频的参数已经一致，合并时不需要重新编码
+    return sdk.runStepDuration("ConcatenateVideos", duration, func(outputFile string) []string {
+        return []string{"-f", "concat", "-safe", "0", "-i", tempFile.Name(), "-c", "copy", outputFile}
+    })
 }
 
 // Finalize 最终生成文件，将临时文件复制到最终输出路径
-func (sdk *VideoSDKV2) Finalize(outputFile string) string {
+// 链式调用中出现过错误时不会生成文件，直接返回第一个错误；无论成功与否都会清理临时文件
+func (sdk *VideoSDKV2) Finalize(outputFile string) (string, error) {
+    defer sdk.Cleanup()
+    if sdk.err != nil {
+        return "", sdk.err
+    }
     tempFile := sdk.CurrentFile
-    // 确保最终文件路径的目录存在
-    if err := os.MkdirAll(filepath.Dir(outputFile), os.ModePerm); err != nil {
-        panic(fmt.Sprintf("failed to create output directory: %v", err))
+    // 确保最终文件路径的目录存在，预演模式下由导出的脚本创建
+    if sdk.plan == nil {
+        if err := os.MkdirAll(filepath.Dir(outputFile), os.ModePerm); err != nil {
+            sdk.fail("Finalize", fmt.Errorf("failed to create output directory: %v", err))
+            return "", sdk.err
+        }
+    }
+    // 延迟模式下直接将滤镜图编译输出到最终文件
+    if graph := sdk.graph; graph.pending() {
+        sdk.graph = nil
+        defer sdk.trackStep(graph.stepName(), 1)()
+        if err := sdk.runFFmpeg(graph.stepName(), graph.outputDuration, graph.compile(outputFile, sdk.encoderProfile())...); err != nil {
+            _ = os.Remove(outputFile)
+            sdk.fail(graph.stepName(), err)
+            return "", sdk.err
+        }
+        return outputFile, nil
+    }
+    if sdk.plan != nil {
+        sdk.plan.recordCopy("Finalize", tempFile, outputFile)
+        return outputFile, nil
     }
     // 执行文件复制
     err := copyFile(tempFile, outputFile)
     if err != nil {
-        panic(fmt.Sprintf("failed to finalize video: %v", err))
+        sdk.fail("Finalize", fmt.Errorf("failed to finalize video: %v", err))
+        return "", sdk.err
     }
-    sdk.Cleanup()
-    return outputFile
+    return outputFile, nil
 }
 
 // GetMP3Duration 获取 MP3 文件时长
 func (sdk *VideoSDKV2) GetMP3Duration(mp3File string) (float64, error) {
-    return runCommandAndExtractFloat("ffprobe", "-i", mp3File, "-show_entries", "format=duration", "-v", "quiet", "-of", "csv=p=0")
+    return sdk.runCommandAndExtractFloat("ffprobe", "-i", mp3File, "-show_entries", "format=duration", "-v", "quiet", "-of", "csv=p=0")
 }
 
 // GetVideoDuration 获取视频时长
 func (sdk *VideoSDKV2) GetVideoDuration(videoFile string) (float64, error) {
-    return runCommandAndExtractFloat("ffprobe", "-i", videoFile, "-show_entries", "format=duration", "-v", "quiet", "-of", "csv=p=0")
+    // 延迟模式下当前文件尚未生成时，优先使用滤镜图推算的时长
+    if sdk.graph.pending() && videoFile == sdk.CurrentFile && sdk.graph.duration > 0 {
+        return sdk.graph.duration, nil
+    }
+    videoFile = sdk.flushIfCurrent(videoFile)
+    if sdk.err != nil {
+        return 0, sdk.err
+    }
+    return sdk.runCommandAndExtractFloat("ffprobe", "-i", videoFile, "-show_entries", "format=duration", "-v", "quiet", "-of", "csv=p=0")
 }
 
-// GetVideoDimensions 获取视频尺寸
+// Probe 使用 ffprobe 一次性探测文件的容器和所有流信息
+func (sdk *VideoSDKV2) Probe(file string) (*MediaInfo, error) {
+    file = sdk.flushIfCurrent(file)
+    if sdk.err != nil {
+        return nil, sdk.err
+    }
+    return sdk.probe(file)
+}
+
+// GetVideoDimensions 获取视频显示时的尺寸，带有旋转元数据的竖屏视频返回旋转后的宽高
 func (sdk *VideoSDKV2) GetVideoDimensions(videoFile string) (int64, int64, error) {
-    return runCommandAndExtractDimensions("ffprobe", "-v", "error", "-select_streams", "v:0", "-show_entries", "stream=width,height", "-of", "csv=s=x:p=0", videoFile)
+    // 延迟模式下当前文件尚未生成时，优先使用滤镜图推算的尺寸
+    if g := sdk.graph; g.pending() && videoFile == sdk.CurrentFile && g.width > 0 && g.height > 0 {
+        return g.width, g.height, nil
+    }
+    videoFile = sdk.flushIfCurrent(videoFile)
+    if sdk.err != nil {
+        return 0, 0, sdk.err
+    }
+    return sdk.videoDimensions(videoFile)
 }
 
 // AddSubtitles 添加字幕并应用样式
 func (sdk *VideoSDKV2) AddSubtitles(subtitleFile string, options SubtitleOptions) *VideoSDKV2 {
-    outputFile := sdk.getNextTempFile()
     // 构建 ffmpeg 中的 force_style 字符串，转义必要字符
     style := fmt.Sprintf(
         "Alignment=%d,Fontsize=%d,PrimaryColour=&H%s&,FontName=%s,MarginL=%d,MarginR=%d,MarginV=%d",
@@ -267,23 +550,30 @@ func (sdk *VideoSDKV2) AddSubtitles(subtitleFile string, options SubtitleOptions
         options.XPosition, // 如果想要两个边距相同，可以重复使用
         options.YPosition,
     )
-    
-    // 使用转义后的文件路径和样式
-    err := runCommand("ffmpeg",
-        "-i", sdk.CurrentFile,
-        "-i", subtitleFile,
-        "-vf", fmt.Sprintf("subtitles='%s':force_style='%s'", subtitleFile, style), // 使用双引号
-        "-c:v", Encoder,
-        "-c:a", "aac",
-        "-b:a", "192k",
-        "-shortest",
-        outputFile,
-    )
-    if err != nil {
-        panic(fmt.Sprintf("failed to add subtitles: %v", err))
+
+    if sdk.lazy {
+        return sdk.appendNode("AddSubtitles", func(g *filterGraph) error {
+            g.videoFilter(fmt.Sprintf("subtitles='%s':force_style='%s'", subtitleFile, style))
+            // 与非延迟模式一致，同时保留字幕文件中的字幕流
+            g.subtitle = fmt.Sprintf("%d:s", g.addInput(subtitleFile))
+            return nil
+        })
     }
-    sdk.CurrentFile = outputFile
-    return sdk
+
+    // 使用转义后的文件路径和样式
+    return sdk.runStep("AddSubtitles", func(outputFile string) []string {
+        args := []string{
+            "-i", sdk.CurrentFile,
+            "-i", subtitleFile,
+            "-vf", fmt.Sprintf("subtitles='%s':force_style='%s'", subtitleFile, style), // 使用双引号
+        }
+        return append(append(args, sdk.videoArgs()...),
+            "-c:a", "aac",
+            "-b:a", "192k",
+            "-shortest",
+            outputFile,
+        )
+    })
 }
 
 // GetRandomVideos 随机选择多个视频文件
@@ -292,62 +582,202 @@ func (sdk *VideoSDKV2) GetRandomVideos(directory string, numVideos int) ([]strin
 }
 
 // VideosOptions 视频选项
+// 片段先按 In / Out 裁剪，再依次应用 Process 和 Ops 中的操作
 type VideosOptions struct {
-    VideoFile string
-    Process   string
-    Params    float64 // 放大视频的倍数 或者 加速视频的倍数
+    VideoFile  string          `json:"file" yaml:"file"`                                 // 视频文件路径
+    Process    string          `json:"process,omitempty" yaml:"process,omitempty"`       // 处理方法，可以是任意已注册的处理器，为空表示不处理，多个操作请使用 Ops
+    Params     float64         `json:"params,omitempty" yaml:"params,omitempty"`         // 处理器的第一个参数，例如放大视频的倍数 或者 加速视频的倍数
+    In         float64         `json:"in,omitempty" yaml:"in,omitempty"`                 // 使用片段的开始时间（秒）
+    Out        float64         `json:"out,omitempty" yaml:"out,omitempty"`               // 使用片段的结束时间（秒），0 表示到片段结尾
+    Ops        []ClipOperation `json:"ops,omitempty" yaml:"ops,omitempty"`               // 依次应用的处理操作，例如翻转后再加速
+    Transition *Transition     `json:"transition,omitempty" yaml:"transition,omitempty"` // 拼合时与下一个片段之间的转场，覆盖 ProcessVideosOptions.Transition
 }
 
 // ProcessVideosOptions 视频处理选项
 type ProcessVideosOptions struct {
-    VideoDuration float64         // 视频总时长
-    Width         int64           // 视频宽度
-    Height        int64           // 视频高度
-    VideosOptions []VideosOptions // 视频选项
+    VideoDuration     float64         `json:"duration,omitempty" yaml:"duration,omitempty"`                     // 视频总时长
+    Width             int64           `json:"width" yaml:"width"`                                               // 视频宽度
+    Height            int64           `json:"height" yaml:"height"`                                             // 视频高度
+    VideosOptions     []VideosOptions `json:"videos" yaml:"videos"`                                             // 视频选项
+    Fill              string          `json:"fill,omitempty" yaml:"fill,omitempty"`                             // 填充总时长的策略 FillLoop / FillShuffle / FillOnce / FillTrimLongest，默认 FillLoop
+    Seed              int64           `json:"seed,omitempty" yaml:"seed,omitempty"`                             // FillShuffle 的随机种子，0 表示每次随机
+    Transition        *Transition     `json:"transition,omitempty" yaml:"transition,omitempty"`                 // 片段之间默认使用的转场，为空表示硬切；转场重叠的时长会计入填充
+    FrameRate         float64         `json:"frame_rate,omitempty" yaml:"frame_rate,omitempty"`                 // 合并前统一的恒定帧率，0 表示 30
+    PixelFormat       string          `json:"pix_fmt,omitempty" yaml:"pix_fmt,omitempty"`                       // 合并前统一的像素格式，默认使用编码配置的像素格式或 yuv420p
+    SampleRate        int64           `json:"sample_rate,omitempty" yaml:"sample_rate,omitempty"`               // 合并前统一的音频采样率，0 表示 44100
+    Reframe           string          `json:"reframe,omitempty" yaml:"reframe,omitempty"`                       // 片段缩放到目标尺寸的方式 ReframeStretch / ReframeFit / ReframeFill / ReframeBlur，默认 ReframeStretch
+    NormalizeRotation bool            `json:"normalize_rotation,omitempty" yaml:"normalize_rotation,omitempty"` // 处理片段之前先按旋转元数据旋转画面并清除元数据，避免带有旋转元数据的手机视频在后续步骤中方向不一致
 }
 
 // ProcessVideos 封装方法 传入多个视频 时长 + 每个视频的处理方法 然后合并视频返回
-// 视频处理方法 FlipVideo 翻转视频 SpeedUpVideo 加速视频 ScaleUpVideo 放大视频
+// 视频处理方法 FlipVideo 翻转视频 SpeedUpVideo 加速视频 ScaleUpVideo 放大视频，也可以通过 Ops 依次应用多个操作
+// 处理方法和操作在 RegisterOperation 注册的处理器中查找，未注册的名称在开始处理前报错
+// 片段按 Fill 策略填充到总时长，使用的片段和时间范围通过 Manifest 返回
 func (sdk *VideoSDKV2) ProcessVideos(options ProcessVideosOptions) *VideoSDKV2 {
-    var tempFiles []string
-    // 根据视频选项, 先处理视频
-    for _, videoOption := range options.VideosOptions {
-        // 设置要处理的视频
-        sdk.CurrentFile = videoOption.VideoFile
-        // 按照设置的处理方法处理视频
-        switch videoOption.Process {
-        case "FlipVideo":
-            sdk.FlipVideo()
-        case "SpeedUpVideo":
-            sdk.SpeedUpVideo(videoOption.Params)
-        case "ScaleUpVideo":
-            sdk.ScaleUpVideo(videoOption.Params)
-        default:
-            sdk.CurrentFile = videoOption.VideoFile
+    if sdk.err != nil {
+        return sdk
+    }
+    sdk.manifest = nil
+    if options.VideoDuration <= 0 {
+        sdk.fail("ProcessVideos", fmt.Errorf("duration must be positive, but got %.2f", options.VideoDuration))
+        return sdk
+    }
+    if !validFill(options.Fill) {
+        sdk.fail("ProcessVideos", fmt.Errorf("unknown fill strategy %q", options.Fill))
+        return sdk
+    }
+    if err := options.Transition.Validate(); err != nil {
+        sdk.fail("ProcessVideos", err)
+        return sdk
+    }
+    if options.FrameRate < 0 || options.SampleRate < 0 {
+        sdk.fail("ProcessVideos", fmt.Errorf("frame rate and sample rate should not be negative"))
+        return sdk
+    }
+    if !validReframe(options.Reframe) {
+        sdk.fail("ProcessVideos", fmt.Errorf("unknown reframe mode %q", options.Reframe))
+        return sdk
+    }
+    // 开始处理前校验所有片段，避免处理到一半才发现参数错误
+    processCommands := 0
+    for i, videoOption := range options.VideosOptions {
+        if err := videoOption.Validate(); err != nil {
+            sdk.fail("ProcessVideos", fmt.Errorf("videos[%d] %s: %w", i, videoOption.VideoFile, err))
+            return sdk
         }
-        // 处理后的视频加入到临时文件列表
-        tempFiles = append(tempFiles, sdk.CurrentFile)
+        processCommands += videoOption.commands()
     }
-    // 开始拼合视频
-    var execVideos []string
-    var totalDuration float64
-    for totalDuration < options.VideoDuration {
-        for _, video := range tempFiles {
-            videoDuration, err := sdk.GetVideoDuration(video)
-            if err != nil {
-                continue
-            }
-            totalDuration += videoDuration
-            // 裁剪视频到指定尺寸
-            sdk.CurrentFile = video
-            sdk.CropVideo(options.Width, options.Height)
-            execVideos = append(execVideos, sdk.CurrentFile)
-            if totalDuration >= options.VideoDuration {
-                break
+    // 预计命令数：片段处理 + 每个片段缩放 + 合并 + 裁剪时长，拼合的片段数确定后再修正
+    clips := len(options.VideosOptions)
+    defer sdk.trackStep("ProcessVideos", processCommands+2*clips+2)()
+    // 处理结果替换当前文件，延迟模式下尚未执行的滤镜图不再需要
+    sdk.graph = nil
+    if len(options.VideosOptions) == 0 {
+        sdk.fail("ProcessVideos", fmt.Errorf("no videos to process"))
+        return sdk
+    }
+    // 根据视频选项, 先并行处理视频：按入出点裁剪并依次应用处理操作，然后获取处理后的时长
+    processed := make([]*processedClip, clips)
+    sdk.forEach("ProcessVideos", clips, func(i int, child *VideoSDKV2) error {
+        child.processClip(options.VideosOptions[i], options.NormalizeRotation)
+        if child.err != nil {
+            return child.err
+        }
+        // 延迟模式下同时保存尚未执行的滤镜图
+        clip := &processedClip{file: child.CurrentFile, graph: child.graph}
+        duration, err := clip.duration(child)
+        if err != nil {
+            return newStepError("ProcessVideos", err)
+        }
+        clip.length = duration
+        processed[i] = clip
+        return nil
+    })
+    if sdk.err != nil {
+        return sdk
+    }
+    // 按填充策略选择拼合的片段
+    lengths := make([]float64, len(processed))
+    for i, clip := range processed {
+        if clip.length <= 0 {
+            sdk.fail("ProcessVideos", fmt.Errorf("video %s has no duration", clip.file))
+            return sdk
+        }
+        // 转场重叠的时长不短于片段时，循环填充无法增加总时长
+        if overlap := options.transition(i).overlap(); overlap > 0 && clip.length <= overlap {
+            sdk.fail("ProcessVideos", fmt.Errorf("video %s (%.2fs) must be longer than its transition (%.2fs)", options.VideosOptions[i].VideoFile, clip.length, overlap))
+            return sdk
+        }
+        lengths[i] = clip.length
+    }
+    segments, manifest, err := fillSegments(options, lengths)
+    if err != nil {
+        sdk.fail("ProcessVideos", err)
+        return sdk
+    }
+    var selected, scaling []*scaledSegment
+    trims := 0
+    for _, s := range segments {
+        // 延迟模式下片段处理和缩放合并为一条命令，同一片段重复使用时复用已生成的文件
+        job := &scaledSegment{segment: s, source: processed[s.clip]}
+        if index := slices.IndexFunc(scaling, func(j *scaledSegment) bool { return j.segment == s }); sdk.lazy && index >= 0 {
+            job = scaling[index]
+        } else {
+            scaling = append(scaling, job)
+            if job.trimmed() {
+                trims++
             }
         }
+        selected = append(selected, job)
+    }
+    if sdk.lazy {
+        trims = 0
+    }
+    // 每个衔接处的转场，全部为硬切时使用 concat 合并
+    transitions := make([]*Transition, max(len(selected)-1, 0))
+    concatCommands := len(selected) + 1
+    for i := range transitions {
+        transitions[i] = options.transition(selected[i].clip)
+        if transitions[i].overlap() > 0 {
+            concatCommands = 1
+        }
+    }
+    sdk.progress.expect(sdk.progress.done + trims + len(scaling) + concatCommands + 1)
+    // 并行裁剪需要缩短的片段并缩放到指定尺寸
+    sdk.forEach("ProcessVideos", len(scaling), func(i int, child *VideoSDKV2) error {
+        job := scaling[i]
+        child.CurrentFile = job.source.file
+        child.graph = job.source.graph
+        if job.trimmed() {
+            child.CropVideoTimeline(job.start, job.end)
+        }
+        child.Reframe(ReframeOptions{Width: options.Width, Height: options.Height, Mode: options.Reframe}).Flush()
+        job.rendered = child.CurrentFile
+        return child.err
+    })
+    if sdk.err != nil {
+        return sdk
     }
-    sdk.ConcatenateVideos(execVideos, options.Width, options.Height)
+    var execVideos []string
+    for _, job := range selected {
+        execVideos = append(execVideos, job.rendered)
+    }
+    sdk.manifest = manifest
+    sdk.ConcatenateVideosWithOptions(execVideos, ConcatOptions{
+        Width:       options.Width,
+        Height:      options.Height,
+        Transitions: transitions,
+        FrameRate:   options.FrameRate,
+        PixelFormat: options.PixelFormat,
+        SampleRate:  options.SampleRate,
+    })
     sdk.CropVideoTimeline(0, options.VideoDuration)
     return sdk
 }
+
+// processedClip ProcessVideos 中处理后的片段
+type processedClip struct {
+    file   string       // 处理后的文件，延迟模式下为滤镜图的源文件
+    graph  *filterGraph // 延迟模式下尚未执行的处理滤镜图
+    length float64      // 处理后的时长
+}
+
+// scaledSegment 缩放到目标尺寸的一段片段
+type scaledSegment struct {
+    segment
+    source   *processedClip // 处理后的片段
+    rendered string         // 缩放到目标尺寸后的文件
+}
+
+// trimmed 判断是否只使用片段的一部分，需要在缩放前裁剪
+func (s *scaledSegment) trimmed() bool {
+    return s.start > 0 || s.end < s.source.length-0.001
+}
+
+// duration 返回处理后片段的时长，延迟模式下使用滤镜图推算的时长
+func (c *processedClip) duration(sdk *VideoSDKV2) (float64, error) {
+    if c.graph.pending() {
+        return c.graph.duration, nil
+    }
+    return sdk.GetVideoDuration(c.file)
+}
@@ -1,6 +1,9 @@
 package vidfusion
 
 import (
+    "context"
+    "errors"
+    "strings"
     "testing"
 )
 
@@ -66,7 +69,7 @@ func TestFlipVideo(t *testing.T) {
     t.Logf("CurrentFile: %s", sdk.CurrentFile)
 }
 
-// SpeedUpVideo 加速视频 @TODO 视频整体时长没有变?
+// SpeedUpVideo 加速视频
 func TestSpeedUpVideo(t *testing.T) {
     sdk := NewVideoSDKV2(baseDir + "1.mp4")
     sdk.SpeedUpVideo(2)
@@ -216,3 +219,105 @@ func TestDemo(t *testing.T) {
     sdk.Finalize(outputFile)
     t.Log("视频处理完成")
 }
+
+// TestChainError 测试链式调用出错后记录第一个错误并跳过后续步骤
+func TestChainError(t *testing.T) {
+    sdk := NewVideoSDKV2("not_exists.mp4")
+    sdk.FlipVideo().CropVideo(720, 1280).Mute()
+    var stepErr *StepError
+    if !errors.As(sdk.Err(), &stepErr) {
+        t.Fatalf("Err should be *StepError, but got %v", sdk.Err())
+    }
+    if stepErr.Step != "FlipVideo" {
+        t.Errorf("Step should be FlipVideo, but got %s", stepErr.Step)
+    }
+    if stepErr.Name != "ffmpeg" || len(stepErr.Args) == 0 {
+        t.Errorf("StepError should carry ffmpeg args, but got %s %v", stepErr.Name, stepErr.Args)
+    }
+    if len(sdk.tempFiles) != 0 {
+        t.Errorf("later steps should be skipped and the failed temp file removed, but got %d temp files", len(sdk.tempFiles))
+    }
+    output, err := sdk.Finalize(baseDir + "output.mp4")
+    if err != stepErr || output != "" {
+        t.Errorf("Finalize should return the first error, but got %q %v", output, err)
+    }
+}
+
+// TestWithContext 测试 ctx 取消后步骤失败、返回 context 错误并清理该步骤的临时文件
+func TestWithContext(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    sdk := NewVideoSDKV2(baseDir + "1.mp4").WithContext(ctx)
+    sdk.FlipVideo()
+    if !errors.Is(sdk.Err(), context.Canceled) {
+        t.Errorf("Err should be context.Canceled, but got %v", sdk.Err())
+    }
+    if len(sdk.tempFiles) != 0 {
+        t.Errorf("temp file of the aborted step should be removed, but got %v", sdk.tempFiles)
+    }
+}
+
+// TestVideoSDKV2_Commands 使用 FakeRunner 测试链式调用生成的命令行
+func TestVideoSDKV2_Commands(t *testing.T) {
+    runner := NewFakeRunner()
+    sdk := NewVideoSDKV2("in.mp4").WithRunner(runner)
+    sdk.FlipVideo().SpeedUpVideo(2).Mute().AddBackgroundMusic("music.flac", 0.4)
+    if sdk.Err() != nil {
+        t.Fatalf("chain error: %v", sdk.Err())
+    }
+    want := []string{
+        "-vf hflip -c:v libx264 -c:a copy",
+        "-filter:v setpts=0.500000*PTS -c:v libx264 -filter:a atempo=2 -c:a aac",
+        "-an -c:v copy -c:a aac",
+        "-i music.flac -filter_complex [1:a]volume=0.4[a1];[0:a][a1]amix=inputs=2:duration=first:dropout_transition=2[a]",
+    }
+    lines := runner.CommandLines()
+    if len(lines) != len(want) {
+        t.Fatalf("should run %d commands, but got %d: %v", len(want), len(lines), lines)
+    }
+    for i, line := range lines {
+        if !strings.Contains(line, want[i]) {
+            t.Errorf("command %d should contain %q, but got %q", i, want[i], line)
+        }
+    }
+    // 每一步都以上一步的输出作为输入
+    if !strings.HasPrefix(lines[0], "ffmpeg -y -i in.mp4 ") {
+        t.Errorf("first step should read the input file, but got %q", lines[0])
+    }
+    if sdk.CurrentFile != sdk.tempFiles[len(sdk.tempFiles)-1] {
+        t.Errorf("CurrentFile should be the last temp file, but got %s", sdk.CurrentFile)
+    }
+    sdk.Cleanup()
+}
+
+// TestProcessVideos_Commands 使用 FakeRunner 测试 ProcessVideos 的处理流程
+func TestProcessVideos_Commands(t *testing.T) {
+    runner := NewFakeRunner().On("ffprobe", "-show_streams", probeJSON).On("ffprobe", "format=duration", "4")
+    sdk := NewVideoSDKV2("").WithRunner(runner)
+    sdk.ProcessVideos(ProcessVideosOptions{
+        VideoDuration: 10,
+        Width:         720,
+        Height:        1280,
+        VideosOptions: []VideosOptions{
+            {VideoFile: "1.mp4", Process: FlipVideo},
+            {VideoFile: "2.mp4"},
+        },
+    })
+    if sdk.Err() != nil {
+        t.Fatalf("ProcessVideos error: %v", sdk.Err())
+    }
+    var scales, concats int
+    for _, line := range runner.CommandLines() {
+        if strings.Contains(line, "-vf scale=720:1280 ") {
+            scales++
+        }
+        if strings.Contains(line, "-f concat") {
+            concats++
+        }
+    }
+    // 4 秒的片段需要 3 段才能达到 10 秒
+    if scales != 3 || concats != 1 {
+        t.Errorf("should scale 3 clips and concat once, but got %d scales and %d concats", scales, concats)
+    }
+    sdk.Cleanup()
+}
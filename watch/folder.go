@@ -0,0 +1,136 @@
+package watch
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/HeartGarlic/vidfusion"
+)
+
+// FolderOptions 素材文件夹按约定生成配方时使用的设置
+type FolderOptions struct {
+    Width           int64                     // 输出宽度，默认 720
+    Height          int64                     // 输出高度，默认 1280
+    MusicVolume     float64                   // 背景音乐音量，默认 0.4
+    NarrationVolume float64                   // 解说音量，默认 1
+    Subtitles       vidfusion.SubtitleOptions // 字幕样式，字号为 0 时使用默认样式
+    Encoder         string                    // 内置编码配置名称，例如 x264
+}
+
+// defaultSubtitles 未设置字幕样式时使用的默认样式
+var defaultSubtitles = vidfusion.SubtitleOptions{FontSize: 16, YPosition: 20, Font: "Arial", FontColor: "00FFFFFF", Alignment: 2}
+
+// withDefaults 填充默认值
+func (o FolderOptions) withDefaults() FolderOptions {
+    if o.Width <= 0 {
+        o.Width = 720
+    }
+    if o.Height <= 0 {
+        o.Height = 1280
+    }
+    if o.MusicVolume <= 0 {
+        o.MusicVolume = 0.4
+    }
+    if o.NarrationVolume <= 0 {
+        o.NarrationVolume = 1
+    }
+    if o.Subtitles.FontSize == 0 {
+        o.Subtitles = defaultSubtitles
+    }
+    return o
+}
+
+// 按扩展名识别的素材类型
+var (
+    manifestExts  = []string{".yaml", ".yml", ".json"}
+    videoExts     = []string{".mp4", ".mov", ".mkv"}
+    narrationExts = []string{".wav"}
+    musicExts     = []string{".mp3", ".flac", ".m4a", ".aac"}
+    imageExts     = []string{".png", ".jpg", ".jpeg"}
+    subtitleExts  = []string{".srt"}
+)
+
+// hasExt 判断文件扩展名是否在列表中，不区分大小写
+func hasExt(name string, exts []string) bool {
+    ext := strings.ToLower(filepath.Ext(name))
+    for _, e := range exts {
+        if ext == e {
+            return true
+        }
+    }
+    return false
+}
+
+// folderRecipe 为素材文件夹生成配方
+// 文件夹中有配方文件时直接使用；否则按约定组装：视频按文件名顺序拼合，WAV 为解说并决定总时长，
+// 其他音频为背景音乐，图片依次叠加，SRT 为字幕，输出文件以文件夹命名
+func folderRecipe(dir string, options FolderOptions) (*vidfusion.Recipe, error) {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return nil, err
+    }
+    var manifests, videos, narrations, music, images, subtitles []string
+    for _, entry := range entries {
+        name := entry.Name()
+        if entry.IsDir() || strings.HasPrefix(name, ".") {
+            continue
+        }
+        switch {
+        case hasExt(name, manifestExts):
+            manifests = append(manifests, name)
+        case hasExt(name, videoExts):
+            videos = append(videos, name)
+        case hasExt(name, narrationExts):
+            narrations = append(narrations, name)
+        case hasExt(name, musicExts):
+            music = append(music, name)
+        case hasExt(name, imageExts):
+            images = append(images, name)
+        case hasExt(name, subtitleExts):
+            subtitles = append(subtitles, name)
+        }
+    }
+    if len(manifests) > 1 {
+        return nil, fmt.Errorf("more than one recipe in folder: %s", strings.Join(manifests, ", "))
+    }
+    if len(manifests) == 1 {
+        return vidfusion.LoadRecipe(filepath.Join(dir, manifests[0]))
+    }
+    switch {
+    case len(videos) == 0:
+        return nil, fmt.Errorf("no video clips in folder")
+    case len(narrations) != 1:
+        return nil, fmt.Errorf("folder should contain exactly one narration wav, but got %d", len(narrations))
+    case len(music) > 1:
+        return nil, fmt.Errorf("more than one background music in folder: %s", strings.Join(music, ", "))
+    case len(subtitles) > 1:
+        return nil, fmt.Errorf("more than one subtitle file in folder: %s", strings.Join(subtitles, ", "))
+    }
+    options = options.withDefaults()
+    recipe := &vidfusion.Recipe{
+        Name:    filepath.Base(dir),
+        BaseDir: dir,
+        Clips: &vidfusion.RecipeClips{
+            ProcessVideosOptions: vidfusion.ProcessVideosOptions{Width: options.Width, Height: options.Height},
+            DurationFrom:         narrations[0],
+        },
+        Mute:   true,
+        Output: vidfusion.RecipeOutput{File: filepath.Base(dir) + ".mp4", Encoder: options.Encoder},
+    }
+    for _, video := range videos {
+        recipe.Clips.VideosOptions = append(recipe.Clips.VideosOptions, vidfusion.VideosOptions{VideoFile: video})
+    }
+    for _, file := range music {
+        recipe.Audio = append(recipe.Audio, vidfusion.RecipeAudio{File: file, Volume: options.MusicVolume})
+    }
+    recipe.Audio = append(recipe.Audio, vidfusion.RecipeAudio{File: narrations[0], Volume: options.NarrationVolume})
+    for _, image := range images {
+        recipe.Overlays = append(recipe.Overlays, vidfusion.OverlayOptions{ImageFile: image})
+    }
+    if len(subtitles) == 1 {
+        recipe.Subtitles = &vidfusion.RecipeSubtitles{File: subtitles[0], Style: options.Subtitles}
+    }
+    return recipe, recipe.Validate()
+}
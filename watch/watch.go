@@ -0,0 +1,326 @@
+// Package watch 提供监控目录的渲染守护进程
+// 放入输入目录的配方文件或素材文件夹在停止写入后会被渲染，结果连同原始文件和报告一起移动到 done/ 或 failed/ 目录
+package watch
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/HeartGarlic/vidfusion"
+)
+
+// 任务结果
+const (
+    StatusSucceeded = "succeeded" // 渲染成功
+    StatusFailed    = "failed"    // 渲染失败
+)
+
+// ReportFile 每个任务归档目录中的结果报告文件名
+const ReportFile = "report.json"
+
+// workDirName 输入目录中存放渲染中任务的工作目录，以 . 开头不会被当作任务
+const workDirName = ".vidfusion-work"
+
+// Options 监控目录配置
+type Options struct {
+    Dir       string                       // 监控的输入目录，必填
+    DoneDir   string                       // 成功任务的归档目录，默认为 Dir/done，需要与 Dir 位于同一文件系统
+    FailedDir string                       // 失败任务的归档目录，默认为 Dir/failed，需要与 Dir 位于同一文件系统
+    Interval  time.Duration                // 轮询间隔，默认 2 秒
+    Settle    time.Duration                // 文件停止变化多久后开始渲染，默认 10 秒
+    Folder    FolderOptions                // 素材文件夹按约定生成配方时使用的设置
+    NewSDK    func() *vidfusion.VideoSDKV2 // 创建执行任务的 SDK，可以设置 Runner、超时、日志等，默认 NewVideoSDKV2("")
+    Logger    *slog.Logger                 // 日志记录器，默认不输出日志
+}
+
+// Report 任务结果报告，以 JSON 写入归档目录的 report.json
+type Report struct {
+    Job        string            `json:"job"`                   // 任务名称，即配方文件或素材文件夹的名称（不含扩展名）
+    Status     string            `json:"status"`                // 任务结果 succeeded / failed
+    Source     string            `json:"source"`                // 原始配方文件或素材文件夹在归档目录中的路径
+    Dir        string            `json:"dir"`                   // 归档目录
+    Output     string            `json:"output,omitempty"`      // 输出文件路径
+    OutputSize int64             `json:"output_size,omitempty"` // 输出文件大小（字节）
+    Error      string            `json:"error,omitempty"`       // 失败原因
+    FailedStep string            `json:"failed_step,omitempty"` // 失败的步骤名称
+    StartedAt  time.Time         `json:"started_at"`            // 开始时间
+    FinishedAt time.Time         `json:"finished_at"`           // 结束时间
+    Elapsed    float64           `json:"elapsed"`               // 耗时（秒）
+    Recipe     *vidfusion.Recipe `json:"recipe,omitempty"`      // 实际执行的配方
+}
+
+// observation 一个候选任务最近一次观察到的文件状态
+type observation struct {
+    fingerprint string
+    since       time.Time
+}
+
+// Watcher 监控输入目录并依次渲染其中的任务
+type Watcher struct {
+    options Options
+    logger  *slog.Logger
+    pending map[string]observation
+}
+
+// New 创建 Watcher 并创建归档目录
+func New(options Options) (*Watcher, error) {
+    if options.Dir == "" {
+        return nil, fmt.Errorf("watch: Dir is required")
+    }
+    if options.DoneDir == "" {
+        options.DoneDir = filepath.Join(options.Dir, "done")
+    }
+    if options.FailedDir == "" {
+        options.FailedDir = filepath.Join(options.Dir, "failed")
+    }
+    if options.Interval <= 0 {
+        options.Interval = 2 * time.Second
+    }
+    if options.Settle <= 0 {
+        options.Settle = 10 * time.Second
+    }
+    if options.NewSDK == nil {
+        options.NewSDK = func() *vidfusion.VideoSDKV2 { return vidfusion.NewVideoSDKV2("") }
+    }
+    if options.Logger == nil {
+        options.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+    }
+    for _, dir := range []string{options.Dir, options.DoneDir, options.FailedDir, filepath.Join(options.Dir, workDirName)} {
+        if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+            return nil, fmt.Errorf("watch: %v", err)
+        }
+    }
+    return &Watcher{options: options, logger: options.Logger, pending: make(map[string]observation)}, nil
+}
+
+// Run 按轮询间隔持续扫描输入目录，直到 ctx 取消
+// 渲染中被取消的任务保留在输入目录中，下次启动时重新渲染
+func (w *Watcher) Run(ctx context.Context) {
+    w.logger.Info("watching", "dir", w.options.Dir, "interval", w.options.Interval, "settle", w.options.Settle)
+    ticker := time.NewTicker(w.options.Interval)
+    defer ticker.Stop()
+    for {
+        if _, err := w.Scan(ctx); err != nil {
+            w.logger.Error("scan failed", "dir", w.options.Dir, "error", err)
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Scan 扫描一次输入目录，渲染所有已经停止变化的任务并返回它们的报告
+// 配方文件（.yaml / .yml / .json）和素材文件夹需要在连续两次扫描中保持不变且超过 Settle 才会被渲染
+func (w *Watcher) Scan(ctx context.Context) ([]Report, error) {
+    entries, err := os.ReadDir(w.options.Dir)
+    if err != nil {
+        return nil, err
+    }
+    var reports []Report
+    seen := make(map[string]bool)
+    for _, entry := range entries {
+        name := entry.Name()
+        path := filepath.Join(w.options.Dir, name)
+        if !w.candidate(entry, path) {
+            continue
+        }
+        seen[name] = true
+        fingerprint := w.fingerprint(path, entry.IsDir())
+        now := time.Now()
+        previous, ok := w.pending[name]
+        // 空文件夹可能还没开始复制
+        if fingerprint == "" || !ok || previous.fingerprint != fingerprint {
+            w.pending[name] = observation{fingerprint: fingerprint, since: now}
+            continue
+        }
+        if now.Sub(previous.since) < w.options.Settle {
+            continue
+        }
+        if ctx.Err() != nil {
+            break
+        }
+        delete(w.pending, name)
+        if report, ok := w.process(ctx, name, path, entry.IsDir()); ok {
+            reports = append(reports, report)
+        }
+    }
+    for name := range w.pending {
+        if !seen[name] {
+            delete(w.pending, name)
+        }
+    }
+    return reports, nil
+}
+
+// candidate 判断目录项是否可能是任务，跳过隐藏文件、归档目录和其他文件
+func (w *Watcher) candidate(entry os.DirEntry, path string) bool {
+    name := entry.Name()
+    if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+        return false
+    }
+    if !entry.IsDir() {
+        return hasExt(name, manifestExts)
+    }
+    for _, dir := range []string{w.options.DoneDir, w.options.FailedDir} {
+        if sameFile(path, dir) {
+            return false
+        }
+    }
+    return true
+}
+
+// sameFile 判断两个路径是否指向同一个目录
+func sameFile(a, b string) bool {
+    infoA, errA := os.Stat(a)
+    infoB, errB := os.Stat(b)
+    return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// fingerprint 记录任务所有文件的大小和修改时间，用于判断文件是否还在写入
+// 配方文件还会包含其引用的素材，素材不存在时同样记录下来
+func (w *Watcher) fingerprint(path string, isDir bool) string {
+    var lines []string
+    add := func(file string) {
+        info, err := os.Stat(file)
+        if err != nil {
+            lines = append(lines, file+" missing")
+            return
+        }
+        lines = append(lines, fmt.Sprintf("%s %d %d", file, info.Size(), info.ModTime().UnixNano()))
+    }
+    if isDir {
+        _ = filepath.WalkDir(path, func(file string, entry os.DirEntry, err error) error {
+            if err == nil && !entry.IsDir() {
+                add(file)
+            }
+            return nil
+        })
+        return strings.Join(lines, "\n")
+    }
+    add(path)
+    if recipe, err := vidfusion.LoadRecipe(path); err == nil {
+        for _, asset := range recipe.Assets() {
+            if !filepath.IsAbs(asset) {
+                asset = filepath.Join(recipe.BaseDir, asset)
+            }
+            add(asset)
+        }
+    }
+    sort.Strings(lines)
+    return strings.Join(lines, "\n")
+}
+
+// process 渲染一个任务并归档，ctx 取消导致的中断返回 false，任务保留在输入目录中
+func (w *Watcher) process(ctx context.Context, name, path string, isDir bool) (Report, bool) {
+    job := name
+    if !isDir {
+        job = strings.TrimSuffix(name, filepath.Ext(name))
+    }
+    report := Report{Job: job, StartedAt: time.Now()}
+    w.logger.Info("job started", "job", job, "source", path)
+    work, err := os.MkdirTemp(filepath.Join(w.options.Dir, workDirName), job+"-")
+    if err != nil {
+        w.logger.Error("failed to create work directory", "job", job, "error", err)
+        return report, false
+    }
+
+    var recipe *vidfusion.Recipe
+    if isDir {
+        recipe, err = folderRecipe(path, w.options.Folder)
+    } else {
+        recipe, err = vidfusion.LoadRecipe(path)
+    }
+    var output string
+    if err == nil {
+        output = filepath.Base(recipe.Output.File)
+        recipe.Output.File = filepath.Join(work, output)
+        report.Recipe = recipe
+        _, err = recipe.Execute(w.options.NewSDK().WithContext(ctx))
+    }
+    if err != nil && ctx.Err() != nil {
+        _ = os.RemoveAll(work)
+        w.logger.Info("job interrupted", "job", job)
+        return report, false
+    }
+
+    report.FinishedAt = time.Now()
+    report.Elapsed = report.FinishedAt.Sub(report.StartedAt).Seconds()
+    archive := w.options.DoneDir
+    if err == nil {
+        report.Status = StatusSucceeded
+    } else {
+        if output != "" {
+            _ = os.Remove(filepath.Join(work, output))
+        }
+        archive = w.options.FailedDir
+        report.Status = StatusFailed
+        report.Error = err.Error()
+        var stepErr *vidfusion.StepError
+        if errors.As(err, &stepErr) {
+            report.FailedStep = stepErr.Step
+        }
+    }
+    report.Dir = uniqueDir(filepath.Join(archive, job), report.StartedAt)
+    report.Source = filepath.Join(report.Dir, name)
+    if report.Status == StatusSucceeded {
+        report.Output = filepath.Join(report.Dir, output)
+        if info, err := os.Stat(filepath.Join(work, output)); err == nil {
+            report.OutputSize = info.Size()
+        }
+    }
+    if err := w.archive(work, path, name, report); err != nil {
+        // 原始文件还没有移走时丢弃工作目录，下次扫描重新渲染
+        if _, statErr := os.Stat(path); statErr == nil {
+            _ = os.RemoveAll(work)
+        }
+        w.logger.Error("failed to archive job", "job", job, "error", err)
+        return report, false
+    }
+    if report.Status == StatusSucceeded {
+        w.logger.Info("job succeeded", "job", job, "output", report.Output, "elapsed", report.Elapsed)
+    } else {
+        w.logger.Error("job failed", "job", job, "dir", report.Dir, "error", report.Error)
+    }
+    return report, true
+}
+
+// archive 写入报告，将原始文件移入工作目录，再将工作目录移动到归档目录
+func (w *Watcher) archive(work, source, name string, report Report) error {
+    data, err := json.MarshalIndent(report, "", "  ")
+    if err != nil {
+        return err
+    }
+    if err := os.WriteFile(filepath.Join(work, ReportFile), data, 0o644); err != nil {
+        return err
+    }
+    if err := os.Rename(source, filepath.Join(work, name)); err != nil {
+        return err
+    }
+    return os.Rename(work, report.Dir)
+}
+
+// uniqueDir 归档目录已存在时追加开始时间和序号
+func uniqueDir(dir string, started time.Time) string {
+    if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+        return dir
+    }
+    base := dir + "-" + started.Format("20060102-150405")
+    dir = base
+    for i := 2; ; i++ {
+        if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+            return dir
+        }
+        dir = fmt.Sprintf("%s-%d", base, i)
+    }
+}
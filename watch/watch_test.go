@@ -0,0 +1,262 @@
+package watch
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/HeartGarlic/vidfusion"
+)
+
+// renderRunner 模拟 ffmpeg 和 ffprobe 的 Runner
+// 解说时长为 12 秒，视频时长为 8 秒，ffmpeg 将输出写入最后一个参数指定的文件，参数中包含 broken 时返回错误
+type renderRunner struct {
+    mu    sync.Mutex
+    lines []string
+}
+
+// Run 记录命令并生成输出
+func (r *renderRunner) Run(ctx context.Context, cmd *vidfusion.Command) error {
+    line := cmd.Name + " " + strings.Join(cmd.Args, " ")
+    r.mu.Lock()
+    r.lines = append(r.lines, line)
+    r.mu.Unlock()
+    switch {
+    case strings.Contains(line, "broken"):
+        return errors.New("exit status 1")
+    case cmd.Name == "ffprobe" && strings.Contains(line, ".wav"):
+        _, _ = cmd.Stdout.Write([]byte("12"))
+    case cmd.Name == "ffprobe" && strings.Contains(line, "format=duration"):
+        _, _ = cmd.Stdout.Write([]byte("8"))
+    case cmd.Name == "ffprobe" && strings.Contains(line, "stream=width,height"):
+        _, _ = cmd.Stdout.Write([]byte("720x1280"))
+    case cmd.Name == "ffprobe" && strings.Contains(line, "-show_streams"):
+        _, _ = cmd.Stdout.Write([]byte(`{"streams": [{"codec_type": "video", "codec_name": "h264", "width": 720, "height": 1280}, {"codec_type": "audio", "codec_name": "aac"}], "format": {"duration": "8"}}`))
+    case cmd.Name == "ffmpeg":
+        return os.WriteFile(cmd.Args[len(cmd.Args)-1], []byte("rendered"), 0o644)
+    }
+    return nil
+}
+
+// commandLines 返回所有命令行，以换行连接
+func (r *renderRunner) commandLines() string {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return strings.Join(r.lines, "\n")
+}
+
+// newTestWatcher 创建使用 renderRunner 的 Watcher
+func newTestWatcher(t *testing.T, dir string, runner *renderRunner) *Watcher {
+    t.Helper()
+    w, err := New(Options{
+        Dir:    dir,
+        Settle: time.Nanosecond,
+        NewSDK: func() *vidfusion.VideoSDKV2 {
+            return vidfusion.NewVideoSDKV2("").WithRunner(runner)
+        },
+    })
+    if err != nil {
+        t.Fatalf("New error: %v", err)
+    }
+    return w
+}
+
+// writeFiles 在目录中创建文件
+func writeFiles(t *testing.T, dir string, names ...string) {
+    t.Helper()
+    if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+        t.Fatal(err)
+    }
+    for _, name := range names {
+        if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+// scanTwice 连续扫描两次，第一次只记录文件状态
+func scanTwice(t *testing.T, w *Watcher) []Report {
+    t.Helper()
+    if reports, err := w.Scan(context.Background()); err != nil || len(reports) != 0 {
+        t.Fatalf("first scan should only observe files, but got %+v %v", reports, err)
+    }
+    time.Sleep(time.Millisecond)
+    reports, err := w.Scan(context.Background())
+    if err != nil {
+        t.Fatalf("Scan error: %v", err)
+    }
+    return reports
+}
+
+// readReport 读取归档目录中的报告
+func readReport(t *testing.T, dir string) Report {
+    t.Helper()
+    data, err := os.ReadFile(filepath.Join(dir, ReportFile))
+    if err != nil {
+        t.Fatalf("report should be written: %v", err)
+    }
+    var report Report
+    if err := json.Unmarshal(data, &report); err != nil {
+        t.Fatal(err)
+    }
+    return report
+}
+
+// TestWatcher_Folder 测试按约定渲染素材文件夹并归档到 done/
+func TestWatcher_Folder(t *testing.T) {
+    dir := t.TempDir()
+    writeFiles(t, filepath.Join(dir, "anniversary"), "2.mp4", "1.mp4", "narration.wav", "music.flac", "logo.png", "srt.srt", "notes.txt")
+    runner := &renderRunner{}
+    reports := scanTwice(t, newTestWatcher(t, dir, runner))
+    if len(reports) != 1 || reports[0].Status != StatusSucceeded {
+        t.Fatalf("folder should be rendered, but got %+v", reports)
+    }
+    archive := filepath.Join(dir, "done", "anniversary")
+    report := readReport(t, archive)
+    if report.Dir != archive || report.Output != filepath.Join(archive, "anniversary.mp4") || report.OutputSize != int64(len("rendered")) {
+        t.Errorf("unexpected report: %+v", report)
+    }
+    if data, err := os.ReadFile(report.Output); err != nil || string(data) != "rendered" {
+        t.Errorf("output should be archived, but got %q %v", data, err)
+    }
+    if _, err := os.Stat(filepath.Join(archive, "anniversary", "narration.wav")); err != nil {
+        t.Errorf("source folder should be moved into the archive: %v", err)
+    }
+    if _, err := os.Stat(filepath.Join(dir, "anniversary")); !errors.Is(err, os.ErrNotExist) {
+        t.Errorf("source folder should be removed from the input directory")
+    }
+
+    source := filepath.Join(dir, "anniversary")
+    lines := runner.commandLines()
+    first := strings.Index(lines, filepath.Join(source, "1.mp4"))
+    second := strings.Index(lines, filepath.Join(source, "2.mp4"))
+    if first < 0 || second < first {
+        t.Errorf("clips should be concatenated in name order:\n%s", lines)
+    }
+    for _, want := range []string{
+        "-i " + filepath.Join(source, "narration.wav") + " -show_entries format=duration",
+        "-i " + filepath.Join(source, "music.flac") + " -filter_complex [1:a]volume=0.4",
+        "-i " + filepath.Join(source, "logo.png"),
+        "subtitles='" + filepath.Join(source, "srt.srt") + "':force_style='Alignment=2,Fontsize=16",
+    } {
+        if !strings.Contains(lines, want) {
+            t.Errorf("commands should contain %q:\n%s", want, lines)
+        }
+    }
+}
+
+// TestWatcher_Manifest 测试渲染配方文件，引用的素材保留在输入目录中，同名任务归档到不同目录
+func TestWatcher_Manifest(t *testing.T) {
+    dir := t.TempDir()
+    writeFiles(t, dir, "in.mp4")
+    manifest := "input: in.mp4\ntrim: {start: 1, end: 3}\noutput: {file: out/final.mp4}\n"
+    w := newTestWatcher(t, dir, &renderRunner{})
+    for i, archive := range []string{"job", "job-"} {
+        if err := os.WriteFile(filepath.Join(dir, "job.yaml"), []byte(manifest), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        reports := scanTwice(t, w)
+        if len(reports) != 1 || reports[0].Status != StatusSucceeded {
+            t.Fatalf("manifest %d should be rendered, but got %+v", i, reports)
+        }
+        report := reports[0]
+        if !strings.HasPrefix(report.Dir, filepath.Join(dir, "done", archive)) || report.Output != filepath.Join(report.Dir, "final.mp4") || report.Source != filepath.Join(report.Dir, "job.yaml") {
+            t.Errorf("unexpected report: %+v", report)
+        }
+        if _, err := os.Stat(report.Source); err != nil {
+            t.Errorf("manifest should be archived: %v", err)
+        }
+    }
+    if _, err := os.Stat(filepath.Join(dir, "in.mp4")); err != nil {
+        t.Errorf("referenced assets should stay in the input directory: %v", err)
+    }
+}
+
+// TestWatcher_Failed 测试渲染失败和无效的任务归档到 failed/
+func TestWatcher_Failed(t *testing.T) {
+    dir := t.TempDir()
+    writeFiles(t, filepath.Join(dir, "broken"), "1.mp4", "narration.wav")
+    writeFiles(t, filepath.Join(dir, "empty-clips"), "narration.wav")
+    if err := os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"input": "in.mp4"}`), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    reports := scanTwice(t, newTestWatcher(t, dir, &renderRunner{}))
+    if len(reports) != 3 {
+        t.Fatalf("all jobs should be processed, but got %+v", reports)
+    }
+    for job, want := range map[string]string{
+        "broken":      "exit status 1",
+        "empty-clips": "no video clips in folder",
+        "bad":         "output: file is required",
+    } {
+        report := readReport(t, filepath.Join(dir, "failed", job))
+        if report.Status != StatusFailed || !strings.Contains(report.Error, want) || report.Output != "" {
+            t.Errorf("%s should fail with %q, but got %+v", job, want, report)
+        }
+    }
+    if report := readReport(t, filepath.Join(dir, "failed", "broken")); report.FailedStep == "" {
+        t.Errorf("failed step should be reported, but got %+v", report)
+    }
+    if entries, _ := os.ReadDir(filepath.Join(dir, "failed", "broken")); len(entries) != 2 {
+        t.Errorf("failed archive should only contain the source and the report, but got %v", entries)
+    }
+}
+
+// TestWatcher_Settle 测试文件仍在变化时不会开始渲染
+func TestWatcher_Settle(t *testing.T) {
+    dir := t.TempDir()
+    folder := filepath.Join(dir, "job")
+    writeFiles(t, folder, "1.mp4")
+    w := newTestWatcher(t, dir, &renderRunner{})
+    ctx := context.Background()
+    if reports, _ := w.Scan(ctx); len(reports) != 0 {
+        t.Fatalf("first scan should not render, but got %+v", reports)
+    }
+    writeFiles(t, folder, "narration.wav")
+    if reports, _ := w.Scan(ctx); len(reports) != 0 {
+        t.Fatalf("growing folder should not be rendered, but got %+v", reports)
+    }
+    if reports, _ := w.Scan(ctx); len(reports) != 1 || reports[0].Status != StatusSucceeded {
+        t.Fatalf("settled folder should be rendered, but got %+v", reports)
+    }
+
+    w.options.Settle = time.Hour
+    writeFiles(t, filepath.Join(dir, "later"), "1.mp4", "narration.wav")
+    for i := 0; i < 2; i++ {
+        if reports, _ := w.Scan(ctx); len(reports) != 0 {
+            t.Fatalf("folder should wait for the settle time, but got %+v", reports)
+        }
+    }
+    if entries, _ := os.ReadDir(filepath.Join(dir, "done")); len(entries) != 1 {
+        t.Errorf("only the settled job should be archived, but got %v", entries)
+    }
+}
+
+// Test_folderRecipe 测试素材文件夹的约定
+func Test_folderRecipe(t *testing.T) {
+    dir := t.TempDir()
+    writeFiles(t, filepath.Join(dir, "two-narrations"), "1.mp4", "a.wav", "b.wav")
+    writeFiles(t, filepath.Join(dir, "two-recipes"), "a.yaml", "b.json")
+    writeFiles(t, filepath.Join(dir, "ok"), "1.MP4", "narration.WAV")
+    for name, want := range map[string]string{
+        "two-narrations": "exactly one narration wav, but got 2",
+        "two-recipes":    "more than one recipe",
+    } {
+        if _, err := folderRecipe(filepath.Join(dir, name), FolderOptions{}); err == nil || !strings.Contains(err.Error(), want) {
+            t.Errorf("%s should fail with %q, but got %v", name, want, err)
+        }
+    }
+    recipe, err := folderRecipe(filepath.Join(dir, "ok"), FolderOptions{Width: 1080, Height: 1920, Encoder: "x265"})
+    if err != nil {
+        t.Fatalf("folderRecipe error: %v", err)
+    }
+    if recipe.Clips.Width != 1080 || recipe.Clips.DurationFrom != "narration.WAV" || recipe.Output.File != "ok.mp4" || recipe.Output.Encoder != "x265" || len(recipe.Audio) != 1 || recipe.Audio[0].Volume != 1 {
+        t.Errorf("unexpected recipe: %+v", recipe)
+    }
+}